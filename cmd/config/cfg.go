@@ -1,28 +1,114 @@
 package config
 
-import "os"
+import (
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"gin_training/internal/config"
+)
 
 type Config struct {
-	HTTPPort string
-	// Postgres
-	Grpc string
+	HTTPAddr string `yaml:"http_addr" env:"HTTP_ADDR,HTTPPort" default:":8080" validate:"addr"`
+	// gRPC servers: several addresses, or a single one resolved through
+	// DNS, balanced with GRPCLBPolicy
+	GRPCAddrs    []string `yaml:"grpc_addr" env:"GRPC_ADDR,GRPC" default:":9000" validate:"target"`
+	GRPCLBPolicy string   `yaml:"grpc_lb_policy" env:"GRPC_LB_POLICY" default:"round_robin" validate:"oneof=round_robin least_request pick_first"`
+	// Calls to the gRPC server: the timeout covers the retries of the
+	// reads, the breaker opens after GRPCBreakerFailures calls in a row
+	// found the server down
+	GRPCTimeout             time.Duration `yaml:"grpc_timeout" env:"GRPC_TIMEOUT" default:"5s" validate:"positive" reload:"true"`
+	GRPCRetryMaxAttempts    int           `yaml:"grpc_retry_max_attempts" env:"GRPC_RETRY_MAX_ATTEMPTS" default:"3" validate:"positive"`
+	GRPCRetryInitialBackoff time.Duration `yaml:"grpc_retry_initial_backoff" env:"GRPC_RETRY_INITIAL_BACKOFF" default:"100ms" validate:"positive"`
+	GRPCRetryMaxBackoff     time.Duration `yaml:"grpc_retry_max_backoff" env:"GRPC_RETRY_MAX_BACKOFF" default:"1s" validate:"positive"`
+	GRPCBreakerFailures     int           `yaml:"grpc_breaker_failures" env:"GRPC_BREAKER_FAILURES" default:"5" validate:"positive"`
+	GRPCBreakerCooldown     time.Duration `yaml:"grpc_breaker_cooldown" env:"GRPC_BREAKER_COOLDOWN" default:"10s" validate:"positive"`
+	// Book cache in front of the storage, a size of 0 disables it
+	BookCacheSize        int           `yaml:"book_cache_size" env:"BOOK_CACHE_SIZE"`
+	BookCacheTTL         time.Duration `yaml:"book_cache_ttl" env:"BOOK_CACHE_TTL" default:"30s" validate:"positive"`
+	BookCacheNegativeTTL time.Duration `yaml:"book_cache_negative_ttl" env:"BOOK_CACHE_NEGATIVE_TTL" default:"5s"`
+	// Cache-Control of the book reads, sent with their ETag and
+	// Last-Modified
+	CacheControlList string `yaml:"cache_control_list" env:"CACHE_CONTROL_LIST" default:"private, no-cache"`
+	CacheControlBook string `yaml:"cache_control_book" env:"CACHE_CONTROL_BOOK" default:"private, no-cache"`
+	// Date until which the unversioned routes, deprecated by /v1, are
+	// served, announced in their Sunset header
+	LegacySunset string `yaml:"legacy_sunset" env:"LEGACY_SUNSET" default:"2027-04-19" validate:"date"`
+	// Auth
+	AuthDisabled  bool     `yaml:"auth_disabled" env:"AUTH_DISABLED"`
+	JWTSecret     string   `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	JWTPublicKeys []string `yaml:"jwt_public_key_files" env:"JWT_PUBLIC_KEY_FILES"`
+	JWKSFile      string   `yaml:"jwt_jwks_file" env:"JWT_JWKS_FILE"`
+	JWTAudience   string   `yaml:"jwt_audience" env:"JWT_AUDIENCE"`
+	JWTIssuer     string   `yaml:"jwt_issuer" env:"JWT_ISSUER"`
+	// RBAC
+	RBACPolicyFile string `yaml:"rbac_policy_file" env:"RBAC_POLICY_FILE"`
+	// mTLS to the gRPC server
+	TLSCertFile    string `yaml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile     string `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+	TLSCAFile      string `yaml:"tls_ca_file" env:"TLS_CA_FILE"`
+	GRPCServerName string `yaml:"grpc_server_name" env:"GRPC_SERVER_NAME"`
+	// Proxies whose X-Forwarded-For is trusted to identify clients, IPs or
+	// CIDRs. Without them clients are told apart by their address
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" validate:"cidr"`
+	// CORS
+	CORSOrigins []string `yaml:"cors_origins" env:"CORS_ORIGINS" reload:"true"`
+	// Rate limiting
+	RateLimitFile string `yaml:"rate_limit_file" env:"RATE_LIMIT_FILE" reload:"true"`
+	// Metrics, served apart from the API
+	MetricsAddr string `yaml:"metrics_addr" env:"METRICS_ADDR" default:":9091" validate:"addr"`
+	// Tracing
+	TracingExporter    string  `yaml:"tracing_exporter" env:"TRACING_EXPORTER"`
+	TracingEndpoint    string  `yaml:"tracing_endpoint" env:"TRACING_ENDPOINT"`
+	TracingInsecure    bool    `yaml:"tracing_insecure" env:"TRACING_INSECURE"`
+	TracingFile        string  `yaml:"tracing_file" env:"TRACING_FILE"`
+	TracingSampleRatio float64 `yaml:"tracing_sample_ratio" env:"TRACING_SAMPLE_RATIO" validate:"ratio"`
+	// Logging
+	LogLevel string `yaml:"log_level" env:"LOG_LEVEL" reload:"true"`
+	// Shutdown
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY" reload:"true"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"30s" validate:"positive" reload:"true"`
 }
 
-func SetConfig() *Config {
-	var config Config
-
-	config.HTTPPort = os.Getenv("HTTPPort")
-	if config.HTTPPort == "" {
-		config.HTTPPort = ":8080"
+// Load reads the gateway config from its defaults, the config file, the
+// environment and args.
+func Load(args []string) (*Config, config.Source, error) {
+	cfg := &Config{}
+	src, err := config.Load(cfg, "gateway", args)
+	if err != nil {
+		return nil, src, err
 	}
 
-	config.Grpc = os.Getenv("GRPC")
-	if config.Grpc == "" {
-		config.Grpc = ":9000"
+	if cfg.GRPCServerName == "" {
+		var addr string
+		if len(cfg.GRPCAddrs) > 0 {
+			addr = cfg.GRPCAddrs[0]
+		}
+		if _, endpoint, ok := strings.Cut(addr, ":///"); ok {
+			addr = endpoint
+		}
+		if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+			cfg.GRPCServerName = host
+		} else {
+			cfg.GRPCServerName = "localhost"
+		}
 	}
 
-	return &Config{
-		HTTPPort: config.HTTPPort,
-		Grpc:     config.Grpc,
+	return cfg, src, nil
+}
+
+// NewReloader reloads the config from args, as the gateway was started, and
+// hands the reloadable settings to apply.
+func NewReloader(args []string, cfg *Config, apply func(*Config) error, observe func(error)) *config.Reloader[Config] {
+	load := func() (*Config, error) {
+		cfg, _, err := Load(args)
+		return cfg, err
 	}
+	return config.NewReloader(cfg, load, apply, observe)
+}
+
+// Print writes the config as YAML with its secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	return config.Print(w, c)
 }
@@ -1,63 +1,93 @@
 package configGRPC
 
-import "os"
+import (
+	"io"
+	"time"
+
+	"gin_training/internal/config"
+)
 
 type Config struct {
-	TcpPort string
-	// Postgres
-	PostgresHost string
-	PostgresPort string
-	PostgresUser string
-	PostgresPsw  string
-	PostgresDB   string
-	PostgresSSL  string
+	GRPCAddr string `yaml:"grpc_addr" env:"GRPC_ADDR,TcpPort" default:"127.0.0.1:9000" validate:"addr"`
+	// Postgres, the URL takes precedence over the separate settings
+	PostgresURL      string `yaml:"postgres_url" env:"POSTGRES_URL,DATABASE_URL" secret:"true"`
+	PostgresHost     string `yaml:"postgres_host" env:"POSTGRES_HOST" default:"localhost"`
+	PostgresPort     string `yaml:"postgres_port" env:"POSTGRES_PORT" default:"5432" validate:"port"`
+	PostgresUser     string `yaml:"postgres_user" env:"POSTGRES_USER" default:"postgres"`
+	PostgresPassword string `yaml:"postgres_password" env:"POSTGRES_PASSWORD" default:"postgres" secret:"true"`
+	PostgresDB       string `yaml:"postgres_db" env:"POSTGRES_DB,POSTGRES_DATABASE" default:"postgres"`
+	PostgresSSL      string `yaml:"postgres_ssl" env:"POSTGRES_SSL" default:"disable"`
+	// Postgres read replicas, reads of a caller stay on the primary for
+	// PostgresReadYourWrites after its writes
+	PostgresReplicas             []string      `yaml:"postgres_replicas" env:"POSTGRES_REPLICAS" secret:"true"`
+	PostgresReadYourWrites       time.Duration `yaml:"postgres_read_your_writes" env:"POSTGRES_READ_YOUR_WRITES" default:"5s"`
+	PostgresReplicaCheckInterval time.Duration `yaml:"postgres_replica_check_interval" env:"POSTGRES_REPLICA_CHECK_INTERVAL" default:"5s" validate:"positive"`
+	// Postgres connection pool
+	PostgresMaxOpenConns    int           `yaml:"postgres_max_open_conns" env:"POSTGRES_MAX_OPEN_CONNS" default:"20" validate:"positive"`
+	PostgresMaxIdleConns    int           `yaml:"postgres_max_idle_conns" env:"POSTGRES_MAX_IDLE_CONNS" default:"10" validate:"positive"`
+	PostgresConnMaxLifetime time.Duration `yaml:"postgres_conn_max_lifetime" env:"POSTGRES_CONN_MAX_LIFETIME" default:"30m"`
+	PostgresConnMaxIdleTime time.Duration `yaml:"postgres_conn_max_idle_time" env:"POSTGRES_CONN_MAX_IDLE_TIME" default:"5m"`
+	PostgresConnectAttempts int           `yaml:"postgres_connect_attempts" env:"POSTGRES_CONNECT_ATTEMPTS" default:"5" validate:"positive"`
+	PostgresConnectBackoff  time.Duration `yaml:"postgres_connect_backoff" env:"POSTGRES_CONNECT_BACKOFF" default:"1s" validate:"positive"`
+	// Book cache in front of the storage, a size of 0 disables it
+	BookCacheSize        int           `yaml:"book_cache_size" env:"BOOK_CACHE_SIZE"`
+	BookCacheTTL         time.Duration `yaml:"book_cache_ttl" env:"BOOK_CACHE_TTL" default:"30s" validate:"positive"`
+	BookCacheNegativeTTL time.Duration `yaml:"book_cache_negative_ttl" env:"BOOK_CACHE_NEGATIVE_TTL" default:"5s"`
+	// Auth
+	AuthDisabled  bool     `yaml:"auth_disabled" env:"AUTH_DISABLED"`
+	JWTSecret     string   `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	JWTPublicKeys []string `yaml:"jwt_public_key_files" env:"JWT_PUBLIC_KEY_FILES"`
+	JWKSFile      string   `yaml:"jwt_jwks_file" env:"JWT_JWKS_FILE"`
+	JWTAudience   string   `yaml:"jwt_audience" env:"JWT_AUDIENCE"`
+	JWTIssuer     string   `yaml:"jwt_issuer" env:"JWT_ISSUER"`
+	// RBAC
+	RBACPolicyFile string `yaml:"rbac_policy_file" env:"RBAC_POLICY_FILE"`
+	// mTLS
+	TLSCertFile       string   `yaml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile        string   `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+	TLSCAFile         string   `yaml:"tls_ca_file" env:"TLS_CA_FILE"`
+	TLSAllowedClients []string `yaml:"tls_allowed_clients" env:"TLS_ALLOWED_CLIENTS"`
+	// Rate limiting. The gateways trusted to forward the address of their
+	// clients, IPs or CIDRs
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" validate:"cidr"`
+	RateLimitFile  string   `yaml:"rate_limit_file" env:"RATE_LIMIT_FILE" reload:"true"`
+	// Metrics
+	MetricsAddr string `yaml:"metrics_addr" env:"METRICS_ADDR,METRICS_PORT" default:":9090" validate:"addr"`
+	// Tracing
+	TracingExporter    string  `yaml:"tracing_exporter" env:"TRACING_EXPORTER"`
+	TracingEndpoint    string  `yaml:"tracing_endpoint" env:"TRACING_ENDPOINT"`
+	TracingInsecure    bool    `yaml:"tracing_insecure" env:"TRACING_INSECURE"`
+	TracingFile        string  `yaml:"tracing_file" env:"TRACING_FILE"`
+	TracingSampleRatio float64 `yaml:"tracing_sample_ratio" env:"TRACING_SAMPLE_RATIO" validate:"ratio"`
+	// Logging
+	LogLevel string `yaml:"log_level" env:"LOG_LEVEL" reload:"true"`
+	// Shutdown
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY" reload:"true"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"30s" validate:"positive" reload:"true"`
 }
 
-func SetConfig() *Config {
-	var config Config
-
-	config.TcpPort = os.Getenv("TcpPort")
-	if config.TcpPort == "" {
-		config.TcpPort = "127.0.0.1:9000"
-	}
-
-	config.PostgresHost = os.Getenv("POSTGRES_HOST")
-	if config.PostgresHost == "" {
-		config.PostgresHost = "localhost"
-	}
-
-	config.PostgresPort = os.Getenv("POSTGRES_PORT")
-	if config.PostgresPort == "" {
-		config.PostgresPort = "5432"
-	}
-
-	config.PostgresUser = os.Getenv("POSTGRES_USER")
-	if config.PostgresUser == "" {
-		config.PostgresUser = "postgres"
-	}
-
-	config.PostgresPsw = os.Getenv("POSTGRES_PASSWORD")
-	if config.PostgresPsw == "" {
-		config.PostgresPsw = "postgres"
-	}
-
-	config.PostgresDB = os.Getenv("POSTGRES_DATABASE")
-	if config.PostgresDB == "" {
-		config.PostgresDB = "postgres"
+// Load reads the gRPC server config from its defaults, the config file, the
+// environment and args.
+func Load(args []string) (*Config, config.Source, error) {
+	cfg := &Config{}
+	src, err := config.Load(cfg, "grpc", args)
+	if err != nil {
+		return nil, src, err
 	}
+	return cfg, src, nil
+}
 
-	config.PostgresSSL = os.Getenv("POSTGRES_SSL")
-	if config.PostgresSSL == "" {
-		config.PostgresSSL = "disable"
+// NewReloader reloads the config from args, as the gRPC server was started, and
+// hands the reloadable settings to apply.
+func NewReloader(args []string, cfg *Config, apply func(*Config) error, observe func(error)) *config.Reloader[Config] {
+	load := func() (*Config, error) {
+		cfg, _, err := Load(args)
+		return cfg, err
 	}
+	return config.NewReloader(cfg, load, apply, observe)
+}
 
-	return &Config{
-		TcpPort:      config.TcpPort,
-		PostgresHost: config.PostgresHost,
-		PostgresPort: config.PostgresPort,
-		PostgresUser: config.PostgresUser,
-		PostgresPsw:  config.PostgresPsw,
-		PostgresDB:   config.PostgresDB,
-		PostgresSSL:  config.PostgresSSL,
-	}
+// Print writes the config as YAML with its secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	return config.Print(w, c)
 }
@@ -1,37 +1,312 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"gin_training/cmd/grpc/configGRPC"
+	"gin_training/internal/auth"
+	"gin_training/internal/health"
+	"gin_training/internal/logging"
+	"gin_training/internal/metrics"
+	"gin_training/internal/mtls"
 	"gin_training/internal/myGRPC/server"
 	pb "gin_training/internal/proto"
+	"gin_training/internal/ratelimit"
+	"gin_training/internal/rbac"
+	"gin_training/internal/storage/cache"
 	storage "gin_training/internal/storage/postgreSQL"
+	"gin_training/internal/tracing"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	cfg := configGRPC.SetConfig()
+	cfg, src, err := configGRPC.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+	if src.PrintOnly {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("couldn't print config: %v", err)
+		}
+		return
+	}
+
+	logLevel := new(slog.LevelVar)
+	logger := logging.New(os.Stdout, logLevel)
+	slog.SetDefault(logger)
+	for _, a := range src.Deprecated {
+		logger.Warn("deprecated env variable, rename it", "env", a.Env, "use", a.Canonical)
+	}
+
+	// The reloadable settings are applied here, at startup and on every
+	// reload.
+	limiter := ratelimit.New(ratelimit.DefaultConfig())
+	apply := func(cfg *configGRPC.Config) error {
+		level, err := logging.ParseLevel(cfg.LogLevel)
+		if err != nil {
+			return fmt.Errorf("invalid log level: %w", err)
+		}
+		limits := ratelimit.DefaultConfig()
+		if cfg.RateLimitFile != "" {
+			if limits, err = ratelimit.LoadConfig(cfg.RateLimitFile); err != nil {
+				return err
+			}
+		}
+
+		logLevel.Set(level)
+		limiter.SetConfig(limits)
+		return nil
+	}
+	if err := apply(cfg); err != nil {
+		fatal(logger, "invalid config", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, "books-grpc", tracing.Config{
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		Insecure:    cfg.TracingInsecure,
+		File:        cfg.TracingFile,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		fatal(logger, "couldn't set up tracing", err)
+	}
 
 	//start listening on tcp
-	lis, err := net.Listen("tcp", cfg.TcpPort)
+	lis, err := net.Listen("tcp", cfg.GRPCAddr)
 	if err != nil {
-		log.Fatalf("failed to listen: %s", err)
+		fatal(logger, "failed to listen", err)
 	}
 
-	db, err := storage.NewPDB(cfg.PostgresHost, cfg.PostgresPort, cfg.PostgresUser, cfg.PostgresPsw, cfg.PostgresDB, cfg.PostgresSSL)
+	dbOpts := []storage.Option{storage.WithLogger(logger)}
+	if cfg.PostgresReadYourWrites > 0 {
+		dbOpts = append(dbOpts, storage.WithReadYourWrites(cfg.PostgresReadYourWrites))
+	}
+	db, err := storage.NewPDB(ctx, storage.Config{
+		URL:             cfg.PostgresURL,
+		Host:            cfg.PostgresHost,
+		Port:            cfg.PostgresPort,
+		User:            cfg.PostgresUser,
+		Password:        cfg.PostgresPassword,
+		Database:        cfg.PostgresDB,
+		SSLMode:         cfg.PostgresSSL,
+		Replicas:        cfg.PostgresReplicas,
+		MaxOpenConns:    cfg.PostgresMaxOpenConns,
+		MaxIdleConns:    cfg.PostgresMaxIdleConns,
+		ConnMaxLifetime: cfg.PostgresConnMaxLifetime,
+		ConnMaxIdleTime: cfg.PostgresConnMaxIdleTime,
+		ConnectAttempts: cfg.PostgresConnectAttempts,
+		ConnectBackoff:  cfg.PostgresConnectBackoff,
+	}, dbOpts...)
 	if err != nil {
-		log.Fatalf("couldn't connect to db: %v\n", err)
+		fatal(logger, "couldn't connect to db", err)
+	}
+
+	go migrate(ctx, db, logger)
+
+	checker := health.NewChecker(2 * time.Second)
+	checker.Add("database", func(ctx context.Context) (string, error) {
+		return "", db.Ping(ctx)
+	})
+	checker.Add("migrations", func(ctx context.Context) (string, error) {
+		status, err := db.MigrationStatus(ctx)
+		if err == nil && status.Pending() {
+			err = errors.New("migrations pending")
+		}
+		return status.String(), err
+	})
+	if len(cfg.PostgresReplicas) > 0 {
+		go db.WatchReplicas(ctx, cfg.PostgresReplicaCheckInterval, 2*time.Second)
+		checker.Add("replicas", func(ctx context.Context) (string, error) {
+			return db.ReplicaStatus(), nil
+		})
 	}
 
-	log.Println(db.Pdb.Ping())
+	reg := metrics.NewRegistry()
+	reloader := configGRPC.NewReloader(os.Args[1:], cfg, apply, metrics.NewReloads(reg).Observe)
+	go reloader.Watch(ctx, 5*time.Second, func(cfg *configGRPC.Config) []string {
+		return []string{src.File, cfg.RateLimitFile}
+	})
 
-	s := grpc.NewServer()
-	pb.RegisterBookServiceServer(s, server.NewGRPCStorage(db))
+	metrics.RegisterDBStats(reg, db.Pdb)
+	queries := metrics.NewDB(reg)
+	books, keys := queries.Books(db), queries.APIKeys(db)
+	if cfg.BookCacheSize > 0 {
+		books = cache.New(books, cache.Config{
+			Size:        cfg.BookCacheSize,
+			TTL:         cfg.BookCacheTTL,
+			NegativeTTL: cfg.BookCacheNegativeTTL,
+		}, cache.WithObserver(metrics.NewCache(reg).Observe), cache.WithLogger(logger))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(reg))
+	mux.Handle("/healthz", health.LiveHandler())
+	mux.Handle("/readyz", health.ReadyHandler(checker))
+	metricsSrv := &http.Server{Addr: cfg.MetricsAddr, Handler: mux}
+
+	go func() {
+		logger.Info("metrics and health checks served", "addr", cfg.MetricsAddr)
+		if err := metricsSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed to serve metrics", "error", err)
+		}
+	}()
 
-	log.Printf("GRPC server started on port: %v\n", cfg.TcpPort)
+	var (
+		opts         []grpc.ServerOption
+		interceptors = []grpc.UnaryServerInterceptor{
+			server.TracingInterceptor(),
+			server.LoggingInterceptor(logger),
+			metrics.NewGRPC(reg).UnaryServerInterceptor(),
+		}
+		// Streams, such as Health/Watch, go through the same checks.
+		streamInterceptors []grpc.StreamServerInterceptor
+	)
 
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %s", err)
+	tlsCfg := mtls.Config{CertFile: cfg.TLSCertFile, KeyFile: cfg.TLSKeyFile, CAFile: cfg.TLSCAFile}
+	if tlsCfg.Enabled() {
+		certs, err := mtls.NewReloader(tlsCfg)
+		if err != nil {
+			fatal(logger, "couldn't set up mutual TLS", err)
+		}
+		go certs.Watch(ctx, 5*time.Second)
+		opts = append(opts, grpc.Creds(credentials.NewTLS(certs.ServerConfig())))
+
+		if len(cfg.TLSAllowedClients) > 0 {
+			interceptors = append(interceptors, server.PeerInterceptor(cfg.TLSAllowedClients))
+			streamInterceptors = append(streamInterceptors, server.PeerStreamInterceptor(cfg.TLSAllowedClients))
+		} else {
+			logger.Warn("TLS_ALLOWED_CLIENTS is empty, any certificate signed by the CA is accepted")
+		}
+	} else {
+		logger.Warn("mutual TLS isn't configured, the gRPC server accepts plaintext connections")
 	}
+
+	interceptors = append(interceptors, server.IPRateLimitInterceptor(limiter, cfg.TrustedProxies))
+	streamInterceptors = append(streamInterceptors, server.IPRateLimitStreamInterceptor(limiter, cfg.TrustedProxies))
+
+	if cfg.AuthDisabled {
+		logger.Warn("authentication is disabled, the storage is open to anyone")
+	} else {
+		verifier, err := auth.NewVerifier(auth.Config{
+			HMACSecret:     []byte(cfg.JWTSecret),
+			PublicKeyFiles: cfg.JWTPublicKeys,
+			JWKSFile:       cfg.JWKSFile,
+			Audience:       cfg.JWTAudience,
+			Issuer:         cfg.JWTIssuer,
+			Leeway:         30 * time.Second,
+		})
+		if err != nil {
+			fatal(logger, "couldn't set up authentication (set AUTH_DISABLED=true to run without it)", err)
+		}
+
+		policy := rbac.DefaultPolicy()
+		if cfg.RBACPolicyFile != "" {
+			if policy, err = rbac.LoadPolicy(cfg.RBACPolicyFile); err != nil {
+				fatal(logger, "couldn't load RBAC policy", err)
+			}
+		}
+		enforcer := rbac.NewEnforcer(policy)
+		if cfg.RBACPolicyFile != "" {
+			go enforcer.Watch(ctx, cfg.RBACPolicyFile, 5*time.Second)
+		}
+
+		interceptors = append(interceptors, server.AuthInterceptor(verifier, enforcer, keys))
+		streamInterceptors = append(streamInterceptors, server.AuthStreamInterceptor(verifier, enforcer, keys))
+	}
+
+	interceptors = append(interceptors, server.RateLimitInterceptor(limiter))
+	streamInterceptors = append(streamInterceptors, server.RateLimitStreamInterceptor(limiter))
+
+	opts = append(opts, grpc.ChainUnaryInterceptor(interceptors...), grpc.ChainStreamInterceptor(streamInterceptors...))
+
+	s := grpc.NewServer(opts...)
+	pb.RegisterBookServiceServer(s, server.NewGRPCStorage(books))
+	pb.RegisterAPIKeyServiceServer(s, server.NewGRPCAPIKeys(keys))
+
+	healthServer := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+	go health.Watch(ctx, checker, healthServer, 5*time.Second,
+		pb.BookService_ServiceDesc.ServiceName, pb.APIKeyService_ServiceDesc.ServiceName)
+
+	go func() {
+		logger.Info("GRPC server started", "addr", cfg.GRPCAddr)
+		if err := s.Serve(lis); err != nil {
+			fatal(logger, "failed to serve", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	cfg = reloader.Current()
+	logger.Info("shutting down", "delay", cfg.ShutdownDelay, "timeout", cfg.ShutdownTimeout)
+
+	// Readiness flips first, on the health service and on /readyz, so
+	// clients move to other servers during the delay.
+	healthServer.Shutdown()
+	checker.Drain()
+	time.Sleep(cfg.ShutdownDelay)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.GracefulStop(drainCtx, s); err != nil {
+		logger.Warn("calls still running after the drain timeout, stopped them", "error", err)
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := metricsSrv.Shutdown(flushCtx); err != nil {
+		logger.Warn("couldn't stop the metrics server", "error", err)
+	}
+	if err := db.Close(); err != nil {
+		logger.Warn("couldn't close the database pool", "error", err)
+	}
+	if err := shutdownTracing(flushCtx); err != nil {
+		logger.Warn("couldn't flush traces", "error", err)
+	}
+
+	logger.Info("stopped")
+}
+
+// migrate applies the schema migrations, retrying until the database is
+// reachable. The server reports NOT_SERVING meanwhile.
+func migrate(ctx context.Context, db *storage.PostgresDB, logger *slog.Logger) {
+	for {
+		err := db.Migrate(ctx)
+		if err == nil {
+			return
+		}
+		logger.Warn("couldn't migrate the database, retrying", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// fatal logs err and exits, slog has no fatal level.
+func fatal(l *slog.Logger, msg string, err error) {
+	l.Error(msg, "error", err)
+	os.Exit(1)
 }
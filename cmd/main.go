@@ -2,50 +2,267 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gin_training/internal/auth"
+	"gin_training/internal/health"
+	"gin_training/internal/logging"
+	"gin_training/internal/metrics"
+	"gin_training/internal/mtls"
 	"gin_training/internal/myGRPC/clientGRPC"
 	pb "gin_training/internal/proto"
+	"gin_training/internal/ratelimit"
+	"gin_training/internal/rbac"
+	"gin_training/internal/storage/cache"
+	storage "gin_training/internal/storage/postgreSQL"
+	"gin_training/internal/tracing"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"gin_training/cmd/config"
 	"gin_training/internal/controller"
 )
 
 func main() {
-	cfg := config.SetConfig()
+	cfg, src, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+	if src.PrintOnly {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("couldn't print config: %v", err)
+		}
+		return
+	}
+
+	logLevel := new(slog.LevelVar)
+	logger := logging.New(os.Stdout, logLevel)
+	slog.SetDefault(logger)
+	for _, a := range src.Deprecated {
+		logger.Warn("deprecated env variable, rename it", "env", a.Env, "use", a.Canonical)
+	}
+
+	// The reloadable settings are applied here, at startup and on every
+	// reload.
+	limiter := ratelimit.New(ratelimit.DefaultConfig())
+	cors := controller.NewCORS(nil)
+	var grpcTimeout atomic.Int64
+	apply := func(cfg *config.Config) error {
+		level, err := logging.ParseLevel(cfg.LogLevel)
+		if err != nil {
+			return fmt.Errorf("invalid log level: %w", err)
+		}
+		limits := ratelimit.DefaultConfig()
+		if cfg.RateLimitFile != "" {
+			if limits, err = ratelimit.LoadConfig(cfg.RateLimitFile); err != nil {
+				return err
+			}
+		}
+
+		logLevel.Set(level)
+		limiter.SetConfig(limits)
+		cors.SetOrigins(cfg.CORSOrigins)
+		grpcTimeout.Store(int64(cfg.GRPCTimeout))
+		return nil
+	}
+	if err := apply(cfg); err != nil {
+		fatal(logger, "invalid config", err)
+	}
 
-	conn, err := grpc.Dial(cfg.Grpc, grpc.WithInsecure())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, "books-gateway", tracing.Config{
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		Insecure:    cfg.TracingInsecure,
+		File:        cfg.TracingFile,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
 	if err != nil {
-		log.Fatalf("did not connect to grpc: %v", err)
+		fatal(logger, "couldn't set up tracing", err)
 	}
-	defer conn.Close()
 
-	store := clientGRPC.New(pb.NewBookServiceClient(conn))
+	transport := grpc.WithInsecure()
+	tlsCfg := mtls.Config{CertFile: cfg.TLSCertFile, KeyFile: cfg.TLSKeyFile, CAFile: cfg.TLSCAFile}
+	if tlsCfg.Enabled() {
+		certs, err := mtls.NewReloader(tlsCfg)
+		if err != nil {
+			fatal(logger, "couldn't set up mutual TLS", err)
+		}
+		go certs.Watch(ctx, 5*time.Second)
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(certs.ClientConfig(cfg.GRPCServerName)))
+	} else {
+		logger.Warn("mutual TLS isn't configured, connecting to the gRPC server in plaintext")
+	}
 
-	router := controller.NewController(store)
+	target, dialOpts, err := clientGRPC.Backends(cfg.GRPCAddrs)
+	if err != nil {
+		fatal(logger, "invalid gRPC backends", err)
+	}
+	dialOpts = append(dialOpts, transport,
+		grpc.WithDefaultServiceConfig(clientGRPC.ServiceConfig(
+			clientGRPC.Balancing{
+				Policy:        cfg.GRPCLBPolicy,
+				HealthService: pb.BookService_ServiceDesc.ServiceName,
+			},
+			clientGRPC.RetryPolicy{
+				MaxAttempts:    cfg.GRPCRetryMaxAttempts,
+				InitialBackoff: cfg.GRPCRetryInitialBackoff,
+				MaxBackoff:     cfg.GRPCRetryMaxBackoff,
+			})),
+		grpc.WithChainUnaryInterceptor(
+			clientGRPC.Tracing(),
+			clientGRPC.Logging(logger),
+			clientGRPC.Deadline(func() time.Duration { return time.Duration(grpcTimeout.Load()) }),
+			clientGRPC.CircuitBreaker(clientGRPC.NewBreaker(cfg.GRPCBreakerFailures, cfg.GRPCBreakerCooldown, clientGRPC.WithBreakerLogger(logger))),
+			clientGRPC.ForwardCredentials(),
+			clientGRPC.ForwardClientIP(),
+		))
+	conn, err := grpc.Dial(target, dialOpts...)
+	if err != nil {
+		fatal(logger, "did not connect to grpc", err)
+	}
+
+	checker := health.NewChecker(2 * time.Second)
+	checker.Add("grpc", clientGRPC.HealthCheck(healthpb.NewHealthClient(conn), pb.BookService_ServiceDesc.ServiceName))
+
+	reg := metrics.NewRegistry()
+	var store storage.DB = clientGRPC.New(pb.NewBookServiceClient(conn))
+	if cfg.BookCacheSize > 0 {
+		store = cache.New(store, cache.Config{
+			Size:        cfg.BookCacheSize,
+			TTL:         cfg.BookCacheTTL,
+			NegativeTTL: cfg.BookCacheNegativeTTL,
+		}, cache.WithObserver(metrics.NewCache(reg).Observe), cache.WithLogger(logger))
+	}
+	reloader := config.NewReloader(os.Args[1:], cfg, apply, metrics.NewReloads(reg).Observe)
+	go reloader.Watch(ctx, 5*time.Second, func(cfg *config.Config) []string {
+		return []string{src.File, cfg.RateLimitFile}
+	})
+
+	opts := []controller.Option{
+		controller.WithTracing(),
+		controller.WithLogger(logger),
+		controller.WithTrustedProxies(cfg.TrustedProxies),
+		controller.WithHealth(checker),
+		controller.WithCORS(cors),
+		controller.WithRateLimiter(limiter),
+		controller.WithMetrics(metrics.NewHTTP(reg)),
+		controller.WithCaching(controller.CachePolicy{List: cfg.CacheControlList, Book: cfg.CacheControlBook}),
+	}
+	if cfg.LegacySunset != "" {
+		// Validated by Load.
+		sunset, _ := time.Parse(time.DateOnly, cfg.LegacySunset)
+		opts = append(opts, controller.WithSunset(sunset))
+	}
+	if cfg.AuthDisabled {
+		logger.Warn("authentication is disabled, the API is open to anyone")
+	} else {
+		verifier, err := auth.NewVerifier(auth.Config{
+			HMACSecret:     []byte(cfg.JWTSecret),
+			PublicKeyFiles: cfg.JWTPublicKeys,
+			JWKSFile:       cfg.JWKSFile,
+			Audience:       cfg.JWTAudience,
+			Issuer:         cfg.JWTIssuer,
+			Leeway:         30 * time.Second,
+		})
+		if err != nil {
+			fatal(logger, "couldn't set up authentication (set AUTH_DISABLED=true to run without it)", err)
+		}
+		opts = append(opts, controller.WithVerifier(verifier))
+
+		policy := rbac.DefaultPolicy()
+		if cfg.RBACPolicyFile != "" {
+			if policy, err = rbac.LoadPolicy(cfg.RBACPolicyFile); err != nil {
+				fatal(logger, "couldn't load RBAC policy", err)
+			}
+		}
+		enforcer := rbac.NewEnforcer(policy)
+		if cfg.RBACPolicyFile != "" {
+			go enforcer.Watch(ctx, cfg.RBACPolicyFile, 5*time.Second)
+		}
+		opts = append(opts, controller.WithEnforcer(enforcer))
+		opts = append(opts, controller.WithAPIKeys(clientGRPC.NewAPIKeys(pb.NewAPIKeyServiceClient(conn))))
+	}
+
+	router := controller.NewController(store, opts...)
 
 	r := router.Routes()
 
 	srv := http.Server{
-		Addr:    cfg.HTTPPort,
+		Addr:    cfg.HTTPAddr,
 		Handler: r,
 	}
 
-	c := make(chan os.Signal, 1)
-	defer close(c)
-	signal.Notify(c, os.Interrupt)
+	go func() {
+		logger.Info("HTTP server started", "addr", cfg.HTTPAddr)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			fatal(logger, "failed to serve", err)
+		}
+	}()
+
+	// Metrics are kept off the API, they're only reachable where
+	// METRICS_ADDR is.
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(reg))
+	metricsSrv := &http.Server{Addr: cfg.MetricsAddr, Handler: mux}
 
 	go func() {
-		<-c
-		srv.Shutdown(context.Background())
+		logger.Info("metrics served", "addr", cfg.MetricsAddr)
+		if err := metricsSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed to serve metrics", "error", err)
+		}
 	}()
 
-	log.Printf("HTTP server started on port: %v\n", cfg.HTTPPort)
+	<-ctx.Done()
+	stop()
+	cfg = reloader.Current()
+	logger.Info("shutting down", "delay", cfg.ShutdownDelay, "timeout", cfg.ShutdownTimeout)
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Printf("failed to serve:+%v\n", err)
+	// Readiness flips first, load balancers stop sending requests during
+	// the delay while the ones in flight are served.
+	checker.Drain()
+	time.Sleep(cfg.ShutdownDelay)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		logger.Warn("requests still running after the drain timeout, closing them", "error", err)
+		_ = srv.Close()
+	}
+
+	if err := metricsSrv.Shutdown(drainCtx); err != nil {
+		logger.Warn("couldn't stop the metrics server", "error", err)
 	}
+	if err := conn.Close(); err != nil {
+		logger.Warn("couldn't close the gRPC connection", "error", err)
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		logger.Warn("couldn't flush traces", "error", err)
+	}
+
+	logger.Info("stopped")
+}
+
+// fatal logs err and exits, slog has no fatal level.
+func fatal(l *slog.Logger, msg string, err error) {
+	l.Error(msg, "error", err)
+	os.Exit(1)
 }
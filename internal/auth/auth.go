@@ -0,0 +1,226 @@
+// Package auth verifies the bearer tokens presented to the API.
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Scopes granted by tokens to the book endpoints.
+const (
+	ScopeRead  = "books:read"
+	ScopeWrite = "books:write"
+	ScopeAdmin = "books:admin"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, expired, not
+// meant for this service or signed with an unknown key.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are the JWT claims the service understands.
+type Claims struct {
+	jwt.RegisteredClaims
+	Scope string   `json:"scope,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Scopes returns the space separated scope claim as a list.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// HasScope reports whether the token grants scope.
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Config describes where verification keys come from and which tokens are
+// accepted. At least one key source must be set.
+type Config struct {
+	// HMACSecret verifies HS256 tokens.
+	HMACSecret []byte
+	// PublicKeyFiles are PEM encoded RSA (RS256) or Ed25519 (EdDSA) keys.
+	PublicKeyFiles []string
+	// JWKSFile is a local JSON Web Key Set.
+	JWKSFile string
+
+	Audience string
+	Issuer   string
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+}
+
+// Verifier checks signatures and claims of bearer tokens.
+type Verifier struct {
+	keys    []key
+	methods []string
+	options []jwt.ParserOption
+}
+
+type key struct {
+	id     string
+	method string
+	value  interface{}
+}
+
+// NewVerifier loads the keys described by cfg.
+func NewVerifier(cfg Config) (*Verifier, error) {
+	v := &Verifier{}
+
+	if len(cfg.HMACSecret) > 0 {
+		v.keys = append(v.keys, key{method: jwt.SigningMethodHS256.Alg(), value: cfg.HMACSecret})
+	}
+
+	for _, path := range cfg.PublicKeyFiles {
+		k, err := readPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = append(v.keys, k)
+	}
+
+	if cfg.JWKSFile != "" {
+		keys, err := readJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = append(v.keys, keys...)
+	}
+
+	if len(v.keys) == 0 {
+		return nil, errors.New("no token verification keys configured")
+	}
+
+	seen := map[string]bool{}
+	for _, k := range v.keys {
+		if !seen[k.method] {
+			seen[k.method] = true
+			v.methods = append(v.methods, k.method)
+		}
+	}
+
+	v.options = []jwt.ParserOption{
+		jwt.WithValidMethods(v.methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Audience != "" {
+		v.options = append(v.options, jwt.WithAudience(cfg.Audience))
+	}
+	if cfg.Issuer != "" {
+		v.options = append(v.options, jwt.WithIssuer(cfg.Issuer))
+	}
+
+	return v, nil
+}
+
+// Verify parses token and returns its claims if the signature, exp, nbf,
+// aud and iss are all valid.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	claims := &Claims{}
+
+	_, err := jwt.ParseWithClaims(token, claims, v.keyFunc, v.options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
+
+// keyFunc offers every key matching the token's algorithm, narrowed down to
+// a single one when the token names its key id.
+func (v *Verifier) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	var set jwt.VerificationKeySet
+	for _, k := range v.keys {
+		if k.method != t.Method.Alg() || (kid != "" && k.id != "" && k.id != kid) {
+			continue
+		}
+		set.Keys = append(set.Keys, k.value)
+	}
+
+	if len(set.Keys) == 0 {
+		return nil, errors.New("no key for token")
+	}
+	return set, nil
+}
+
+func readPublicKey(path string) (key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return key{}, fmt.Errorf("couldn't read public key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return key{}, fmt.Errorf("couldn't decode public key %s: no PEM data", path)
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return key{}, fmt.Errorf("couldn't parse public key %s: %w", path, err)
+	}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return key{method: jwt.SigningMethodRS256.Alg(), value: k}, nil
+	case ed25519.PublicKey:
+		return key{method: jwt.SigningMethodEdDSA.Alg(), value: k}, nil
+	default:
+		return key{}, fmt.Errorf("unsupported public key type %T in %s", pub, path)
+	}
+}
+
+type tokenKey struct{}
+
+// WithToken returns a copy of ctx carrying the caller's raw bearer token, so
+// it can be forwarded to the storage backend.
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// TokenFromContext returns the bearer token stored by WithToken.
+func TokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(tokenKey{}).(string)
+	return token, ok && token != ""
+}
+
+// BearerToken extracts the token of an "Authorization: Bearer <token>"
+// header value.
+func BearerToken(header string) (string, bool) {
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
+
+type claimsKey struct{}
+
+// WithClaims returns a copy of ctx carrying the claims of the authenticated
+// caller.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by WithClaims.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifier_Verify(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	pemFile := filepath.Join(dir, "rsa.pem")
+	require.NoError(t, os.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	jwksFile := filepath.Join(dir, "jwks.json")
+	require.NoError(t, os.WriteFile(jwksFile, []byte(`{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"ed","x":"`+
+		base64.RawURLEncoding.EncodeToString(edPub)+`"}]}`), 0o600))
+
+	v, err := NewVerifier(Config{
+		HMACSecret:     []byte("secret"),
+		PublicKeyFiles: []string{pemFile},
+		JWKSFile:       jwksFile,
+		Audience:       "books",
+		Issuer:         "issuer",
+	})
+	require.NoError(t, err)
+
+	valid := func() Claims {
+		return Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "alice",
+				Audience:  jwt.ClaimStrings{"books"},
+				Issuer:    "issuer",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+			Scope: "books:read books:write",
+		}
+	}
+	sign := func(method jwt.SigningMethod, key interface{}, claims Claims, kid string) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(key)
+		require.NoError(t, err)
+		return s
+	}
+
+	expired := valid()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	notYet := valid()
+	notYet.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	otherAud := valid()
+	otherAud.Audience = jwt.ClaimStrings{"other"}
+	otherIss := valid()
+	otherIss.Issuer = "other"
+	noExp := valid()
+	noExp.ExpiresAt = nil
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "HS256", token: sign(jwt.SigningMethodHS256, []byte("secret"), valid(), "")},
+		{name: "RS256", token: sign(jwt.SigningMethodRS256, rsaKey, valid(), "")},
+		{name: "EdDSA from JWKS", token: sign(jwt.SigningMethodEdDSA, edKey, valid(), "ed")},
+		{name: "Wrong secret", token: sign(jwt.SigningMethodHS256, []byte("other"), valid(), ""), wantErr: true},
+		{name: "Unknown kid", token: sign(jwt.SigningMethodEdDSA, edKey, valid(), "nope"), wantErr: true},
+		{name: "Expired", token: sign(jwt.SigningMethodHS256, []byte("secret"), expired, ""), wantErr: true},
+		{name: "Not valid yet", token: sign(jwt.SigningMethodHS256, []byte("secret"), notYet, ""), wantErr: true},
+		{name: "Other audience", token: sign(jwt.SigningMethodHS256, []byte("secret"), otherAud, ""), wantErr: true},
+		{name: "Other issuer", token: sign(jwt.SigningMethodHS256, []byte("secret"), otherIss, ""), wantErr: true},
+		{name: "No expiry", token: sign(jwt.SigningMethodHS256, []byte("secret"), noExp, ""), wantErr: true},
+		{name: "Garbage", token: "not.a.token", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := v.Verify(tc.token)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidToken)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "alice", claims.Subject)
+			assert.True(t, claims.HasScope(ScopeWrite))
+		})
+	}
+}
+
+func TestNewVerifier_NoKeys(t *testing.T) {
+	_, err := NewVerifier(Config{})
+	assert.Error(t, err)
+}
+
+func TestAPIKey(t *testing.T) {
+	key, err := NewAPIKey()
+	require.NoError(t, err)
+	other, err := NewAPIKey()
+	require.NoError(t, err)
+
+	assert.NotEqual(t, key, other)
+	assert.Equal(t, HashAPIKey(key), HashAPIKey(key))
+	assert.NotEqual(t, HashAPIKey(key), HashAPIKey(other))
+
+	claims := APIKeyClaims("batch", []string{ScopeRead, "role:librarian", ScopeWrite})
+	assert.Equal(t, "batch", claims.Subject)
+	assert.Equal(t, []string{ScopeRead, ScopeWrite}, claims.Scopes())
+	assert.Equal(t, []string{"librarian"}, claims.Roles)
+
+	assert.True(t, ValidScope("role:admin"))
+	assert.False(t, ValidScope("role:"))
+	assert.False(t, ValidScope("books:everything"))
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	// oct
+	K string `json:"k"`
+}
+
+// readJWKS loads the signature keys of a JSON Web Key Set (RFC 7517).
+// Encryption keys and key types other than RSA, Ed25519 and oct are skipped.
+func readJWKS(path string) ([]key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read JWKS: %w", err)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("couldn't parse JWKS %s: %w", path, err)
+	}
+
+	var keys []key
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		k, ok, err := jwk.key()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse key %q of JWKS %s: %w", jwk.Kid, path, err)
+		}
+		if ok {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, nil
+}
+
+func (jwk jsonWebKey) key() (key, bool, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return key{}, false, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return key{}, false, err
+		}
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		return key{id: jwk.Kid, method: jwt.SigningMethodRS256.Alg(), value: pub}, true, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return key{}, false, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return key{}, false, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return key{}, false, fmt.Errorf("bad Ed25519 key size %d", len(x))
+		}
+		return key{id: jwk.Kid, method: jwt.SigningMethodEdDSA.Alg(), value: ed25519.PublicKey(x)}, true, nil
+	case "oct":
+		k, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil {
+			return key{}, false, err
+		}
+		return key{id: jwk.Kid, method: jwt.SigningMethodHS256.Alg(), value: k}, true, nil
+	default:
+		return key{}, false, nil
+	}
+}
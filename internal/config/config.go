@@ -0,0 +1,451 @@
+// Package config loads the settings of both binaries from defaults, a YAML
+// file, environment variables and command-line flags, each source
+// overriding the previous one.
+//
+// Settings are the fields of a struct, described by tags:
+//
+//	HTTPAddr  string `yaml:"http_addr" env:"HTTP_ADDR,HTTPPort" default:":8080" validate:"addr"`
+//	JWTSecret string `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+//
+// The yaml key names the setting in the file, with underscores turned into
+// dashes it's also the flag (--http-addr). The first env name is the
+// canonical one, the others are deprecated aliases reported by Load. An
+// empty variable counts as unset, so the default applies. A secret can be read
+// from the file named by its env name suffixed with _FILE, and is redacted
+// when printed. Settings tagged reload:"true" are applied by a Reloader
+// without a restart. Supported types are string, bool, int, float64,
+// time.Duration and []string, lists are comma-separated outside the file.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FileEnv names the config file when --config isn't given.
+const FileEnv = "CONFIG_FILE"
+
+// redacted replaces the secrets set when printing.
+const redacted = "REDACTED"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+type field struct {
+	value  reflect.Value
+	key    string
+	flag   string
+	env    []string
+	def    string
+	secret bool
+	reload bool
+	check  string
+}
+
+// Source tells where Load found the config.
+type Source struct {
+	// File is the config file, empty without one.
+	File string
+	// PrintOnly is set by --print-config, the config is to be printed
+	// rather than run.
+	PrintOnly bool
+	// Deprecated lists the deprecated env names the config was read from,
+	// for the program to warn about once it logs.
+	Deprecated []Alias
+}
+
+// Alias is a deprecated env name and the canonical one replacing it.
+type Alias struct {
+	Env, Canonical string
+}
+
+// Load fills cfg, a pointer to a tagged struct, from its defaults, the
+// config file, the environment and args, then validates it. Every invalid
+// setting is reported. name is the program name shown in the usage.
+func Load(cfg interface{}, name string, args []string) (Source, error) {
+	fields, err := fieldsOf(cfg)
+	if err != nil {
+		return Source{}, err
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := fs.String("config", os.Getenv(FileEnv), "YAML config file ($"+FileEnv+")")
+	printCfg := fs.Bool("print-config", false, "print the effective config, secrets redacted, and exit")
+	flags := make([]*flagValue, len(fields))
+	for i, f := range fields {
+		flags[i] = &flagValue{bool: f.value.Kind() == reflect.Bool}
+		fs.Var(flags[i], f.flag, "$"+f.env[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		return Source{}, err
+	}
+	if fs.NArg() > 0 {
+		return Source{}, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	var (
+		errs       []error
+		deprecated []Alias
+	)
+	set := func(f field, source, raw string) {
+		if err := f.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source, err))
+		}
+	}
+
+	for _, f := range fields {
+		set(f, "default of "+f.key, f.def)
+	}
+
+	if *file != "" {
+		values, err := readFile(*file)
+		if err != nil {
+			return Source{}, err
+		}
+		for _, f := range fields {
+			if raw, ok := values[f.key]; ok {
+				set(f, *file+": "+f.key, raw)
+				delete(values, f.key)
+			}
+		}
+		for key := range values {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %s", *file, key))
+		}
+	}
+
+	for _, f := range fields {
+		for i, env := range f.env {
+			if raw := os.Getenv(env); raw != "" {
+				set(f, "$"+env, raw)
+				if i > 0 {
+					deprecated = append(deprecated, Alias{Env: env, Canonical: f.env[0]})
+				}
+				break
+			}
+		}
+		if !f.secret {
+			continue
+		}
+		if path := os.Getenv(f.env[0] + "_FILE"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("$%s_FILE: %w", f.env[0], err))
+				continue
+			}
+			set(f, "$"+f.env[0]+"_FILE", strings.TrimRight(string(data), "\r\n"))
+		}
+	}
+
+	for i, f := range fields {
+		if flags[i].set {
+			set(f, "--"+f.flag, flags[i].raw)
+		}
+	}
+
+	for _, f := range fields {
+		if err := f.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.key, err))
+		}
+	}
+
+	return Source{File: *file, PrintOnly: *printCfg, Deprecated: deprecated}, errors.Join(errs...)
+}
+
+// Print writes cfg as a YAML config file with its secrets redacted.
+func Print(w io.Writer, cfg interface{}) error {
+	fields, err := fieldsOf(cfg)
+	if err != nil {
+		return err
+	}
+
+	out := make(yaml.MapSlice, 0, len(fields))
+	for _, f := range fields {
+		var v interface{}
+		switch {
+		case f.secret && !f.value.IsZero():
+			v = redacted
+		case f.value.Type() == durationType:
+			v = time.Duration(f.value.Int()).String()
+		default:
+			v = f.value.Interface()
+		}
+		out = append(out, yaml.MapItem{Key: f.key, Value: v})
+	}
+
+	data, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Changed lists the keys of the settings differing between old and new,
+// two pointers to the same struct, split by whether a Reloader can apply
+// them.
+func Changed(old, new interface{}) (reloadable, restart []string, err error) {
+	before, err := fieldsOf(old)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := fieldsOf(new)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reflect.TypeOf(old) != reflect.TypeOf(new) {
+		return nil, nil, fmt.Errorf("can't compare %T with %T", old, new)
+	}
+
+	for i, f := range before {
+		if reflect.DeepEqual(f.value.Interface(), after[i].value.Interface()) {
+			continue
+		}
+		if f.reload {
+			reloadable = append(reloadable, f.key)
+		} else {
+			restart = append(restart, f.key)
+		}
+	}
+	return reloadable, restart, nil
+}
+
+// copyReloadable copies the reloadable settings of src into dst.
+func copyReloadable(dst, src interface{}) error {
+	to, err := fieldsOf(dst)
+	if err != nil {
+		return err
+	}
+	from, err := fieldsOf(src)
+	if err != nil {
+		return err
+	}
+	for i, f := range to {
+		if f.reload {
+			f.value.Set(from[i].value)
+		}
+	}
+	return nil
+}
+
+func fieldsOf(cfg interface{}) ([]field, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a pointer to a struct, got %T", cfg)
+	}
+	v = v.Elem()
+
+	var fields []field
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		key := sf.Tag.Get("yaml")
+		if key == "" || key == "-" {
+			continue
+		}
+		f := field{
+			value:  v.Field(i),
+			key:    key,
+			flag:   strings.ReplaceAll(key, "_", "-"),
+			env:    strings.Split(sf.Tag.Get("env"), ","),
+			def:    sf.Tag.Get("default"),
+			secret: sf.Tag.Get("secret") == "true",
+			reload: sf.Tag.Get("reload") == "true",
+			check:  sf.Tag.Get("validate"),
+		}
+		if f.env[0] == "" {
+			return nil, fmt.Errorf("setting %s has no env name", key)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// set parses raw into the field, an empty raw resets it.
+func (f field) set(raw string) error {
+	v := f.value
+	if raw == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		if d < 0 {
+			return errors.New("duration can't be negative")
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q isn't a boolean", raw)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q isn't an integer", raw)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q isn't a number", raw)
+		}
+		v.SetFloat(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var list []string
+		for _, s := range strings.Split(raw, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// validate applies the validate tag: addr wants a host:port, target a
+// host:port or a gRPC target such as dns:///host:port, port a port number,
+// positive a value above zero, ratio a value between 0 and 1, date a
+// YYYY-MM-DD date, cidr an IP or a CIDR and oneof=a b one of the listed
+// values. Lists have every item checked. Apart from
+// positive ones, empty settings are left to the code using them.
+func (f field) validate() error {
+	if f.check == "positive" && f.value.IsZero() {
+		return errors.New("must be positive")
+	}
+	if f.check == "" || f.value.IsZero() {
+		return nil
+	}
+	if f.value.Kind() == reflect.Slice {
+		for i := 0; i < f.value.Len(); i++ {
+			if err := (field{value: f.value.Index(i), check: f.check}).validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	check, arg, _ := strings.Cut(f.check, "=")
+	switch check {
+	case "addr":
+		return validAddr(f.value.String())
+	case "target":
+		addr := f.value.String()
+		if _, endpoint, ok := strings.Cut(addr, ":///"); ok {
+			addr = endpoint
+		}
+		return validAddr(addr)
+	case "port":
+		return validPort(f.value.String())
+	case "positive":
+		if f.value.Kind() == reflect.Float64 && f.value.Float() < 0 || f.value.CanInt() && f.value.Int() < 0 {
+			return errors.New("must be positive")
+		}
+		return nil
+	case "ratio":
+		if r := f.value.Float(); r < 0 || r > 1 {
+			return fmt.Errorf("%v isn't between 0 and 1", r)
+		}
+		return nil
+	case "date":
+		if _, err := time.Parse(time.DateOnly, f.value.String()); err != nil {
+			return fmt.Errorf("%q isn't a YYYY-MM-DD date", f.value.String())
+		}
+		return nil
+	case "cidr":
+		v := f.value.String()
+		if _, _, err := net.ParseCIDR(v); err != nil && net.ParseIP(v) == nil {
+			return fmt.Errorf("%q isn't an IP or a CIDR", v)
+		}
+		return nil
+	case "oneof":
+		allowed := strings.Fields(arg)
+		for _, v := range allowed {
+			if f.value.String() == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q isn't one of %s", f.value.String(), strings.Join(allowed, ", "))
+	default:
+		return fmt.Errorf("unknown validation %q", f.check)
+	}
+}
+
+func validAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%q isn't a host:port address", addr)
+	}
+	return validPort(port)
+}
+
+func validPort(port string) error {
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 && port != "0" {
+		return fmt.Errorf("%q isn't a port number", port)
+	}
+	return nil
+}
+
+// readFile reads the YAML config file into raw values, lists are joined
+// with commas like in the environment.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read config: %w", err)
+	}
+
+	var file map[string]interface{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("couldn't parse config %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(file))
+	for key, v := range file {
+		switch v := v.(type) {
+		case nil:
+			values[key] = ""
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// flagValue records a flag as given, it's parsed with the other sources.
+type flagValue struct {
+	raw  string
+	set  bool
+	bool bool
+}
+
+func (v *flagValue) String() string { return v.raw }
+
+func (v *flagValue) Set(raw string) error {
+	v.raw, v.set = raw, true
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool { return v.bool }
@@ -0,0 +1,388 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+
+	"gin_training/internal/ratelimit"
+)
+
+type testConfig struct {
+	Addr     string        `yaml:"addr" env:"TEST_ADDR,TestPort" default:":8080" validate:"addr"`
+	Port     string        `yaml:"port" env:"TEST_PORT" validate:"port"`
+	Debug    bool          `yaml:"debug" env:"TEST_DEBUG"`
+	Retries  int           `yaml:"retries" env:"TEST_RETRIES" default:"3"`
+	Ratio    float64       `yaml:"ratio" env:"TEST_RATIO" validate:"ratio"`
+	Timeout  time.Duration `yaml:"timeout" env:"TEST_TIMEOUT" default:"30s" validate:"positive"`
+	Clients  []string      `yaml:"clients" env:"TEST_CLIENTS"`
+	Password string        `yaml:"password" env:"TEST_PASSWORD" secret:"true"`
+	Level    string        `yaml:"level" env:"TEST_LEVEL" reload:"true"`
+	Backends []string      `yaml:"backends" env:"TEST_BACKENDS" validate:"target"`
+	Policy   string        `yaml:"policy" env:"TEST_POLICY" validate:"oneof=first random"`
+	Sunset   string        `yaml:"sunset" env:"TEST_SUNSET" validate:"date"`
+	Limits   string        `yaml:"limits" env:"TEST_LIMITS" reload:"true"`
+	Proxies  []string      `yaml:"proxies" env:"TEST_PROXIES" validate:"cidr"`
+	internal string
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+addr: "file:1"
+retries: 5
+ratio: 0.5
+clients: [gateway, cli]
+`)
+	secret := writeFile(t, "password", "s3cret\n")
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		args       []string
+		want       testConfig
+		printOnly  bool
+		deprecated []Alias
+		wantErr    []string
+	}{
+		{
+			name: "Defaults",
+			want: testConfig{Addr: ":8080", Retries: 3, Timeout: 30 * time.Second},
+		},
+		{
+			name: "File over defaults",
+			args: []string{"--config", file},
+			want: testConfig{Addr: "file:1", Retries: 5, Ratio: 0.5, Timeout: 30 * time.Second, Clients: []string{"gateway", "cli"}},
+		},
+		{
+			name: "Env over file",
+			env:  map[string]string{"CONFIG_FILE": file, "TEST_ADDR": "env:2", "TEST_CLIENTS": "a, b,", "TEST_DEBUG": "true"},
+			want: testConfig{Addr: "env:2", Debug: true, Retries: 5, Ratio: 0.5, Timeout: 30 * time.Second, Clients: []string{"a", "b"}},
+		},
+		{
+			name: "Deprecated env name",
+			env:  map[string]string{"TestPort": "old:3"},
+			want: testConfig{Addr: "old:3", Retries: 3, Timeout: 30 * time.Second},
+
+			deprecated: []Alias{{Env: "TestPort", Canonical: "TEST_ADDR"}},
+		},
+		{
+			name: "Canonical env name wins over the deprecated one",
+			env:  map[string]string{"TestPort": "old:3", "TEST_ADDR": "env:2"},
+			want: testConfig{Addr: "env:2", Retries: 3, Timeout: 30 * time.Second},
+		},
+		{
+			name: "Empty env values are unset",
+			env:  map[string]string{"TEST_ADDR": "", "TestPort": "", "TEST_TIMEOUT": "", "TEST_PASSWORD_FILE": ""},
+			want: testConfig{Addr: ":8080", Retries: 3, Timeout: 30 * time.Second},
+		},
+		{
+			name: "Empty canonical env name falls back to the deprecated one",
+			env:  map[string]string{"TEST_ADDR": "", "TestPort": "old:3"},
+			want: testConfig{Addr: "old:3", Retries: 3, Timeout: 30 * time.Second},
+
+			deprecated: []Alias{{Env: "TestPort", Canonical: "TEST_ADDR"}},
+		},
+		{
+			name: "Flags over env",
+			env:  map[string]string{"TEST_ADDR": "env:2", "TEST_TIMEOUT": "1m"},
+			args: []string{"--addr", "flag:4", "--debug", "--timeout=5s", "--print-config"},
+			want: testConfig{Addr: "flag:4", Debug: true, Retries: 3, Timeout: 5 * time.Second},
+
+			printOnly: true,
+		},
+		{
+			name: "Secret from a file",
+			env:  map[string]string{"TEST_PASSWORD_FILE": secret},
+			want: testConfig{Addr: ":8080", Retries: 3, Timeout: 30 * time.Second, Password: "s3cret"},
+		},
+		{
+			name: "Every invalid setting is reported",
+			env:  map[string]string{"TEST_RETRIES": "many", "TEST_TIMEOUT": "-1s", "TEST_PORT": "99999"},
+			args: []string{"--addr", "nope", "--ratio", "2"},
+			wantErr: []string{
+				`$TEST_RETRIES: "many" isn't an integer`,
+				"$TEST_TIMEOUT: duration can't be negative",
+				`addr: "nope" isn't a host:port address`,
+				`port: "99999" isn't a port number`,
+				"ratio: 2 isn't between 0 and 1",
+			},
+		},
+		{
+			name: "Targets and choices",
+			args: []string{"--backends", "a:1,dns:///b:2", "--policy", "random", "--sunset", "2027-04-19", "--proxies", "10.0.0.0/8,::1"},
+			want: testConfig{
+				Addr: ":8080", Retries: 3, Timeout: 30 * time.Second, Backends: []string{"a:1", "dns:///b:2"}, Policy: "random",
+				Sunset: "2027-04-19", Proxies: []string{"10.0.0.0/8", "::1"},
+			},
+		},
+		{
+			name: "Invalid target and choice",
+			args: []string{"--backends", "a:1,dns:///b", "--policy", "last", "--sunset", "19/04/2027", "--proxies", "10.0.0.0/33"},
+			wantErr: []string{
+				`backends: "b" isn't a host:port address`,
+				`policy: "last" isn't one of first, random`,
+				`sunset: "19/04/2027" isn't a YYYY-MM-DD date`,
+				`proxies: "10.0.0.0/33" isn't an IP or a CIDR`,
+			},
+		},
+		{
+			name:    "Positive setting left empty",
+			args:    []string{"--timeout", "0s"},
+			wantErr: []string{"timeout: must be positive"},
+		},
+		{
+			name:    "Missing secret file",
+			env:     map[string]string{"TEST_PASSWORD_FILE": filepath.Join(t.TempDir(), "missing")},
+			wantErr: []string{"$TEST_PASSWORD_FILE"},
+		},
+		{
+			name:    "Unknown setting in the file",
+			args:    []string{"--config", writeFile(t, "typo.yaml", "adr: x:1\n")},
+			wantErr: []string{"unknown setting adr"},
+		},
+		{
+			name:    "Unknown flag",
+			args:    []string{"--adr", "x:1"},
+			wantErr: []string{"flag provided but not defined: -adr"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, env := range []string{"CONFIG_FILE", "TEST_ADDR", "TestPort", "TEST_CLIENTS", "TEST_DEBUG", "TEST_TIMEOUT"} {
+				t.Setenv(env, "")
+				os.Unsetenv(env)
+			}
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			var cfg testConfig
+			src, err := Load(&cfg, "test", tc.args)
+			if tc.wantErr != nil {
+				assert.Error(t, err)
+				for _, want := range tc.wantErr {
+					assert.Contains(t, err.Error(), want)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, cfg)
+			assert.Equal(t, tc.printOnly, src.PrintOnly)
+			assert.Equal(t, tc.deprecated, src.Deprecated)
+		})
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg := testConfig{Addr: ":8080", Timeout: 30 * time.Second, Clients: []string{"gateway"}, Password: "s3cret"}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Print(&buf, &cfg))
+	assert.NotContains(t, buf.String(), "s3cret")
+	assert.Contains(t, buf.String(), "password: REDACTED")
+	assert.Contains(t, buf.String(), "timeout: 30s")
+
+	// The printed config is a valid config file.
+	var printed map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal(buf.Bytes(), &printed))
+
+	cfg.Password = ""
+	file := writeFile(t, "printed.yaml", buf.String())
+	var loaded testConfig
+	_, err := Load(&loaded, "test", []string{"--config", file, "--password", ""})
+	assert.NoError(t, err)
+	assert.Equal(t, cfg, loaded)
+}
+
+func TestChanged(t *testing.T) {
+	old := testConfig{Addr: ":8080", Level: "info", Clients: []string{"a"}}
+
+	tests := []struct {
+		name           string
+		new            testConfig
+		wantReloadable []string
+		wantRestart    []string
+	}{
+		{
+			name: "Unchanged",
+			new:  testConfig{Addr: ":8080", Level: "info", Clients: []string{"a"}},
+		},
+		{
+			name:           "Reloadable setting",
+			new:            testConfig{Addr: ":8080", Level: "debug", Clients: []string{"a"}},
+			wantReloadable: []string{"level"},
+		},
+		{
+			name:           "Both kinds",
+			new:            testConfig{Addr: ":9090", Level: "debug", Clients: []string{"a", "b"}},
+			wantReloadable: []string{"level"},
+			wantRestart:    []string{"addr", "clients"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reloadable, restart, err := Changed(&old, &tc.new)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantReloadable, reloadable)
+			assert.Equal(t, tc.wantRestart, restart)
+		})
+	}
+}
+
+func TestReloader_Reload(t *testing.T) {
+	errInvalid := errors.New("invalid level")
+
+	tests := []struct {
+		name      string
+		loaded    testConfig
+		loadErr   error
+		applyErr  error
+		want      testConfig
+		wantApply bool
+		wantErr   error
+	}{
+		{
+			name:      "Reloadable setting applied",
+			loaded:    testConfig{Addr: ":8080", Level: "debug"},
+			want:      testConfig{Addr: ":8080", Level: "debug"},
+			wantApply: true,
+		},
+		{
+			name:      "Other settings wait for a restart",
+			loaded:    testConfig{Addr: ":9090", Level: "debug"},
+			want:      testConfig{Addr: ":8080", Level: "debug"},
+			wantApply: true,
+		},
+		{
+			// The files named by the settings may have changed.
+			name:      "Unchanged settings applied again",
+			loaded:    testConfig{Addr: ":9090", Level: "info"},
+			want:      testConfig{Addr: ":8080", Level: "info"},
+			wantApply: true,
+		},
+		{
+			name:    "Config can't be read",
+			loadErr: errInvalid,
+			want:    testConfig{Addr: ":8080", Level: "info"},
+			wantErr: errInvalid,
+		},
+		{
+			name:      "Config can't be applied",
+			loaded:    testConfig{Addr: ":8080", Level: "loud"},
+			applyErr:  errInvalid,
+			want:      testConfig{Addr: ":8080", Level: "info"},
+			wantApply: true,
+			wantErr:   errInvalid,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			load := func() (*testConfig, error) {
+				loaded := tc.loaded
+				return &loaded, tc.loadErr
+			}
+			var applied *testConfig
+			apply := func(cfg *testConfig) error {
+				applied = cfg
+				return tc.applyErr
+			}
+			var observed []error
+			observe := func(err error) {
+				observed = append(observed, err)
+			}
+
+			r := NewReloader(&testConfig{Addr: ":8080", Level: "info"}, load, apply, observe)
+			err := r.Reload()
+
+			assert.ErrorIs(t, err, tc.wantErr)
+			if tc.wantErr == nil {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, []error{err}, observed)
+			assert.Equal(t, tc.wantApply, applied != nil)
+			if applied != nil {
+				assert.Equal(t, ":8080", applied.Addr)
+			}
+			assert.Equal(t, tc.want, *r.Current())
+		})
+	}
+}
+
+func TestReloader_Watch(t *testing.T) {
+	dir := t.TempDir()
+	configFile := writeFile(t, "config.yaml", "limits: first.yaml")
+	first := filepath.Join(dir, "first.yaml")
+	second := filepath.Join(dir, "second.yaml")
+	writeLimits := func(path string, burst int) {
+		data := fmt.Sprintf("default: {rate: 0.001, burst: %d}\n", burst)
+		assert.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	}
+	writeLimits(first, 1)
+	writeLimits(second, 3)
+
+	// The config file names the limits file, read when applied.
+	var limitsFile atomic.Value
+	limitsFile.Store(first)
+	load := func() (*testConfig, error) {
+		return &testConfig{Limits: limitsFile.Load().(string)}, nil
+	}
+	limiter := ratelimit.New(ratelimit.DefaultConfig())
+	apply := func(cfg *testConfig) error {
+		limits, err := ratelimit.LoadConfig(cfg.Limits)
+		if err != nil {
+			return err
+		}
+		limiter.SetConfig(limits)
+		return nil
+	}
+	assert.NoError(t, apply(&testConfig{Limits: first}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewReloader(&testConfig{Limits: first}, load, apply, nil)
+	go r.Watch(ctx, 10*time.Millisecond, func(cfg *testConfig) []string {
+		return []string{configFile, cfg.Limits}
+	})
+
+	// A fresh client gets the burst of the limits in force.
+	client := 0
+	burst := func() int {
+		client++
+		n := 0
+		for limiter.Allow("GET /books", fmt.Sprint(client)).Allowed {
+			n++
+		}
+		return n
+	}
+	assert.Equal(t, 1, burst())
+
+	// Edited in place, the same path.
+	time.Sleep(20 * time.Millisecond)
+	writeLimits(first, 2)
+	assert.Eventually(t, func() bool { return burst() == 2 }, time.Second, 10*time.Millisecond)
+
+	// Moved to another file, which is then watched.
+	limitsFile.Store(second)
+	assert.NoError(t, os.WriteFile(configFile, []byte("limits: second.yaml\n"), 0o600))
+	assert.Eventually(t, func() bool { return burst() == 3 }, time.Second, 10*time.Millisecond)
+
+	time.Sleep(20 * time.Millisecond)
+	writeLimits(second, 4)
+	assert.Eventually(t, func() bool { return burst() == 4 }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gin_training/internal/watch"
+)
+
+// Reloader reads a config of type T again when asked and applies its
+// reloadable settings to the running process. Changes to the other ones are
+// logged and wait for a restart.
+type Reloader[T any] struct {
+	load    func() (*T, error)
+	apply   func(*T) error
+	observe func(error)
+
+	mu      sync.Mutex
+	current atomic.Pointer[T]
+}
+
+// NewReloader returns a Reloader starting from cfg. load reads the config
+// the way the process was started, apply validates the reloadable settings
+// and swaps them in, leaving the running ones untouched when it fails.
+// observe, if not nil, is told the outcome of every reload.
+func NewReloader[T any](cfg *T, load func() (*T, error), apply func(*T) error, observe func(error)) *Reloader[T] {
+	r := &Reloader[T]{load: load, apply: apply, observe: observe}
+	r.current.Store(cfg)
+	return r
+}
+
+// Current returns the config applied last. Only its reloadable settings
+// may differ from the ones the process runs with.
+func (r *Reloader[T]) Current() *T {
+	return r.current.Load()
+}
+
+// Reload reads and applies the config, the running one is kept on error.
+// The reloadable settings are applied even when unchanged, the files they
+// name may have changed.
+func (r *Reloader[T]) Reload() error {
+	err := r.reload()
+	if r.observe != nil {
+		r.observe(err)
+	}
+	return err
+}
+
+func (r *Reloader[T]) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.load()
+	if err != nil {
+		return fmt.Errorf("couldn't read config: %w", err)
+	}
+
+	old := r.current.Load()
+	reloadable, restart, err := Changed(old, cfg)
+	if err != nil {
+		return err
+	}
+	if len(restart) > 0 {
+		slog.Warn("config changes need a restart to apply", "settings", restart)
+	}
+
+	next := *old
+	if err := copyReloadable(&next, cfg); err != nil {
+		return err
+	}
+	if err := r.apply(&next); err != nil {
+		return fmt.Errorf("couldn't apply config: %w", err)
+	}
+	r.current.Store(&next)
+	slog.Info("reloaded config", "settings", reloadable)
+	return nil
+}
+
+// Watch reloads the config whenever one of the files named by files
+// changes or the process receives SIGHUP, until ctx is done. files is
+// asked again after every reload, so a setting pointing to another file
+// moves the watch to it. Empty paths are skipped.
+func (r *Reloader[T]) Watch(ctx context.Context, interval time.Duration, files func(*T) []string) {
+	// Changes are handed to the loop below, which reloads one at a time and
+	// owns the watches.
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	watches := map[string]context.CancelFunc{}
+	follow := func() {
+		want := map[string]bool{}
+		for _, path := range files(r.Current()) {
+			if path != "" {
+				want[path] = true
+			}
+		}
+		for path, stop := range watches {
+			if !want[path] {
+				stop()
+				delete(watches, path)
+			}
+		}
+		for path := range want {
+			if _, ok := watches[path]; !ok {
+				wctx, stop := context.WithCancel(ctx)
+				watches[path] = stop
+				go watch.File(wctx, path, interval, notify)
+			}
+		}
+	}
+	follow()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-changed:
+		}
+		if err := r.Reload(); err != nil {
+			slog.Warn("keeping the current config", "error", err)
+		}
+		follow()
+	}
+}
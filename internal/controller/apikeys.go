@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"gin_training/internal/model"
+)
+
+// POST /admin/api-keys
+// Create an API key, the plaintext key is only part of this response
+func (cr *Controller) CreateAPIKey(c *gin.Context) {
+	var input model.CreateAPIKeyInput
+
+	if err := bindBody(c, &input); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	key, err := cr.keys.CreateAPIKey(c.Request.Context(), input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusCreated, key)
+}
+
+// GET /admin/api-keys
+// List every API key, revoked ones included
+func (cr *Controller) ListAPIKeys(c *gin.Context) {
+	keys, err := cr.keys.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, keys)
+}
+
+// DELETE /admin/api-keys/:id
+// Revoke an API key, it's kept for auditing but no longer accepted
+func (cr *Controller) RevokeAPIKey(c *gin.Context) {
+	id := c.Param("id")
+
+	if _, err := uuid.Parse(id); err != nil {
+		_ = c.Error(&fieldsError{err: errInvalidID, fields: []FieldError{{Field: "id", Detail: "must be a UUID"}}})
+		return
+	}
+
+	if err := cr.keys.RevokeAPIKey(c.Request.Context(), id); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	respond(c, http.StatusOK, "API key has been revoked")
+}
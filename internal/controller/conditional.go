@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gin_training/internal/model"
+)
+
+// CachePolicy holds the Cache-Control values of the book reads, an empty
+// one sends no Cache-Control.
+type CachePolicy struct {
+	// List applies to GET /books.
+	List string
+	// Book applies to GET /books/:id.
+	Book string
+}
+
+// validators identify a representation of a book or of the catalog, zero
+// ones when its revision is unknown.
+type validators struct {
+	etag     string
+	modified time.Time
+}
+
+// newValidators derives the validators of the representation of rev asked
+// for by c. The ETag is strong: it changes with the revision and with the
+// API version, negotiated format and fields, which change the bytes sent.
+func newValidators(c *gin.Context, rev model.Revision, mask model.ReadMask) validators {
+	if rev.Version == 0 {
+		return validators{}
+	}
+	variant := fnv.New32a()
+	fmt.Fprintf(variant, "%s;%s;%s", versionOf(c).prefix, c.GetString(formatKey), strings.Join(mask.Fields(), ","))
+
+	return validators{
+		etag:     fmt.Sprintf(`"%d-%08x"`, rev.Version, variant.Sum32()),
+		modified: rev.UpdatedAt,
+	}
+}
+
+// conditional reports whether the request carries validators to check.
+func conditional(r *http.Request) bool {
+	return r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+}
+
+// notModified evaluates the conditional headers of r against v, like
+// RFC 9110: If-Modified-Since is ignored when If-None-Match is sent.
+func notModified(r *http.Request, v validators) bool {
+	if v.etag == "" {
+		return false
+	}
+	if inm := r.Header.Values("If-None-Match"); len(inm) > 0 {
+		for _, tag := range strings.Split(strings.Join(inm, ","), ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == v.etag {
+				return true
+			}
+		}
+		return false
+	}
+	if v.modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// Last-Modified only has a precision of seconds.
+	return !v.modified.Truncate(time.Second).After(since)
+}
+
+// setValidators writes the caching headers of a read, on 200 and 304
+// responses alike.
+func setValidators(c *gin.Context, cacheControl string, v validators) {
+	h := c.Writer.Header()
+	// The representation depends on the Accept header.
+	h.Add("Vary", "Accept")
+	if cacheControl != "" {
+		h.Set("Cache-Control", cacheControl)
+	}
+	if v.etag != "" {
+		h.Set("ETag", v.etag)
+	}
+	if !v.modified.IsZero() {
+		h.Set("Last-Modified", v.modified.UTC().Format(http.TimeFormat))
+	}
+}
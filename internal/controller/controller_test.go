@@ -1,18 +1,41 @@
 package controller
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
-
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
+
+	"gin_training/internal/auth"
+	"gin_training/internal/health"
+	"gin_training/internal/logging"
+	"gin_training/internal/metrics"
 	"gin_training/internal/model"
+	pb "gin_training/internal/proto"
+	"gin_training/internal/ratelimit"
+	"gin_training/internal/rbac"
+	"gin_training/internal/storage/cache"
 	storage "gin_training/internal/storage/postgreSQL"
 	"gin_training/internal/storage/postgreSQL/mocks"
 )
@@ -22,9 +45,9 @@ func TestController_FindBook(t *testing.T) {
 
 	uid, _ := uuid.Parse("00000000-0000-0000-0000-000000000000")
 
-	b := model.Book{uid, "title", "author"}
+	b := model.Book{ID: uid, Title: "title", Author: "author"}
 
-	db.On("GetBook", "00000000-0000-0000-0000-000000000000").Return(b, nil)
+	db.On("GetBook", mock.Anything, "00000000-0000-0000-0000-000000000000", model.ReadMask(nil)).Return(b, nil)
 
 	tests := []struct {
 		name       string
@@ -77,9 +100,9 @@ func TestController_CreateBook(t *testing.T) {
 
 	uid, _ := uuid.Parse("00000000-0000-0000-0000-000000000000")
 
-	b := model.Book{uid, "title", "author"}
+	b := model.Book{ID: uid, Title: "title", Author: "author"}
 
-	db.On("Create", mock.Anything).Return(b, nil)
+	db.On("Create", mock.Anything, mock.Anything).Return(b, nil)
 
 	tests := []struct {
 		name       string
@@ -135,10 +158,10 @@ func TestController_AllBooks(t *testing.T) {
 	uid, _ := uuid.Parse("00000000-0000-0000-0000-000000000000")
 
 	b := []model.Book{{
-		uid, "title", "author"},
+		ID: uid, Title: "title", Author: "author"},
 	}
 
-	db.On("FindAll").Return(b, nil)
+	db.On("FindAll", mock.Anything, model.ReadMask(nil)).Return(b, model.Revision{}, nil)
 
 	tests := []struct {
 		name       string
@@ -187,9 +210,9 @@ func TestController_UpdateBook(t *testing.T) {
 
 	uid, _ := uuid.Parse("00000000-0000-0000-0000-000000000000")
 
-	b := model.Book{uid, "title", "author"}
+	b := model.Book{ID: uid, Title: "title", Author: "author"}
 
-	db.On("UpdateBook", mock.Anything, mock.Anything).Return(b, nil)
+	db.On("UpdateBook", mock.Anything, mock.Anything, mock.Anything).Return(b, nil)
 
 	tests := []struct {
 		name       string
@@ -245,9 +268,9 @@ func TestController_DeleteBook(t *testing.T) {
 
 	uid, _ := uuid.Parse("00000000-0000-0000-0000-000000000000")
 
-	b := model.Book{uid, "title", "author"}
+	b := model.Book{ID: uid, Title: "title", Author: "author"}
 
-	db.On("DeleteBook", "00000000-0000-0000-0000-000000000000").Return(nil)
+	db.On("DeleteBook", mock.Anything, "00000000-0000-0000-0000-000000000000").Return(nil)
 
 	tests := []struct {
 		name       string
@@ -288,3 +311,1290 @@ func TestController_DeleteBook(t *testing.T) {
 		})
 	}
 }
+
+func TestController_Negotiation(t *testing.T) {
+	db := new(mocks.DB)
+
+	uid, _ := uuid.Parse("00000000-0000-0000-0000-000000000000")
+
+	b := model.Book{ID: uid, Title: "title", Author: "author"}
+
+	db.On("GetBook", mock.Anything, "00000000-0000-0000-0000-000000000000", model.ReadMask(nil)).Return(b, nil)
+	db.On("Create", mock.Anything, model.Book{Title: "title", Author: "author"}).Return(b, nil)
+
+	pbBody, _ := proto.Marshal(&pb.BookObj{Title: "title", Author: "author"})
+
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		accept      string
+		contentType string
+		body        string
+		wantStatus  int
+		wantType    string
+		wantBody    string
+	}{
+		{
+			name:       "XML",
+			method:     "GET",
+			url:        "/books/00000000-0000-0000-0000-000000000000",
+			accept:     "application/xml",
+			wantStatus: http.StatusOK,
+			wantType:   "application/xml; charset=utf-8",
+			wantBody:   "<response><data><id>00000000-0000-0000-0000-000000000000</id><title>title</title><author>author</author></data></response>",
+		},
+		{
+			name:       "YAML preferred by quality",
+			method:     "GET",
+			url:        "/books/00000000-0000-0000-0000-000000000000",
+			accept:     "application/json;q=0.5, application/yaml",
+			wantStatus: http.StatusOK,
+			wantType:   "application/yaml; charset=utf-8",
+			wantBody:   "data:\n  id: 00000000-0000-0000-0000-000000000000\n  title: title\n  author: author\n",
+		},
+		{
+			name:       "Type excluded despite a wildcard",
+			method:     "GET",
+			url:        "/books/00000000-0000-0000-0000-000000000000",
+			accept:     "application/json;q=0, */*",
+			wantStatus: http.StatusOK,
+			wantType:   "application/xml; charset=utf-8",
+		},
+		{
+			name:       "Type preferred to a wildcard of equal quality",
+			method:     "GET",
+			url:        "/books/00000000-0000-0000-0000-000000000000",
+			accept:     "*/*, text/csv",
+			wantStatus: http.StatusOK,
+			wantType:   "text/csv; charset=utf-8",
+		},
+		{
+			name:       "Every type excluded",
+			method:     "GET",
+			url:        "/books/00000000-0000-0000-0000-000000000000",
+			accept:     "application/*;q=0, text/*;q=0, */*",
+			wantStatus: http.StatusNotAcceptable,
+		},
+		{
+			name:       "CSV",
+			method:     "GET",
+			url:        "/books/00000000-0000-0000-0000-000000000000",
+			accept:     "text/csv",
+			wantStatus: http.StatusOK,
+			wantType:   "text/csv; charset=utf-8",
+			wantBody:   "id,title,author\n00000000-0000-0000-0000-000000000000,title,author\n",
+		},
+		{
+			name:        "Protobuf request body",
+			method:      "POST",
+			url:         "/create",
+			contentType: "application/x-protobuf",
+			body:        string(pbBody),
+			wantStatus:  http.StatusOK,
+			wantType:    "application/json; charset=utf-8",
+		},
+		{
+			name:       "Not acceptable",
+			method:     "GET",
+			url:        "/books/00000000-0000-0000-0000-000000000000",
+			accept:     "image/png",
+			wantStatus: http.StatusNotAcceptable,
+		},
+		{
+			name:        "Unsupported media type",
+			method:      "POST",
+			url:         "/create",
+			contentType: "text/plain",
+			body:        "title",
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			h := NewController(db)
+
+			rr := httptest.NewRecorder()
+
+			testRouter := h.Routes()
+
+			req, err := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			assert.NoError(t, err)
+			req.Header.Set("Accept", tc.accept)
+			req.Header.Set("Content-Type", tc.contentType)
+
+			testRouter.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+			if tc.wantType != "" {
+				assert.Equal(t, tc.wantType, rr.Header().Get("Content-Type"))
+			}
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestController_NegotiateProtobuf(t *testing.T) {
+	db := new(mocks.DB)
+
+	uid, _ := uuid.Parse("00000000-0000-0000-0000-000000000000")
+
+	db.On("FindAll", mock.Anything, model.ReadMask(nil)).Return([]model.Book{{ID: uid, Title: "title", Author: "author"}}, model.Revision{}, nil)
+
+	gin.SetMode(gin.TestMode)
+	testRouter := NewController(db).Routes()
+
+	rr := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/books", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "application/protobuf")
+
+	testRouter.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var got pb.AllBooks
+	assert.NoError(t, proto.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Len(t, got.Allbooks, 1)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", got.Allbooks[0].Id)
+}
+
+func TestController_Problems(t *testing.T) {
+	db := new(mocks.DB)
+
+	db.On("GetBook", mock.Anything, "00000000-0000-0000-0000-000000000000", model.ReadMask(nil)).
+		Return(model.Book{}, fmt.Errorf("couldn't find a book: %w", storage.ErrNotFound))
+	db.On("DeleteBook", mock.Anything, "00000000-0000-0000-0000-000000000000").
+		Return(fmt.Errorf("couldn't delete a book: %w", storage.ErrInternal))
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+		want       Problem
+	}{
+		{
+			name:       "Not found",
+			method:     "GET",
+			url:        "/books/00000000-0000-0000-0000-000000000000",
+			wantStatus: http.StatusNotFound,
+			want: Problem{
+				Type:      "/problems/not-found",
+				Title:     "Book not found.",
+				Status:    http.StatusNotFound,
+				Detail:    "couldn't find a book: book not found",
+				Instance:  "/books/00000000-0000-0000-0000-000000000000",
+				RequestID: "req-42",
+			},
+		},
+		{
+			name:       "Invalid ID",
+			method:     "GET",
+			url:        "/books/42",
+			wantStatus: http.StatusBadRequest,
+			want: Problem{
+				Type:      "/problems/validation-error",
+				Title:     "Your request parameters didn't validate.",
+				Status:    http.StatusBadRequest,
+				Detail:    "invalid ID",
+				Instance:  "/books/42",
+				RequestID: "req-42",
+				Errors:    []FieldError{{Field: "id", Detail: "must be a UUID"}},
+			},
+		},
+		{
+			name:       "Validation",
+			method:     "POST",
+			url:        "/create",
+			body:       `{"title":"   ","author":"` + strings.Repeat("a", 51) + `"}`,
+			wantStatus: http.StatusBadRequest,
+			want: Problem{
+				Type:      "/problems/validation-error",
+				Title:     "Your request parameters didn't validate.",
+				Status:    http.StatusBadRequest,
+				Instance:  "/create",
+				RequestID: "req-42",
+				Errors: []FieldError{
+					{Field: "title", Detail: "is required"},
+					{Field: "author", Detail: "must be at most 50 characters long"},
+				},
+			},
+		},
+		{
+			name:       "Storage failure",
+			method:     "DELETE",
+			url:        "/books/00000000-0000-0000-0000-000000000000",
+			wantStatus: http.StatusInternalServerError,
+			want: Problem{
+				Type:      "/problems/internal",
+				Title:     "Internal server error.",
+				Status:    http.StatusInternalServerError,
+				Instance:  "/books/00000000-0000-0000-0000-000000000000",
+				RequestID: "req-42",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			testRouter := NewController(db).Routes()
+
+			rr := httptest.NewRecorder()
+
+			req, err := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			assert.NoError(t, err)
+			req.Header.Set("X-Request-ID", "req-42")
+
+			testRouter.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+			assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+
+			var got Problem
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestController_PatchBook(t *testing.T) {
+	uid, _ := uuid.Parse("00000000-0000-0000-0000-000000000000")
+
+	stored := model.Book{ID: uid, Title: "title", Author: "author", Revision: model.Revision{Version: 3}}
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		wantInput   *model.UpdateBookInput
+		updateErr   error
+		wantStatus  int
+	}{
+		{
+			name:        "Merge patch clears author",
+			method:      "PATCH",
+			contentType: "application/merge-patch+json",
+			body:        `{"title":"new","author":null}`,
+			wantInput:   &model.UpdateBookInput{Title: "new", Fields: []string{"author", "title"}},
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "Merge patch can't clear title",
+			method:      "PATCH",
+			contentType: "application/merge-patch+json",
+			body:        `{"title":null}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "JSON patch",
+			method:      "PATCH",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"test","path":"/title","value":"title"},{"op":"move","from":"/author","path":"/title"}]`,
+			wantInput:   &model.UpdateBookInput{Title: "author", Fields: []string{"author", "title"}, IfVersion: 3},
+			wantStatus:  http.StatusOK,
+		},
+		{
+			// The book tested isn't the one the write would apply to.
+			name:        "JSON patch of a book changed meanwhile",
+			method:      "PATCH",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"test","path":"/title","value":"title"},{"op":"remove","path":"/author"}]`,
+			wantInput:   &model.UpdateBookInput{Title: "title", Fields: []string{"author"}, IfVersion: 3},
+			updateErr:   fmt.Errorf("couldn't update book: %w", storage.ErrConflict),
+			wantStatus:  http.StatusConflict,
+		},
+		{
+			name:        "JSON patch test fails",
+			method:      "PATCH",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"test","path":"/title","value":"other"},{"op":"remove","path":"/author"}]`,
+			wantStatus:  http.StatusConflict,
+		},
+		{
+			name:       "Full replacement",
+			method:     "PUT",
+			body:       `{"title":"new","author":"someone"}`,
+			wantInput:  &model.UpdateBookInput{Title: "new", Author: "someone", Fields: []string{"title", "author"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Full replacement needs every field",
+			method:     "PUT",
+			body:       `{"title":"new"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db := new(mocks.DB)
+			// The book patched is read past the caches.
+			db.On("GetBook", mock.MatchedBy(cache.Bypassed), "00000000-0000-0000-0000-000000000000", model.ReadMask(nil)).Return(stored, nil)
+			if tc.wantInput != nil {
+				db.On("UpdateBook", mock.Anything, "00000000-0000-0000-0000-000000000000", *tc.wantInput).Return(stored, tc.updateErr)
+			}
+
+			gin.SetMode(gin.TestMode)
+			testRouter := NewController(db).Routes()
+
+			rr := httptest.NewRecorder()
+
+			req, err := http.NewRequest(tc.method, "/books/00000000-0000-0000-0000-000000000000", strings.NewReader(tc.body))
+			assert.NoError(t, err)
+			req.Header.Set("Content-Type", tc.contentType)
+
+			testRouter.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantStatus, rr.Code, rr.Body.String())
+			if tc.wantInput == nil {
+				db.AssertNotCalled(t, "UpdateBook", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestController_SparseFieldsets(t *testing.T) {
+	db := new(mocks.DB)
+
+	uid, _ := uuid.Parse("00000000-0000-0000-0000-000000000000")
+
+	db.On("FindAll", mock.Anything, model.ReadMask{"title", "id"}).Return([]model.Book{{ID: uid, Title: "title"}}, model.Revision{}, nil)
+	db.On("GetBook", mock.Anything, "00000000-0000-0000-0000-000000000000", model.ReadMask{"author"}).Return(model.Book{Author: "author"}, nil)
+
+	tests := []struct {
+		name       string
+		url        string
+		accept     string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "List",
+			url:        "/books?fields=title,id",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"data":[{"id":"00000000-0000-0000-0000-000000000000","title":"title"}]}`,
+		},
+		{
+			name:       "CSV",
+			url:        "/books?fields=title,id",
+			accept:     "text/csv",
+			wantStatus: http.StatusOK,
+			wantBody:   "id,title\n00000000-0000-0000-0000-000000000000,title\n",
+		},
+		{
+			name:       "XML",
+			url:        "/books/00000000-0000-0000-0000-000000000000?fields=author",
+			accept:     "application/xml",
+			wantStatus: http.StatusOK,
+			wantBody:   "<response><data><author>author</author></data></response>",
+		},
+		{
+			name:       "Unknown field",
+			url:        "/books?fields=isbn",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			testRouter := NewController(db).Routes()
+
+			rr := httptest.NewRecorder()
+
+			req, err := http.NewRequest("GET", tc.url, nil)
+			assert.NoError(t, err)
+			req.Header.Set("Accept", tc.accept)
+
+			testRouter.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestController_Authorize(t *testing.T) {
+	db := new(mocks.DB)
+
+	db.On("FindAll", mock.Anything, model.ReadMask(nil)).Return([]model.Book{}, model.Revision{}, nil)
+	db.On("DeleteBook", mock.Anything, "00000000-0000-0000-0000-000000000000").Return(nil)
+
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: []byte("secret")})
+	assert.NoError(t, err)
+
+	token := func(scope string) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+			Scope:            scope,
+		}).SignedString([]byte("secret"))
+		assert.NoError(t, err)
+		return "Bearer " + s
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		authorization string
+		wantStatus    int
+	}{
+		{
+			name:       "Missing token",
+			method:     "GET",
+			url:        "/books",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Invalid token",
+			method:        "GET",
+			url:           "/books",
+			authorization: "Bearer nope",
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Read scope reads",
+			method:        "GET",
+			url:           "/books",
+			authorization: token("books:read"),
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "Read scope can't delete",
+			method:        "DELETE",
+			url:           "/books/00000000-0000-0000-0000-000000000000",
+			authorization: token("books:read"),
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "Write scope deletes",
+			method:        "DELETE",
+			url:           "/books/00000000-0000-0000-0000-000000000000",
+			authorization: token("books:write"),
+			wantStatus:    http.StatusOK,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			testRouter := NewController(db, WithVerifier(verifier)).Routes()
+
+			rr := httptest.NewRecorder()
+
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", tc.authorization)
+
+			testRouter.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+			if tc.wantStatus == http.StatusUnauthorized {
+				assert.Contains(t, rr.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+}
+
+func TestController_Permit(t *testing.T) {
+	db := new(mocks.DB)
+
+	db.On("FindAll", mock.Anything, model.ReadMask(nil)).Return([]model.Book{}, model.Revision{}, nil)
+	db.On("DeleteBook", mock.Anything, "00000000-0000-0000-0000-000000000000").Return(nil)
+
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: []byte("secret")})
+	assert.NoError(t, err)
+	enforcer := rbac.NewEnforcer(rbac.DefaultPolicy())
+
+	token := func(roles ...string) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+			Scope:            "books:read books:write",
+			Roles:            roles,
+		}).SignedString([]byte("secret"))
+		assert.NoError(t, err)
+		return "Bearer " + s
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		roles      []string
+		wantStatus int
+	}{
+		{
+			name:       "No role",
+			method:     "GET",
+			url:        "/books",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Reader lists",
+			method:     "GET",
+			url:        "/books",
+			roles:      []string{rbac.RoleReader},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Reader can't delete",
+			method:     "DELETE",
+			url:        "/books/00000000-0000-0000-0000-000000000000",
+			roles:      []string{rbac.RoleReader},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Librarian deletes",
+			method:     "DELETE",
+			url:        "/books/00000000-0000-0000-0000-000000000000",
+			roles:      []string{rbac.RoleLibrarian},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			testRouter := NewController(db, WithVerifier(verifier), WithEnforcer(enforcer)).Routes()
+
+			rr := httptest.NewRecorder()
+
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", token(tc.roles...))
+
+			testRouter.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+		})
+	}
+}
+
+func TestController_APIKeys(t *testing.T) {
+	db := new(mocks.DB)
+	keys := new(mocks.APIKeyStore)
+
+	db.On("FindAll", mock.Anything, model.ReadMask(nil)).Return([]model.Book{}, model.Revision{}, nil)
+
+	id := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	keys.On("AuthenticateAPIKey", mock.Anything, "bk_reader").Return(model.APIKey{Owner: "batch", Scopes: []string{"books:read", "role:reader"}}, nil)
+	keys.On("AuthenticateAPIKey", mock.Anything, "bk_admin").Return(model.APIKey{Owner: "ops", Scopes: []string{"books:admin", "role:admin"}}, nil)
+	keys.On("AuthenticateAPIKey", mock.Anything, "bk_revoked").Return(model.APIKey{}, fmt.Errorf("revoked: %w", storage.ErrNotFound))
+	keys.On("CreateAPIKey", mock.Anything, model.CreateAPIKeyInput{Owner: "batch", Scopes: []string{"books:read"}}).
+		Return(model.APIKey{ID: id, Key: "bk_new", Owner: "batch", Scopes: []string{"books:read"}, CreatedAt: created}, nil)
+	keys.On("ListAPIKeys", mock.Anything).
+		Return([]model.APIKey{{ID: id, Owner: "batch", Scopes: []string{"books:read"}, CreatedAt: created}}, nil)
+	keys.On("RevokeAPIKey", mock.Anything, id.String()).Return(nil)
+
+	enforcer := rbac.NewEnforcer(rbac.DefaultPolicy())
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		apiKey     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Reader key lists books",
+			method:     "GET",
+			url:        "/books",
+			apiKey:     "bk_reader",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"data":[]}`,
+		},
+		{
+			name:       "Revoked key",
+			method:     "GET",
+			url:        "/books",
+			apiKey:     "bk_revoked",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Reader key can't manage keys",
+			method:     "GET",
+			url:        "/admin/api-keys",
+			apiKey:     "bk_reader",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Create key",
+			method:     "POST",
+			url:        "/admin/api-keys",
+			apiKey:     "bk_admin",
+			body:       `{"owner":"batch","scopes":["books:read"]}`,
+			wantStatus: http.StatusCreated,
+			wantBody:   `{"data":{"id":"00000000-0000-0000-0000-000000000001","key":"bk_new","owner":"batch","scopes":["books:read"],"created_at":"2026-01-02T03:04:05Z"}}`,
+		},
+		{
+			name:       "Create key with unknown scope",
+			method:     "POST",
+			url:        "/admin/api-keys",
+			apiKey:     "bk_admin",
+			body:       `{"owner":"batch","scopes":["books:everything"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "List keys without plaintext",
+			method:     "GET",
+			url:        "/admin/api-keys",
+			apiKey:     "bk_admin",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"data":[{"id":"00000000-0000-0000-0000-000000000001","owner":"batch","scopes":["books:read"],"created_at":"2026-01-02T03:04:05Z"}]}`,
+		},
+		{
+			name:       "Revoke key",
+			method:     "DELETE",
+			url:        "/admin/api-keys/00000000-0000-0000-0000-000000000001",
+			apiKey:     "bk_admin",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"data":"API key has been revoked"}`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			testRouter := NewController(db, WithAPIKeys(keys), WithEnforcer(enforcer)).Routes()
+
+			rr := httptest.NewRecorder()
+
+			req, err := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			assert.NoError(t, err)
+			req.Header.Set("X-API-Key", tc.apiKey)
+
+			testRouter.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+			if tc.wantBody != "" {
+				assert.JSONEq(t, tc.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestController_RateLimit(t *testing.T) {
+	db := new(mocks.DB)
+	db.On("FindAll", mock.Anything, model.ReadMask(nil)).Return([]model.Book{}, model.Revision{}, nil)
+
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.New(ratelimit.Config{
+		Default: ratelimit.Limit{Rate: 100, Burst: 100},
+		Routes:  map[string]ratelimit.Limit{"GET /books": {Rate: 0.5, Burst: 2}},
+		PerIP:   ratelimit.Limit{Rate: 100, Burst: 100},
+	})
+	testRouter := NewController(db, WithRateLimiter(limiter)).Routes()
+
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/books", nil)
+		assert.NoError(t, err)
+		req.RemoteAddr = remoteAddr
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", rr.Header().Get("RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusOK, get("10.0.0.1:1234").Code)
+
+	rr = get("10.0.0.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+	assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, mimeProblemJSON, rr.Header().Get("Content-Type"))
+
+	// Another client has its own bucket.
+	assert.Equal(t, http.StatusOK, get("10.0.0.2:1234").Code)
+
+	forwarded := func(router *gin.Engine, remoteAddr, forwardedFor string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/books", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// A forged X-Forwarded-For doesn't buy a fresh bucket.
+	assert.Equal(t, http.StatusTooManyRequests, forwarded(testRouter, "10.0.0.1:1234", "192.0.2.1"))
+
+	// Behind a trusted proxy the header tells the clients apart.
+	limiter = ratelimit.New(ratelimit.Config{
+		Default: ratelimit.Limit{Rate: 100, Burst: 100},
+		Routes:  map[string]ratelimit.Limit{"GET /books": {Rate: 0.5, Burst: 1}},
+		PerIP:   ratelimit.Limit{Rate: 100, Burst: 100},
+	})
+	proxied := NewController(db, WithRateLimiter(limiter), WithTrustedProxies([]string{"10.0.0.0/8"})).Routes()
+	assert.Equal(t, http.StatusOK, forwarded(proxied, "10.0.0.1:1234", "192.0.2.1"))
+	assert.Equal(t, http.StatusTooManyRequests, forwarded(proxied, "10.0.0.1:1234", "192.0.2.1"))
+	assert.Equal(t, http.StatusOK, forwarded(proxied, "10.0.0.1:1234", "192.0.2.2"))
+
+	// Bad credentials are throttled per IP before they're checked.
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: []byte("secret")})
+	assert.NoError(t, err)
+	limiter = ratelimit.New(ratelimit.Config{
+		Default: ratelimit.Limit{Rate: 100, Burst: 100},
+		PerIP:   ratelimit.Limit{Rate: 0.5, Burst: 2},
+	})
+	authorized := NewController(db, WithRateLimiter(limiter), WithVerifier(verifier)).Routes()
+	codes := make([]int, 0, 3)
+	for _, url := range []string{"/v1/books", "/v1/books/00000000-0000-0000-0000-000000000001", "/books"} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", url, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("Authorization", "Bearer invalid")
+		authorized.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+	}
+	assert.Equal(t, []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}, codes)
+}
+
+func TestController_Versions(t *testing.T) {
+	id := "00000000-0000-0000-0000-000000000001"
+	book := model.Book{ID: uuid.MustParse(id), Title: "Dune", Author: "Frank Herbert"}
+
+	db := new(mocks.DB)
+	db.On("FindAll", mock.Anything, model.ReadMask(nil)).Return([]model.Book{book}, model.Revision{}, nil)
+	db.On("GetBook", mock.Anything, id, model.ReadMask(nil)).Return(book, nil)
+	db.On("Create", mock.Anything, mock.Anything).Return(book, nil)
+
+	gin.SetMode(gin.TestMode)
+	sunset := time.Date(2027, 4, 19, 0, 0, 0, 0, time.UTC)
+	testRouter := NewController(db, WithSunset(sunset)).Routes()
+
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		body          string
+		wantCode      int
+		wantLocation  string
+		wantSuccessor string
+	}{
+		{name: "List", method: "GET", url: "/v1/books", wantCode: http.StatusOK},
+		{name: "Get", method: "GET", url: "/v1/books/" + id, wantCode: http.StatusOK},
+		{
+			name:         "Create answers 201 with the location of the book",
+			method:       "POST",
+			url:          "/v1/books",
+			body:         `{"title": "Dune", "author": "Frank Herbert"}`,
+			wantCode:     http.StatusCreated,
+			wantLocation: "/v1/books/" + id,
+		},
+		{name: "Legacy list", method: "GET", url: "/books", wantCode: http.StatusOK, wantSuccessor: "/v1/books"},
+		{name: "Legacy get", method: "GET", url: "/books/" + id, wantCode: http.StatusOK, wantSuccessor: "/v1/books/" + id},
+		{
+			name:          "Legacy create keeps answering 200",
+			method:        "POST",
+			url:           "/create",
+			body:          `{"title": "Dune", "author": "Frank Herbert"}`,
+			wantCode:      http.StatusOK,
+			wantSuccessor: "/v1/books",
+		},
+		{name: "No legacy create on /books", method: "POST", url: "/books", wantCode: http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			testRouter.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantCode, rr.Code)
+			assert.Equal(t, tc.wantLocation, rr.Header().Get("Location"))
+			if tc.wantSuccessor == "" {
+				assert.Empty(t, rr.Header().Get("Deprecation"))
+				assert.Empty(t, rr.Header().Get("Link"))
+				return
+			}
+			assert.Equal(t, "@1792368000", rr.Header().Get("Deprecation"))
+			assert.Equal(t, "Mon, 19 Apr 2027 00:00:00 GMT", rr.Header().Get("Sunset"))
+			assert.Equal(t, `<`+tc.wantSuccessor+`>; rel="successor-version"`, rr.Header().Get("Link"))
+		})
+	}
+
+	t.Run("Versions share the rate limit of a route", func(t *testing.T) {
+		limiter := ratelimit.New(ratelimit.Config{
+			Default: ratelimit.Limit{Rate: 100, Burst: 100},
+			Routes:  map[string]ratelimit.Limit{"POST /books": {Rate: 0.5, Burst: 1}},
+			PerIP:   ratelimit.Limit{Rate: 100, Burst: 100},
+		})
+		testRouter := NewController(db, WithRateLimiter(limiter)).Routes()
+
+		codes := make([]int, 0, 2)
+		for _, url := range []string{"/v1/books", "/create"} {
+			rr := httptest.NewRecorder()
+			testRouter.ServeHTTP(rr, httptest.NewRequest("POST", url, strings.NewReader(`{"title": "Dune", "author": "Frank Herbert"}`)))
+			codes = append(codes, rr.Code)
+		}
+		assert.Equal(t, []int{http.StatusCreated, http.StatusTooManyRequests}, codes)
+	})
+}
+
+func TestController_CORS(t *testing.T) {
+	db := new(mocks.DB)
+	db.On("FindAll", mock.Anything, model.ReadMask(nil)).Return([]model.Book{}, model.Revision{}, nil)
+
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: []byte("secret")})
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	cors := NewCORS([]string{"https://books.example"})
+	testRouter := NewController(db, WithVerifier(verifier), WithCORS(cors)).Routes()
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		preflight   bool
+		wantCode    int
+		wantAllowed bool
+	}{
+		{
+			name:        "Preflight of an allowed origin skips authentication",
+			method:      "OPTIONS",
+			origin:      "https://books.example",
+			preflight:   true,
+			wantCode:    http.StatusNoContent,
+			wantAllowed: true,
+		},
+		{
+			name:        "Request of an allowed origin",
+			method:      "GET",
+			origin:      "https://books.example",
+			wantCode:    http.StatusUnauthorized,
+			wantAllowed: true,
+		},
+		{
+			name:     "Request of another origin",
+			method:   "GET",
+			origin:   "https://evil.example",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Preflight of another origin",
+			method:   "OPTIONS",
+			origin:   "https://evil.example",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, "/books", nil)
+			req.Header.Set("Origin", tc.origin)
+			if tc.preflight {
+				req.Header.Set("Access-Control-Request-Method", "DELETE")
+			}
+			testRouter.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantCode, rr.Code)
+			if tc.wantAllowed {
+				assert.Equal(t, tc.origin, rr.Header().Get("Access-Control-Allow-Origin"))
+				assert.Equal(t, "Origin", rr.Header().Get("Vary"))
+			} else {
+				assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+			}
+			if tc.preflight {
+				assert.Contains(t, rr.Header().Get("Access-Control-Allow-Methods"), "DELETE")
+				assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+			}
+		})
+	}
+
+	// Origins are swapped while serving.
+	cors.SetOrigins([]string{"*"})
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/books", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	testRouter.ServeHTTP(rr, req)
+	assert.Equal(t, "https://evil.example", rr.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestController_Caching(t *testing.T) {
+	id := "00000000-0000-0000-0000-000000000001"
+	missing := "00000000-0000-0000-0000-000000000002"
+	updated := time.Date(2026, 1, 1, 10, 0, 0, 500, time.UTC)
+	lastModified := "Thu, 01 Jan 2026 10:00:00 GMT"
+	book := model.Book{ID: uuid.MustParse(id), Title: "Dune", Author: "Frank Herbert", Revision: model.Revision{Version: 3, UpdatedAt: updated}}
+
+	db := new(mocks.DB)
+	db.On("CatalogRevision", mock.Anything).Return(model.Revision{Version: 7, UpdatedAt: updated}, nil)
+	db.On("FindAll", mock.Anything, mock.Anything).Return([]model.Book{book}, model.Revision{Version: 7, UpdatedAt: updated}, nil)
+	db.On("BookRevision", mock.Anything, id).Return(book.Revision, nil)
+	db.On("BookRevision", mock.Anything, missing).Return(model.Revision{}, storage.ErrNotFound)
+	db.On("GetBook", mock.Anything, id, mock.Anything).Return(book, nil)
+	db.On("GetBook", mock.Anything, missing, mock.Anything).Return(model.Book{}, storage.ErrNotFound)
+
+	gin.SetMode(gin.TestMode)
+	testRouter := NewController(db, WithCaching(CachePolicy{List: "public, max-age=60", Book: "private, no-cache"})).Routes()
+	get := func(url string, headers map[string]string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", url, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+
+	list := get("/books", nil)
+	assert.Equal(t, http.StatusOK, list.Code)
+	listTag := list.Header().Get("ETag")
+	assert.Regexp(t, `^"7-[0-9a-f]{8}"$`, listTag)
+	assert.Equal(t, lastModified, list.Header().Get("Last-Modified"))
+	assert.Equal(t, "public, max-age=60", list.Header().Get("Cache-Control"))
+	assert.Equal(t, "Accept", list.Header().Get("Vary"))
+	db.AssertNumberOfCalls(t, "CatalogRevision", 0)
+
+	single := get("/books/"+id, nil)
+	assert.Equal(t, http.StatusOK, single.Code)
+	bookTag := single.Header().Get("ETag")
+	assert.Regexp(t, `^"3-[0-9a-f]{8}"$`, bookTag)
+	assert.Equal(t, "private, no-cache", single.Header().Get("Cache-Control"))
+	db.AssertNumberOfCalls(t, "BookRevision", 0)
+
+	tests := []struct {
+		name     string
+		url      string
+		headers  map[string]string
+		wantCode int
+	}{
+		{name: "Matching ETag", url: "/books", headers: map[string]string{"If-None-Match": listTag}, wantCode: http.StatusNotModified},
+		{name: "Matching weak ETag among others", url: "/books", headers: map[string]string{"If-None-Match": `"6-00000000", W/` + listTag}, wantCode: http.StatusNotModified},
+		{name: "Any ETag", url: "/books", headers: map[string]string{"If-None-Match": "*"}, wantCode: http.StatusNotModified},
+		{name: "Older ETag", url: "/books", headers: map[string]string{"If-None-Match": `"6-00000000"`}, wantCode: http.StatusOK},
+		{name: "ETag of another format", url: "/books", headers: map[string]string{"If-None-Match": listTag, "Accept": "text/csv"}, wantCode: http.StatusOK},
+		{name: "ETag of other fields", url: "/books?fields=title", headers: map[string]string{"If-None-Match": listTag}, wantCode: http.StatusOK},
+		{name: "Not modified since", url: "/books", headers: map[string]string{"If-Modified-Since": lastModified}, wantCode: http.StatusNotModified},
+		{name: "Modified since", url: "/books", headers: map[string]string{"If-Modified-Since": "Thu, 01 Jan 2026 09:59:59 GMT"}, wantCode: http.StatusOK},
+		{
+			name:     "ETag checked before the date",
+			url:      "/books",
+			headers:  map[string]string{"If-None-Match": `"6-00000000"`, "If-Modified-Since": lastModified},
+			wantCode: http.StatusOK,
+		},
+		{name: "Matching book ETag", url: "/books/" + id, headers: map[string]string{"If-None-Match": bookTag}, wantCode: http.StatusNotModified},
+		{name: "Book not modified since", url: "/books/" + id, headers: map[string]string{"If-Modified-Since": lastModified}, wantCode: http.StatusNotModified},
+		{name: "Missing book", url: "/books/" + missing, headers: map[string]string{"If-None-Match": "*"}, wantCode: http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := get(tc.url, tc.headers)
+
+			assert.Equal(t, tc.wantCode, rr.Code)
+			switch tc.wantCode {
+			case http.StatusNotModified:
+				assert.Empty(t, rr.Body.String())
+				assert.NotEmpty(t, rr.Header().Get("ETag"))
+				assert.Equal(t, lastModified, rr.Header().Get("Last-Modified"))
+			case http.StatusNotFound:
+				assert.Empty(t, rr.Header().Get("ETag"))
+			}
+		})
+	}
+
+	// Books answered 304 from their revision alone.
+	db.AssertNumberOfCalls(t, "GetBook", 2)
+
+	t.Run("Unknown revision", func(t *testing.T) {
+		db := new(mocks.DB)
+		db.On("CatalogRevision", mock.Anything).Return(model.Revision{}, storage.ErrUnavailable)
+		db.On("FindAll", mock.Anything, mock.Anything).Return([]model.Book{book}, model.Revision{}, nil)
+		testRouter := NewController(db, WithCaching(CachePolicy{})).Routes()
+
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/books", nil)
+		req.Header.Set("If-None-Match", "*")
+		testRouter.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("ETag"))
+		assert.Empty(t, rr.Header().Get("Cache-Control"))
+	})
+
+	t.Run("Validators of the books listed", func(t *testing.T) {
+		db := new(mocks.DB)
+		db.On("CatalogRevision", mock.Anything).Return(model.Revision{Version: 7, UpdatedAt: updated}, nil)
+		db.On("FindAll", mock.Anything, mock.Anything).Return([]model.Book{book}, model.Revision{Version: 8, UpdatedAt: updated}, nil)
+		testRouter := NewController(db, WithCaching(CachePolicy{})).Routes()
+
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/books", nil)
+		req.Header.Set("If-None-Match", `"6-00000000"`)
+		testRouter.ServeHTTP(rr, req)
+
+		// The catalog changed after the check, the ETag is the one of the
+		// books sent.
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Regexp(t, `^"8-[0-9a-f]{8}"$`, rr.Header().Get("ETag"))
+	})
+}
+
+func TestController_Metrics(t *testing.T) {
+	db := new(mocks.DB)
+	db.On("FindAll", mock.Anything, model.ReadMask(nil)).Return([]model.Book{}, model.Revision{}, nil)
+
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: []byte("secret")})
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	reg := metrics.NewRegistry()
+	testRouter := NewController(db, WithVerifier(verifier), WithMetrics(metrics.NewHTTP(reg))).Routes()
+
+	rr := httptest.NewRecorder()
+	testRouter.ServeHTTP(rr, httptest.NewRequest("GET", "/books", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// The metrics aren't served by the API.
+	rr = httptest.NewRecorder()
+	testRouter.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	metrics.Handler(reg).ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `books_http_requests_total{code="401",method="GET",route="/books"} 1`)
+}
+
+func TestController_Tracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	id := "00000000-0000-0000-0000-000000000000"
+
+	// The storage sees the request span in its context.
+	var storageSpan trace.SpanContext
+	db := new(mocks.DB)
+	db.On("GetBook", mock.Anything, id, model.ReadMask(nil)).
+		Run(func(args mock.Arguments) {
+			storageSpan = trace.SpanContextFromContext(args.Get(0).(context.Context))
+		}).
+		Return(model.Book{}, storage.ErrNotFound)
+
+	gin.SetMode(gin.TestMode)
+	testRouter := NewController(db, WithTracing()).Routes()
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/books/"+id, nil)
+	req.Header.Set("traceparent", "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01")
+	testRouter.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	spans := sr.Ended()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.Equal(t, "GET /books/:id", span.Name())
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+		assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", span.SpanContext().TraceID().String())
+		assert.Equal(t, span.SpanContext(), storageSpan)
+		assert.Contains(t, span.Attributes(), semconv.HTTPRoute("/books/:id"))
+		assert.Contains(t, span.Attributes(), semconv.HTTPStatusCode(http.StatusNotFound))
+	}
+}
+
+func TestController_RequestID(t *testing.T) {
+	id := "00000000-0000-0000-0000-000000000000"
+
+	// The storage, and the gRPC client behind it, see the request ID.
+	var storageID string
+	db := new(mocks.DB)
+	db.On("GetBook", mock.Anything, id, model.ReadMask(nil)).
+		Run(func(args mock.Arguments) {
+			storageID, _ = logging.RequestIDFromContext(args.Get(0).(context.Context))
+		}).
+		Return(model.Book{}, fmt.Errorf("couldn't find a book: %w", storage.ErrInternal))
+
+	var buf bytes.Buffer
+	gin.SetMode(gin.TestMode)
+	testRouter := NewController(db, WithLogger(logging.New(&buf, slog.LevelInfo))).Routes()
+
+	tests := []struct {
+		name   string
+		header string
+		reused bool
+	}{
+		{name: "Accepted", header: "checkout-42", reused: true},
+		{name: "Generated", header: ""},
+		{name: "Malformed replaced", header: "forged\nline"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/books/"+id, nil)
+			req.Header.Set("X-Request-ID", tc.header)
+			testRouter.ServeHTTP(rr, req)
+
+			got := rr.Header().Get("X-Request-ID")
+			if tc.reused {
+				assert.Equal(t, tc.header, got)
+			} else {
+				assert.NotEqual(t, tc.header, got)
+				assert.True(t, logging.ValidRequestID(got))
+			}
+			assert.Equal(t, got, storageID)
+
+			var p Problem
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+			assert.Equal(t, got, p.RequestID)
+
+			// The log keeps the cause the problem hides.
+			var line map[string]interface{}
+			assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+			assert.Equal(t, "ERROR", line["level"])
+			assert.Equal(t, got, line["request_id"])
+			assert.Equal(t, "/books/:id", line["route"])
+			assert.Equal(t, float64(http.StatusInternalServerError), line["status"])
+			assert.Equal(t, "couldn't find a book: internal storage error", line["error"])
+		})
+	}
+}
+
+func TestController_Health(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: []byte("secret")})
+	assert.NoError(t, err)
+
+	checker := health.NewChecker(time.Second)
+	checker.Add("grpc", func(context.Context) (string, error) {
+		return "", errors.New("gRPC server didn't answer: Unavailable")
+	})
+
+	gin.SetMode(gin.TestMode)
+	testRouter := NewController(new(mocks.DB), WithVerifier(verifier), WithHealth(checker)).Routes()
+
+	// Probes need no token.
+	rr := httptest.NewRecorder()
+	testRouter.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	testRouter.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.JSONEq(t, `{"status":"down","checks":{"grpc":{"status":"down","error":"gRPC server didn't answer: Unavailable"}}}`, rr.Body.String())
+}
+
+func TestController_OpenAPI(t *testing.T) {
+	id := "00000000-0000-0000-0000-000000000001"
+	db := new(mocks.DB)
+	db.On("GetBook", mock.Anything, id, model.ReadMask(nil)).Return(model.Book{ID: uuid.MustParse(id), Title: "Dune", Author: "Frank Herbert"}, nil)
+
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: []byte("secret")})
+	assert.NoError(t, err)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		Scope:            auth.ScopeRead,
+	}).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+	reg := metrics.NewRegistry()
+
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		controller *Controller
+	}{
+		{name: "Open API", controller: NewController(db)},
+		{
+			name: "Every option",
+			controller: NewController(db,
+				WithVerifier(verifier),
+				WithAPIKeys(new(mocks.APIKeyStore)),
+				WithMetrics(metrics.NewHTTP(reg)),
+				WithHealth(health.NewChecker(time.Second)),
+				WithCaching(CachePolicy{})),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			testRouter := tc.controller.Routes()
+
+			rr := httptest.NewRecorder()
+			testRouter.ServeHTTP(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			var spec struct {
+				OpenAPI string `json:"openapi"`
+				Paths   map[string]map[string]struct {
+					Summary string `json:"summary"`
+				} `json:"paths"`
+				Components struct {
+					Schemas map[string]struct {
+						Properties map[string]json.RawMessage `json:"properties"`
+						Required   []string                   `json:"required"`
+					} `json:"schemas"`
+				} `json:"components"`
+			}
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &spec))
+			assert.Equal(t, "3.1.0", spec.OpenAPI)
+
+			// Every route is documented, and only the routes served.
+			var served, documented []string
+			for _, r := range testRouter.Routes() {
+				served = append(served, r.Method+" "+openAPIPath(r.Path))
+			}
+			for path, ops := range spec.Paths {
+				for method, op := range ops {
+					documented = append(documented, strings.ToUpper(method)+" "+path)
+					assert.NotEmpty(t, op.Summary, "%s %s", method, path)
+				}
+			}
+			assert.ElementsMatch(t, served, documented)
+
+			// Every schema referenced is defined.
+			for _, ref := range regexp.MustCompile(`"#/components/schemas/(\w+)"`).FindAllStringSubmatch(rr.Body.String(), -1) {
+				assert.Contains(t, spec.Components.Schemas, ref[1])
+			}
+
+			// A book answered has the fields of its schema.
+			rr = httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/v1/books/"+id, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			testRouter.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			var body struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+			book := spec.Components.Schemas["Book"]
+			for field := range body.Data {
+				assert.Contains(t, book.Properties, field)
+			}
+			for _, field := range book.Required {
+				assert.Contains(t, body.Data, field)
+			}
+
+			rr = httptest.NewRecorder()
+			testRouter.ServeHTTP(rr, httptest.NewRequest("GET", "/docs", nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Contains(t, rr.Body.String(), `url: "/openapi.json"`)
+			// The page loads nothing from other origins.
+			assert.NotRegexp(t, `(src|href)="(https?:)?//`, rr.Body.String())
+
+			// Its assets are embedded in the gateway.
+			for file, contentType := range map[string]string{
+				"/docs/swagger-ui.css":       "text/css; charset=utf-8",
+				"/docs/swagger-ui-bundle.js": "text/javascript; charset=utf-8",
+			} {
+				rr = httptest.NewRecorder()
+				testRouter.ServeHTTP(rr, httptest.NewRequest("GET", file, nil))
+				assert.Equal(t, http.StatusOK, rr.Code, file)
+				assert.Equal(t, contentType, rr.Header().Get("Content-Type"), file)
+				assert.NotEmpty(t, rr.Body.Bytes(), file)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	corsMethods = "GET, POST, PUT, PATCH, DELETE"
+	corsHeaders = "Accept, Authorization, Content-Type, If-Modified-Since, If-None-Match, X-API-Key, X-Request-ID"
+	corsExposed = "ETag, Last-Modified, Location, Deprecation, Sunset, Link, X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After"
+	// corsMaxAge is how long, in seconds, browsers may cache a preflight.
+	corsMaxAge = "600"
+)
+
+// CORS holds the origins allowed to call the API from a browser, "*"
+// allowing any. They can be replaced while requests are served.
+type CORS struct {
+	origins atomic.Pointer[map[string]bool]
+}
+
+// NewCORS allows origins.
+func NewCORS(origins []string) *CORS {
+	c := &CORS{}
+	c.SetOrigins(origins)
+	return c
+}
+
+// SetOrigins replaces the allowed origins.
+func (o *CORS) SetOrigins(origins []string) {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+	o.origins.Store(&allowed)
+}
+
+func (o *CORS) allows(origin string) bool {
+	allowed := *o.origins.Load()
+	return allowed["*"] || allowed[origin]
+}
+
+// middleware adds the CORS headers for allowed origins and answers their
+// preflight requests, which carry no credentials and so come before
+// authentication. Other origins get no CORS headers and browsers block them.
+func (o *CORS) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !o.allows(origin) {
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Writer.Header().Add("Vary", "Origin")
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", corsMethods)
+			c.Header("Access-Control-Allow-Headers", corsHeaders)
+			c.Header("Access-Control-Max-Age", corsMaxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Header("Access-Control-Expose-Headers", corsExposed)
+		c.Next()
+	}
+}
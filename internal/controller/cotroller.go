@@ -1,53 +1,250 @@
 package controller
 
 import (
+	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 
+	"gin_training/internal/auth"
+	"gin_training/internal/health"
+	"gin_training/internal/metrics"
 	"gin_training/internal/model"
+	"gin_training/internal/ratelimit"
+	"gin_training/internal/rbac"
+	"gin_training/internal/storage/cache"
 	storage "gin_training/internal/storage/postgreSQL"
+	"gin_training/internal/validation"
 )
 
+func init() {
+	// Inputs are normalized and checked by the rules shared with the gRPC server.
+	binding.Validator = validation.Default()
+}
+
 type Controller struct {
 	database storage.DB
+	verifier *auth.Verifier
+	enforcer *rbac.Enforcer
+	keys     storage.APIKeyStore
+	limiter  *ratelimit.Limiter
+	metrics  *metrics.HTTP
+	tracing  bool
+	log      *slog.Logger
+	health   *health.Checker
+	cors     *CORS
+	caching  *CachePolicy
+	sunset   time.Time
+	proxies  []string
 }
 
-func NewController(db storage.DB) *Controller {
-	return &Controller{
+// Option configures optional parts of the Controller.
+type Option func(*Controller)
+
+// WithVerifier requires a valid bearer token on every route, read routes
+// need the books:read scope and write routes books:write.
+func WithVerifier(v *auth.Verifier) Option {
+	return func(cr *Controller) {
+		cr.verifier = v
+	}
+}
+
+// WithEnforcer checks the roles of authenticated callers against an RBAC
+// policy on top of the token scopes.
+func WithEnforcer(e *rbac.Enforcer) Option {
+	return func(cr *Controller) {
+		cr.enforcer = e
+	}
+}
+
+// WithAPIKeys accepts API keys in the X-API-Key header next to bearer
+// tokens and serves the /admin/api-keys endpoints managing them.
+func WithAPIKeys(keys storage.APIKeyStore) Option {
+	return func(cr *Controller) {
+		cr.keys = keys
+	}
+}
+
+// WithRateLimiter throttles every client per route, answering 429 once its
+// bucket is empty.
+func WithRateLimiter(l *ratelimit.Limiter) Option {
+	return func(cr *Controller) {
+		cr.limiter = l
+	}
+}
+
+// WithMetrics records every request in m, which is scraped apart from the
+// API.
+func WithMetrics(m *metrics.HTTP) Option {
+	return func(cr *Controller) {
+		cr.metrics = m
+	}
+}
+
+// WithTracing starts a span per request, the storage calls made while
+// serving it join its trace.
+func WithTracing() Option {
+	return func(cr *Controller) {
+		cr.tracing = true
+	}
+}
+
+// WithHealth serves /healthz and /readyz, the readiness endpoint runs the
+// checks of c.
+func WithHealth(c *health.Checker) Option {
+	return func(cr *Controller) {
+		cr.health = c
+	}
+}
+
+// WithCORS lets the origins of c call the API from a browser.
+func WithCORS(c *CORS) Option {
+	return func(cr *Controller) {
+		cr.cors = c
+	}
+}
+
+// WithCaching versions the book reads with an ETag and Last-Modified taken
+// from their revision, answers 304 Not Modified to the conditional requests
+// still matching it and sets the Cache-Control of p.
+func WithCaching(p CachePolicy) Option {
+	return func(cr *Controller) {
+		cr.caching = &p
+	}
+}
+
+// WithSunset announces in the Sunset header of the unversioned routes that
+// they are served until t.
+func WithSunset(t time.Time) Option {
+	return func(cr *Controller) {
+		cr.sunset = t
+	}
+}
+
+// WithTrustedProxies takes the client address of the requests coming from
+// proxies, IPs or CIDRs, from their X-Forwarded-For or X-Real-IP header.
+// Otherwise the peer address identifies clients, the headers being easy to
+// forge.
+func WithTrustedProxies(proxies []string) Option {
+	return func(cr *Controller) {
+		cr.proxies = proxies
+	}
+}
+
+// WithLogger logs the requests to l instead of the default slog logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(cr *Controller) {
+		cr.log = l
+	}
+}
+
+func NewController(db storage.DB, opts ...Option) *Controller {
+	cr := &Controller{
 		database: db,
+		log:      slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(cr)
 	}
+	return cr
 }
 
 // Handlers
 func (cr *Controller) Routes() *gin.Engine {
-	r := gin.Default()
-	r.GET("/books", cr.AllBooks)
-	r.POST("/create", cr.CreateBook)
-	r.GET("/books/:id", cr.FindBook)
-	r.PATCH("/books/:id", cr.UpdateBook)
-	r.DELETE("/books/:id", cr.DeleteBook)
+	r := gin.New()
+	if err := r.SetTrustedProxies(cr.proxies); err != nil {
+		cr.log.Error("invalid trusted proxies, trusting none", "error", err)
+		_ = r.SetTrustedProxies(nil)
+	}
+	r.Use(cr.requestID())
+	if cr.tracing {
+		r.Use(cr.trace())
+	}
+	r.Use(cr.logRequests(), cr.recovery())
+	if cr.metrics != nil {
+		r.Use(cr.metrics.Middleware())
+	}
+	if cr.cors != nil {
+		r.Use(cr.cors.middleware())
+	}
+	if cr.health != nil {
+		// Probes don't authenticate either.
+		r.GET("/healthz", gin.WrapH(health.LiveHandler()))
+		r.GET("/readyz", gin.WrapH(health.ReadyHandler(cr.health)))
+	}
+	// The description of the routes, public like the probes.
+	spec := cr.openAPI()
+	r.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, spec)
+	})
+	r.GET("/docs", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+	})
+	for file, contentType := range swaggerUIAssets {
+		data, _ := swaggerUI.ReadFile("swaggerui/" + file)
+		contentType := contentType
+		r.GET("/docs/"+file, func(c *gin.Context) {
+			c.Data(http.StatusOK, contentType, data)
+		})
+	}
+	r.Use(problems(), negotiate())
+
+	cr.handleBooks(r)
+
+	if cr.keys != nil {
+		admin := r.Group("/admin", cr.throttleIP(), cr.authorize(auth.ScopeAdmin), cr.rateLimit(), cr.permit(rbac.OpManageAPIKeys))
+		admin.POST("/api-keys", cr.CreateAPIKey)
+		admin.GET("/api-keys", cr.ListAPIKeys)
+		admin.DELETE("/api-keys/:id", cr.RevokeAPIKey)
+	}
+
 	return r
 }
 
-// GET /books
-// Get all books from db
+// GET /v1/books
+// Get all books from db, ?fields=id,title limits the returned fields
 func (cr *Controller) AllBooks(c *gin.Context) {
-	var books []model.Book
+	mask, err := readMask(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 
-	books = cr.database.FindAll()
+	// The revision alone answers the conditional requests still matching,
+	// the books are listed with the revision they're at otherwise, so their
+	// validators match them.
+	if cr.caching != nil && conditional(c.Request) {
+		rev, err := cr.database.CatalogRevision(c.Request.Context())
+		if v := newValidators(c, rev, mask); err == nil && notModified(c.Request, v) {
+			setValidators(c, cr.caching.List, v)
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
 
-	c.JSON(http.StatusOK, gin.H{"data": books})
+	books, rev, err := cr.database.FindAll(c.Request.Context(), mask)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if cr.caching != nil {
+		setValidators(c, cr.caching.List, newValidators(c, rev, mask))
+	}
+	versionOf(c).respond(c, http.StatusOK, project(books, mask))
 }
 
-// POST /create
+// POST /v1/books
 // Create a book
 func (cr *Controller) CreateBook(c *gin.Context) {
 	var input model.CreateBookInput
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindBody(c, &input); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
@@ -56,78 +253,170 @@ func (cr *Controller) CreateBook(c *gin.Context) {
 		Author: input.Author,
 	}
 
-	res, err := cr.database.Create(book)
+	res, err := cr.database.Create(c.Request.Context(), book)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": error.Error(err)})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": res})
+	versionOf(c).created(c, res)
 }
 
-// GET /book/:id
-// Find the book by id
+// GET /v1/books/:id
+// Find the book by id, ?fields=id,title limits the returned fields
 func (cr *Controller) FindBook(c *gin.Context) {
 
 	id := c.Param("id")
 
 	_, err := uuid.Parse(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID"})
+		_ = c.Error(&fieldsError{err: errInvalidID, fields: []FieldError{{Field: "id", Detail: "must be a UUID"}}})
 		return
 	}
 
-	res, err := cr.database.GetBook(id)
+	mask, err := readMask(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": error.Error(err)})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": res})
+	// The revision alone answers the conditional requests still matching,
+	// a missing book or a failure is reported by the read.
+	if cr.caching != nil && conditional(c.Request) {
+		rev, err := cr.database.BookRevision(c.Request.Context(), id)
+		if v := newValidators(c, rev, mask); err == nil && notModified(c.Request, v) {
+			setValidators(c, cr.caching.Book, v)
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	res, err := cr.database.GetBook(c.Request.Context(), id, mask)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	// The book carries the revision it was read at, which may be older than
+	// the one just checked when it comes from a cache.
+	if cr.caching != nil {
+		setValidators(c, cr.caching.Book, newValidators(c, res.Revision, mask))
+	}
+	versionOf(c).respond(c, http.StatusOK, project(res, mask))
 }
 
-// PUT /book/:id
-// Update information about the book by id
+// PATCH /v1/books/:id
+// Update information about the book by id. The body is a JSON Merge Patch,
+// a JSON Patch or the fields to change, depending on its Content-Type
 func (cr *Controller) UpdateBook(c *gin.Context) {
 	id := c.Param("id")
 
 	_, err := uuid.Parse(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID"})
+		_ = c.Error(&fieldsError{err: errInvalidID, fields: []FieldError{{Field: "id", Detail: "must be a UUID"}}})
 		return
 	}
 
 	var input model.UpdateBookInput
-	if err = c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+	switch c.ContentType() {
+	case mimeMergePatch, mimeJSONPatch:
+		input, err = cr.patchInput(c, id)
+	default:
+		err = bindBody(c, &input)
+	}
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	res, err := cr.database.UpdateBook(id, input)
+	res, err := cr.database.UpdateBook(c.Request.Context(), id, input)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": res})
+	versionOf(c).respond(c, http.StatusOK, res)
 }
 
-// DELETE /book/:id
+// PUT /v1/books/:id
+// Replace every field of the book by id
+func (cr *Controller) ReplaceBook(c *gin.Context) {
+	id := c.Param("id")
+
+	_, err := uuid.Parse(id)
+	if err != nil {
+		_ = c.Error(&fieldsError{err: errInvalidID, fields: []FieldError{{Field: "id", Detail: "must be a UUID"}}})
+		return
+	}
+
+	var book model.CreateBookInput
+	if err = bindBody(c, &book); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	input := model.UpdateBookInput{
+		Title:  book.Title,
+		Author: book.Author,
+		Fields: model.UpdatableFields,
+	}
+
+	res, err := cr.database.UpdateBook(c.Request.Context(), id, input)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	versionOf(c).respond(c, http.StatusOK, res)
+}
+
+// DELETE /v1/books/:id
 // Delete book from db
 func (cr *Controller) DeleteBook(c *gin.Context) {
 	id := c.Param("id")
 
 	_, err := uuid.Parse(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID"})
+		_ = c.Error(&fieldsError{err: errInvalidID, fields: []FieldError{{Field: "id", Detail: "must be a UUID"}}})
 		return
 	}
 
-	err = cr.database.DeleteBook(id)
+	err = cr.database.DeleteBook(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": "book have been deleted"})
+	versionOf(c).respond(c, http.StatusOK, "book have been deleted")
+}
+
+// patchInput builds a masked update from a patch document, JSON Patch is
+// applied to the stored book so "test" operations see its current state.
+func (cr *Controller) patchInput(c *gin.Context, id string) (model.UpdateBookInput, error) {
+	body, err := c.GetRawData()
+	if err != nil {
+		return model.UpdateBookInput{}, fmt.Errorf("%w: %v", errMalformedBody, err)
+	}
+
+	var input model.UpdateBookInput
+
+	if c.ContentType() == mimeMergePatch {
+		input, err = mergePatch(body)
+	} else {
+		// The tests of the patch hold for the book written: it's read past
+		// the caches, and only written if it's still at that revision.
+		var current model.Book
+		current, err = cr.database.GetBook(cache.Bypass(c.Request.Context()), id, nil)
+		if err != nil {
+			return model.UpdateBookInput{}, err
+		}
+		input, err = jsonPatch(body, current)
+		input.IfVersion = current.Revision.Version
+	}
+	if err != nil {
+		return model.UpdateBookInput{}, err
+	}
+
+	return input, binding.Validator.ValidateStruct(&input)
 }
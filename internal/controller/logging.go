@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gin_training/internal/logging"
+)
+
+// requestID reuses the X-Request-ID of the client when it's well formed and
+// generates one otherwise. It's echoed in the response and stored in the
+// request context, for the log lines, problems and gRPC calls.
+func (cr *Controller) requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+
+		c.Header(logging.RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+
+		c.Next()
+	}
+}
+
+// logRequests logs every request once served, in place of Gin's text
+// logger. Problems hide the cause of server errors, the log keeps it.
+func (cr *Controller) logRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.Last().Error()))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case c.FullPath() == "/healthz" || c.FullPath() == "/readyz":
+			// Probes would drown the API requests.
+			level = slog.LevelDebug
+		}
+		cr.log.LogAttrs(c.Request.Context(), level, "request served", attrs...)
+	}
+}
+
+// recovery turns a panicking handler into a 500 and logs the panic.
+func (cr *Controller) recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err interface{}) {
+		cr.log.ErrorContext(c.Request.Context(), "handler panicked", "panic", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
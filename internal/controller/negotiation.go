@@ -0,0 +1,374 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"gin_training/internal/model"
+	pb "gin_training/internal/proto"
+	"gin_training/internal/validation"
+)
+
+// Media types understood by the book endpoints in addition to the ones
+// already declared by gin's binding package.
+const (
+	mimeYAML     = "application/yaml"
+	mimeCSV      = "text/csv"
+	mimeProtobuf = "application/protobuf"
+)
+
+// formatKey is the gin context key holding the negotiated response media type.
+const formatKey = "format"
+
+// offeredFormats lists the response media types in order of preference,
+// the first one is used when the client doesn't send an Accept header.
+var offeredFormats = []string{
+	binding.MIMEJSON,
+	binding.MIMEXML,
+	binding.MIMEXML2,
+	binding.MIMEYAML,
+	mimeYAML,
+	mimeCSV,
+	binding.MIMEPROTOBUF,
+	mimeProtobuf,
+}
+
+// negotiate picks the response format from the Accept header and aborts
+// with 406 before the handler runs if none of the offered formats fits.
+func negotiate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := negotiateFormat(c.GetHeader("Accept"), offeredFormats)
+		if format == "" {
+			_ = c.Error(errNotAcceptable)
+			c.Abort()
+			return
+		}
+		c.Set(formatKey, format)
+		c.Next()
+	}
+}
+
+// negotiateFormat returns the offer with the highest quality value in the
+// Accept header. Like RFC 9110, an offer takes the quality of the most
+// specific range matching it, so q=0 on a media type excludes it even when a
+// wildcard accepts everything. Among offers of equal quality the one matched
+// by the more specific range wins, then the one offered first.
+func negotiateFormat(accept string, offered []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offered[0]
+	}
+
+	type mediaRange struct {
+		value string
+		q     float64
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mr := mediaRange{value: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		if mr.value == "" {
+			continue
+		}
+		for _, p := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					mr.q = q
+				}
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+
+	var (
+		best            string
+		bestQ           float64
+		bestSpecificity int
+	)
+	for _, offer := range offered {
+		q, specificity := 0.0, 0
+		for _, mr := range ranges {
+			if s := mediaMatch(mr.value, offer); s > specificity {
+				q, specificity = mr.q, s
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		if q > bestQ || q == bestQ && specificity > bestSpecificity {
+			best, bestQ, bestSpecificity = offer, q, specificity
+		}
+	}
+
+	return best
+}
+
+// mediaMatch tells how specifically the accepted range matches offer: 3 for
+// the media type itself, 2 for its type/*, 1 for */*, 0 when it doesn't.
+func mediaMatch(accepted, offer string) int {
+	switch {
+	case accepted == offer:
+		return 3
+	case accepted == "*/*":
+		return 1
+	case strings.HasSuffix(accepted, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(accepted, "*")):
+		return 2
+	}
+	return 0
+}
+
+// respond writes data with the negotiated format, every format wraps the
+// payload in the same "data" envelope.
+func respond(c *gin.Context, code int, data interface{}) {
+	format := c.GetString(formatKey)
+
+	switch format {
+	case binding.MIMEXML, binding.MIMEXML2:
+		c.Header("Content-Type", format+"; charset=utf-8")
+		c.Render(code, render.XML{Data: xmlResponse{Data: xmlPayload(data)}})
+	case binding.MIMEYAML, mimeYAML:
+		c.Header("Content-Type", format+"; charset=utf-8")
+		c.Render(code, render.YAML{Data: gin.H{"data": data}})
+	case mimeCSV:
+		c.Header("Content-Type", mimeCSV+"; charset=utf-8")
+		c.Status(code)
+		if err := writeCSV(c.Writer, data); err != nil {
+			_ = c.Error(err)
+		}
+	case binding.MIMEPROTOBUF, mimeProtobuf:
+		c.Header("Content-Type", format)
+		c.Render(code, render.ProtoBuf{Data: protoPayload(data)})
+	default:
+		c.JSON(code, gin.H{"data": data})
+	}
+}
+
+type xmlResponse struct {
+	XMLName xml.Name    `xml:"response"`
+	Data    interface{} `xml:"data"`
+}
+
+type xmlBooks struct {
+	Books interface{} `xml:"book"`
+}
+
+type xmlAPIKeys struct {
+	Keys []model.APIKey `xml:"api_key"`
+}
+
+func xmlPayload(data interface{}) interface{} {
+	switch v := data.(type) {
+	case []model.Book, []bookView:
+		return xmlBooks{Books: data}
+	case []model.APIKey:
+		return xmlAPIKeys{Keys: v}
+	default:
+		return data
+	}
+}
+
+func protoPayload(data interface{}) interface{} {
+	switch v := data.(type) {
+	case model.Book:
+		return bookToProto(v)
+	case bookView:
+		return viewToProto(v)
+	case []model.Book:
+		all := &pb.AllBooks{Allbooks: make([]*pb.BookObj, 0, len(v))}
+		for _, b := range v {
+			all.Allbooks = append(all.Allbooks, bookToProto(b))
+		}
+		return all
+	case []bookView:
+		all := &pb.AllBooks{Allbooks: make([]*pb.BookObj, 0, len(v))}
+		for _, b := range v {
+			all.Allbooks = append(all.Allbooks, viewToProto(b))
+		}
+		return all
+	case model.APIKey:
+		return apiKeyToProto(v)
+	case []model.APIKey:
+		keys := &pb.APIKeys{Keys: make([]*pb.APIKey, 0, len(v))}
+		for _, k := range v {
+			keys.Keys = append(keys.Keys, apiKeyToProto(k))
+		}
+		return keys
+	case string:
+		return wrapperspb.String(v)
+	default:
+		return data
+	}
+}
+
+func bookToProto(b model.Book) *pb.BookObj {
+	return &pb.BookObj{
+		Id:     b.ID.String(),
+		Title:  b.Title,
+		Author: b.Author,
+	}
+}
+
+func apiKeyToProto(k model.APIKey) *pb.APIKey {
+	return &pb.APIKey{
+		Id:         k.ID.String(),
+		Key:        k.Key,
+		Owner:      k.Owner,
+		Scopes:     k.Scopes,
+		ExpiresAt:  timestamp(k.ExpiresAt),
+		LastUsedAt: timestamp(k.LastUsedAt),
+		CreatedAt:  timestamppb.New(k.CreatedAt),
+		RevokedAt:  timestamp(k.RevokedAt),
+	}
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// viewToProto leaves the fields outside of the view unset.
+func viewToProto(v bookView) *pb.BookObj {
+	obj := &pb.BookObj{}
+	for i, value := range v.values() {
+		switch v.fields[i] {
+		case model.FieldID:
+			obj.Id = value
+		case model.FieldTitle:
+			obj.Title = value
+		case model.FieldAuthor:
+			obj.Author = value
+		}
+	}
+	return obj
+}
+
+func writeCSV(w http.ResponseWriter, data interface{}) error {
+	cw := csv.NewWriter(w)
+
+	switch v := data.(type) {
+	case model.Book:
+		cw.Write([]string{"id", "title", "author"})
+		cw.Write([]string{v.ID.String(), v.Title, v.Author})
+	case bookView:
+		cw.Write(v.fields)
+		cw.Write(v.values())
+	case []bookView:
+		if len(v) > 0 {
+			cw.Write(v[0].fields)
+		}
+		for _, b := range v {
+			cw.Write(b.values())
+		}
+	case []model.Book:
+		cw.Write([]string{"id", "title", "author"})
+		for _, b := range v {
+			cw.Write([]string{b.ID.String(), b.Title, b.Author})
+		}
+	case model.APIKey:
+		cw.Write(apiKeyColumns)
+		cw.Write(apiKeyRecord(v))
+	case []model.APIKey:
+		cw.Write(apiKeyColumns)
+		for _, k := range v {
+			cw.Write(apiKeyRecord(k))
+		}
+	case string:
+		cw.Write([]string{"message"})
+		cw.Write([]string{v})
+	default:
+		return errors.New("data can't be represented as csv")
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+var apiKeyColumns = []string{"id", "key", "owner", "scopes", "expires_at", "last_used_at", "created_at", "revoked_at"}
+
+// apiKeyRecord writes scopes space separated and times as RFC 3339, unset
+// times are empty.
+func apiKeyRecord(k model.APIKey) []string {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	return []string{
+		k.ID.String(),
+		k.Key,
+		k.Owner,
+		strings.Join(k.Scopes, " "),
+		formatTime(k.ExpiresAt),
+		formatTime(k.LastUsedAt),
+		formatTime(&k.CreatedAt),
+		formatTime(k.RevokedAt),
+	}
+}
+
+// bindBody decodes the request body according to its Content-Type and
+// validates the result, a missing Content-Type is treated as JSON.
+func bindBody(c *gin.Context, obj interface{}) error {
+	var b binding.Binding
+
+	switch c.ContentType() {
+	case "", binding.MIMEJSON:
+		b = binding.JSON
+	case binding.MIMEXML, binding.MIMEXML2:
+		b = binding.XML
+	case binding.MIMEYAML, mimeYAML:
+		b = binding.YAML
+	case binding.MIMEPROTOBUF, mimeProtobuf:
+		return bindProto(c, obj)
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedMediaType, c.ContentType())
+	}
+
+	if err := c.ShouldBindWith(obj, b); err != nil {
+		return bodyError(err)
+	}
+	return nil
+}
+
+func bindProto(c *gin.Context, obj interface{}) error {
+	var in pb.BookObj
+	if err := c.ShouldBindWith(&in, binding.ProtoBuf); err != nil {
+		return bodyError(err)
+	}
+
+	switch v := obj.(type) {
+	case *model.CreateBookInput:
+		v.Title, v.Author = in.Title, in.Author
+	case *model.UpdateBookInput:
+		v.Title, v.Author = in.Title, in.Author
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedMediaType, c.ContentType())
+	}
+
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// bodyError keeps validation errors as they are and marks everything else
+// as a body the decoder couldn't understand.
+func bodyError(err error) error {
+	var ve *validation.Error
+	if errors.As(err, &ve) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", errMalformedBody, err)
+}
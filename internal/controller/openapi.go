@@ -0,0 +1,418 @@
+package controller
+
+import (
+	"embed"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+
+	"gin_training/internal/auth"
+	"gin_training/internal/model"
+)
+
+// docsPage is the Swagger UI page served at /docs, it reads /openapi.json.
+//
+//go:embed docs.html
+var docsPage []byte
+
+// swaggerUI holds the Swagger UI assets the docs page loads, served by the
+// gateway itself, see swaggerui/README.md. A missing asset fails the build.
+//
+//go:generate sh -c "cd swaggerui && npm pack --silent swagger-ui-dist@5.18.2 | xargs tar -xzf && mv package/swagger-ui.css package/swagger-ui-bundle.js package/LICENSE . && rm -rf package swagger-ui-dist-*.tgz"
+//go:embed swaggerui/swagger-ui.css swaggerui/swagger-ui-bundle.js swaggerui/LICENSE
+var swaggerUI embed.FS
+
+// swaggerUIAssets are the files of swaggerUI served under /docs.
+var swaggerUIAssets = map[string]string{
+	"swagger-ui.css":       "text/css; charset=utf-8",
+	"swagger-ui-bundle.js": "text/javascript; charset=utf-8",
+}
+
+// apiDoc documents a route in the OpenAPI document.
+type apiDoc struct {
+	summary string
+	// body and response are values of the request body and of the data
+	// answered, their schemas are derived from their types. nil for none.
+	body, response interface{}
+	// status of a success, 200 when zero. created ones answer with the
+	// creation status of the version instead.
+	status  int
+	created bool
+	// read routes take a sparse fieldset and answer conditional requests,
+	// patch ones also take JSON Merge Patch and JSON Patch documents.
+	read, patch bool
+	// contentType of the routes answering outside of the API envelope.
+	contentType string
+}
+
+// bookDocs documents the book routes by name, for every version.
+var bookDocs = map[string]apiDoc{
+	"GET /books":        {summary: "List the books", response: []model.Book{}, read: true},
+	"GET /books/:id":    {summary: "Get a book", response: model.Book{}, read: true},
+	"POST /books":       {summary: "Create a book", body: model.CreateBookInput{}, response: model.Book{}, created: true},
+	"PATCH /books/:id":  {summary: "Update some fields of a book", body: model.UpdateBookInput{}, response: model.Book{}, patch: true},
+	"PUT /books/:id":    {summary: "Replace every field of a book", body: model.CreateBookInput{}, response: model.Book{}},
+	"DELETE /books/:id": {summary: "Delete a book", response: ""},
+}
+
+// adminDocs documents the API key routes.
+var adminDocs = map[string]apiDoc{
+	"POST /admin/api-keys": {
+		summary:  "Create an API key, the plaintext key is only part of this response",
+		body:     model.CreateAPIKeyInput{},
+		response: model.APIKey{},
+		status:   http.StatusCreated,
+	},
+	"GET /admin/api-keys":        {summary: "List every API key, revoked ones included", response: []model.APIKey{}},
+	"DELETE /admin/api-keys/:id": {summary: "Revoke an API key", response: ""},
+}
+
+// requestFormats lists the media types of the request bodies, protobuf
+// ones are pb.BookObj messages.
+var requestFormats = []string{binding.MIMEJSON, binding.MIMEXML, binding.MIMEXML2, binding.MIMEYAML, mimeYAML, binding.MIMEPROTOBUF, mimeProtobuf}
+
+// described tells whether the schemas apply to the bodies of format, they
+// do to JSON and YAML ones.
+func described(format string) bool {
+	switch format {
+	case binding.MIMEJSON, binding.MIMEYAML, mimeYAML:
+		return true
+	default:
+		return false
+	}
+}
+
+// openAPI describes the routes served by cr as an OpenAPI 3.1 document. The
+// schemas are derived from the model types, their JSON names and binding
+// rules.
+func (cr *Controller) openAPI() gin.H {
+	s := schemas{}
+	paths := map[string]gin.H{}
+	add := func(method, path, tag string, doc apiDoc, op gin.H) {
+		key := openAPIPath(path)
+		if paths[key] == nil {
+			paths[key] = gin.H{}
+		}
+		op["summary"] = doc.summary
+		op["tags"] = []string{tag}
+		op["operationId"] = operationID(method, path)
+		if params := append(pathParams(path), op["parameters"].([]gin.H)...); len(params) > 0 {
+			op["parameters"] = params
+		} else {
+			delete(op, "parameters")
+		}
+		paths[key][strings.ToLower(method)] = op
+	}
+
+	for _, rt := range cr.bookRoutes() {
+		doc := bookDocs[rt.method+" "+rt.path]
+		add(rt.method, v1.prefix+rt.path, "books", doc, cr.operation(s, v1, doc, rt.scope))
+		if rt.legacy != "" {
+			op := cr.operation(s, legacy, doc, rt.scope)
+			desc, _ := op["description"].(string)
+			op["deprecated"] = true
+			op["description"] = strings.TrimSpace("Deprecated alias of " + rt.method + " " + openAPIPath(v1.prefix+rt.path) +
+				", answered with the Deprecation, Sunset and Link headers. " + desc)
+			add(rt.method, rt.legacy, "legacy", doc, op)
+		}
+	}
+	if cr.keys != nil {
+		for name, doc := range adminDocs {
+			method, path, _ := strings.Cut(name, " ")
+			add(method, path, "admin", doc, cr.operation(s, v1, doc, auth.ScopeAdmin))
+		}
+	}
+
+	// The public routes outside of the API.
+	public := func(path, summary, contentType string) {
+		doc := apiDoc{summary: summary, contentType: contentType}
+		add(http.MethodGet, path, "operations", doc, cr.operation(s, v1, doc, ""))
+	}
+	if cr.health != nil {
+		public("/healthz", "Liveness probe", "application/json")
+		public("/readyz", "Readiness probe, 503 until the storage answers", "application/json")
+	}
+	public("/openapi.json", "This document", "application/json")
+	public("/docs", "Swagger UI of this document", "text/html")
+	for file, contentType := range swaggerUIAssets {
+		public("/docs/"+file, "Asset of the Swagger UI", strings.Split(contentType, ";")[0])
+	}
+
+	s.ref(reflect.TypeOf(Problem{}))
+	return gin.H{
+		"openapi": "3.1.0",
+		"info": gin.H{
+			"title":   "Books API",
+			"version": strings.TrimPrefix(v1.prefix, "/"),
+			"description": "Responses are negotiated with the Accept header: JSON (default), XML, YAML, CSV or protobuf, " +
+				"and carry their data in a data member. Errors are RFC 7807 problem details.",
+		},
+		"paths": paths,
+		"components": gin.H{
+			"schemas": s,
+			"responses": gin.H{
+				"Problem": gin.H{
+					"description": "The request failed",
+					"content":     gin.H{mimeProblemJSON: gin.H{"schema": gin.H{"$ref": "#/components/schemas/Problem"}}},
+				},
+			},
+			"securitySchemes": cr.securitySchemes(),
+		},
+	}
+}
+
+// operation documents a route of version v, scope is the one it needs,
+// empty for public routes.
+func (cr *Controller) operation(s schemas, v *version, doc apiDoc, scope string) gin.H {
+	op := gin.H{"parameters": []gin.H{}}
+	if doc.contentType != "" {
+		op["responses"] = gin.H{"200": gin.H{"description": "OK", "content": gin.H{doc.contentType: gin.H{}}}}
+		return op
+	}
+
+	if doc.read {
+		op["parameters"] = []gin.H{{
+			"name":        "fields",
+			"in":          "query",
+			"description": "Comma separated fields to answer with, the others are left out: " + strings.Join(model.BookFields, ", "),
+			"schema":      gin.H{"type": "string"},
+		}}
+	}
+	if doc.body != nil {
+		schema := gin.H{"schema": s.of(reflect.TypeOf(doc.body))}
+		content := gin.H{}
+		for _, f := range requestFormats {
+			content[f] = gin.H{}
+			if described(f) {
+				content[f] = schema
+			}
+		}
+		if doc.patch {
+			content[mimeMergePatch] = schema
+			content[mimeJSONPatch] = gin.H{"schema": jsonPatchSchema}
+		}
+		op["requestBody"] = gin.H{"required": true, "content": content}
+	}
+
+	status := doc.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if doc.created {
+		status = v.createdStatus
+	}
+	success := gin.H{
+		"description": http.StatusText(status),
+		"content":     responseContent(s, doc.response),
+	}
+	headers := gin.H{}
+	if doc.created && status == http.StatusCreated {
+		headers["Location"] = gin.H{"description": "URL of the book", "schema": gin.H{"type": "string"}}
+	}
+	responses := gin.H{strconv.Itoa(status): success, "default": gin.H{"$ref": "#/components/responses/Problem"}}
+	if doc.read && cr.caching != nil {
+		headers["ETag"] = gin.H{"schema": gin.H{"type": "string"}}
+		headers["Last-Modified"] = gin.H{"schema": gin.H{"type": "string"}}
+		for _, h := range []string{"If-None-Match", "If-Modified-Since"} {
+			op["parameters"] = append(op["parameters"].([]gin.H), gin.H{"name": h, "in": "header", "schema": gin.H{"type": "string"}})
+		}
+		responses["304"] = gin.H{"description": "Not Modified, the ETag or date still match"}
+	}
+	if len(headers) > 0 {
+		success["headers"] = headers
+	}
+	op["responses"] = responses
+
+	if security := cr.security(); scope != "" && len(security) > 0 {
+		op["security"] = security
+		op["description"] = "Needs the " + scope + " scope."
+	}
+	return op
+}
+
+// responseContent describes the data answered in every format.
+func responseContent(s schemas, data interface{}) gin.H {
+	schema := gin.H{"schema": gin.H{
+		"type":       "object",
+		"required":   []string{"data"},
+		"properties": gin.H{"data": s.of(reflect.TypeOf(data))},
+	}}
+	content := gin.H{}
+	for _, f := range offeredFormats {
+		content[f] = gin.H{}
+		if described(f) {
+			content[f] = schema
+		}
+	}
+	return content
+}
+
+func (cr *Controller) securitySchemes() gin.H {
+	schemes := gin.H{}
+	if cr.verifier != nil {
+		schemes["bearer"] = gin.H{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"}
+	}
+	if cr.keys != nil {
+		schemes["apiKey"] = gin.H{"type": "apiKey", "in": "header", "name": apiKeyHeader}
+	}
+	return schemes
+}
+
+// security lists the alternative credentials, none when the API is open.
+func (cr *Controller) security() []gin.H {
+	var security []gin.H
+	if cr.verifier != nil {
+		security = append(security, gin.H{"bearer": []string{}})
+	}
+	if cr.keys != nil {
+		security = append(security, gin.H{"apiKey": []string{}})
+	}
+	return security
+}
+
+// jsonPatchSchema describes an RFC 6902 JSON Patch.
+var jsonPatchSchema = gin.H{
+	"type": "array",
+	"items": gin.H{
+		"type":     "object",
+		"required": []string{"op", "path"},
+		"properties": gin.H{
+			"op":    gin.H{"type": "string", "enum": []string{"add", "remove", "replace", "test"}},
+			"path":  gin.H{"type": "string"},
+			"value": gin.H{"type": []string{"string", "null"}},
+		},
+	},
+}
+
+// openAPIPath turns the parameters of a gin path, e.g. /books/:id, into
+// OpenAPI ones, /books/{id}.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// pathParams documents the parameters of a gin path, every one is a UUID.
+func pathParams(path string) []gin.H {
+	var params []gin.H
+	for _, s := range strings.Split(path, "/") {
+		if strings.HasPrefix(s, ":") {
+			params = append(params, gin.H{"name": s[1:], "in": "path", "required": true, "schema": gin.H{"type": "string", "format": "uuid"}})
+		}
+	}
+	return params
+}
+
+// operationID names an operation after its method and path, e.g.
+// getV1BooksId.
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, s := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == ':' || r == '-' || r == '.' }) {
+		id += strings.ToUpper(s[:1]) + s[1:]
+	}
+	return id
+}
+
+var (
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// schemas holds the component schemas, by type name.
+type schemas gin.H
+
+// of returns the schema of t, structs are referenced from the components.
+func (s schemas) of(t reflect.Type) gin.H {
+	switch t {
+	case uuidType:
+		return gin.H{"type": "string", "format": "uuid"}
+	case timeType:
+		return gin.H{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.of(t.Elem())
+	case reflect.String:
+		return gin.H{"type": "string"}
+	case reflect.Int, reflect.Int64:
+		return gin.H{"type": "integer"}
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.Slice:
+		return gin.H{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Struct:
+		return s.ref(t)
+	default:
+		return gin.H{}
+	}
+}
+
+// ref registers the schema of the struct t and references it. Fields are
+// required by their binding rules, or unless omitted when empty for the
+// types that aren't bound from requests.
+func (s schemas) ref(t reflect.Type) gin.H {
+	ref := gin.H{"$ref": "#/components/schemas/" + t.Name()}
+	if _, ok := s[t.Name()]; ok {
+		return ref
+	}
+	s[t.Name()] = gin.H{}
+
+	bound := false
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := t.Field(i).Tag.Lookup("binding"); ok {
+			bound = true
+		}
+	}
+
+	properties := gin.H{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		schema := s.of(f.Type)
+		rules := strings.Split(f.Tag.Get("binding"), ",")
+		for _, rule := range rules {
+			key, arg, _ := strings.Cut(rule, "=")
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				continue
+			}
+			switch {
+			case key == "max" && f.Type.Kind() == reflect.String:
+				schema["maxLength"] = n
+			case key == "min" && f.Type.Kind() == reflect.Slice:
+				schema["minItems"] = n
+			}
+		}
+		properties[name] = schema
+
+		if bound && rules[0] == "required" || !bound && !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := gin.H{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	s[t.Name()] = schema
+	return ref
+}
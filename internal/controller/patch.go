@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gin_training/internal/model"
+)
+
+// Patch document media types accepted by PATCH /books/:id.
+const (
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+)
+
+// mergePatch turns an RFC 7386 JSON Merge Patch into a masked update, every
+// member of the document is written and null clears the field.
+func mergePatch(body []byte) (model.UpdateBookInput, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return model.UpdateBookInput{}, fmt.Errorf("%w: merge patch must be a JSON object", errMalformedBody)
+	}
+
+	var in model.UpdateBookInput
+	for field, raw := range doc {
+		value, err := patchValue(field, raw)
+		if err != nil {
+			return model.UpdateBookInput{}, err
+		}
+		setField(&in, field, value)
+		in.Fields = append(in.Fields, field)
+	}
+	sort.Strings(in.Fields)
+
+	return in, nil
+}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// jsonPatch applies an RFC 6902 JSON Patch to the current book and returns
+// the masked update writing every field the operations touched. A failed
+// "test" operation aborts the whole patch.
+func jsonPatch(body []byte, current model.Book) (model.UpdateBookInput, error) {
+	var ops []patchOperation
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return model.UpdateBookInput{}, fmt.Errorf("%w: JSON patch must be an array of operations", errMalformedBody)
+	}
+
+	doc := map[string]string{
+		"id":              current.ID.String(),
+		model.FieldTitle:  current.Title,
+		model.FieldAuthor: current.Author,
+	}
+	touched := map[string]bool{}
+
+	for i, op := range ops {
+		path, err := patchPath(op.Path)
+		if err != nil {
+			return model.UpdateBookInput{}, fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		switch op.Op {
+		case "add", "replace":
+			value, err := patchValue(path, op.Value)
+			if err != nil {
+				return model.UpdateBookInput{}, err
+			}
+			doc[path] = value
+			touched[path] = true
+		case "remove":
+			doc[path] = ""
+			touched[path] = true
+		case "test":
+			value, err := patchValue(path, op.Value)
+			if err != nil {
+				return model.UpdateBookInput{}, err
+			}
+			if doc[path] != value {
+				return model.UpdateBookInput{}, fmt.Errorf("%w: operation %d: %s doesn't match", errPatchConflict, i, op.Path)
+			}
+		case "copy", "move":
+			from, err := patchPath(op.From)
+			if err != nil {
+				return model.UpdateBookInput{}, fmt.Errorf("operation %d: %w", i, err)
+			}
+			doc[path] = doc[from]
+			touched[path] = true
+			if op.Op == "move" {
+				doc[from] = ""
+				touched[from] = true
+			}
+		default:
+			return model.UpdateBookInput{}, fmt.Errorf("%w: operation %d: unknown op %q", errMalformedBody, i, op.Op)
+		}
+	}
+
+	in := model.UpdateBookInput{
+		Title:  doc[model.FieldTitle],
+		Author: doc[model.FieldAuthor],
+	}
+	for field := range touched {
+		in.Fields = append(in.Fields, field)
+	}
+	sort.Strings(in.Fields)
+
+	return in, nil
+}
+
+// patchPath resolves a JSON pointer to a top level member of the book.
+func patchPath(pointer string) (string, error) {
+	if !strings.HasPrefix(pointer, "/") || strings.Count(pointer, "/") != 1 {
+		return "", fmt.Errorf("%w: unsupported path %q", errMalformedBody, pointer)
+	}
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(pointer[1:]), nil
+}
+
+// patchValue decodes a patched member, null is the same as an empty string.
+func patchValue(field string, raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", &fieldsError{err: errMalformedBody, fields: []FieldError{{Field: field, Detail: "must be a string or null"}}}
+	}
+	return value, nil
+}
+
+func setField(in *model.UpdateBookInput, field, value string) {
+	switch field {
+	case model.FieldTitle:
+		in.Title = value
+	case model.FieldAuthor:
+		in.Author = value
+	}
+}
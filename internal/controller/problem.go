@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"gin_training/internal/logging"
+	storage "gin_training/internal/storage/postgreSQL"
+	"gin_training/internal/validation"
+)
+
+const mimeProblemJSON = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// RequestID is the X-Request-ID of the request, to look up its logs.
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes a single invalid field of the request.
+type FieldError struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+// Errors raised by the controller itself, storage errors come from the
+// storage package.
+var (
+	errNotAcceptable        = errors.New("not acceptable")
+	errUnsupportedMediaType = errors.New("unsupported media type")
+	errMalformedBody        = errors.New("malformed request body")
+	errInvalidID            = errors.New("invalid ID")
+	errPatchConflict        = errors.New("patch test failed")
+	errUnauthenticated      = errors.New("unauthenticated")
+	errForbidden            = errors.New("forbidden")
+	errRateLimited          = errors.New("rate limit exceeded")
+)
+
+// fieldsError carries field level details of a rejected request.
+type fieldsError struct {
+	err    error
+	fields []FieldError
+}
+
+func (e *fieldsError) Error() string { return e.err.Error() }
+func (e *fieldsError) Unwrap() error { return e.err }
+
+// problems renders the last error attached to the gin context as
+// application/problem+json, handlers only need to call c.Error and return.
+func problems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		p := problemFor(c.Errors.Last().Err)
+		p.Instance = c.Request.URL.Path
+		p.RequestID, _ = logging.RequestIDFromContext(c.Request.Context())
+
+		c.Header("Content-Type", mimeProblemJSON)
+		c.AbortWithStatusJSON(p.Status, p)
+	}
+}
+
+func problemFor(err error) Problem {
+	var fe *fieldsError
+	if errors.As(err, &fe) {
+		p := newProblem(http.StatusBadRequest, "validation-error", "Your request parameters didn't validate.")
+		p.Detail = fe.Error()
+		p.Errors = fe.fields
+		return p
+	}
+
+	var ve *validation.Error
+	if errors.As(err, &ve) {
+		p := newProblem(http.StatusBadRequest, "validation-error", "Your request parameters didn't validate.")
+		for _, v := range ve.Violations {
+			p.Errors = append(p.Errors, FieldError{Field: v.Field, Detail: v.Description})
+		}
+		return p
+	}
+
+	switch {
+	case errors.Is(err, errUnauthenticated):
+		p := newProblem(http.StatusUnauthorized, "unauthenticated", "Authentication required.")
+		p.Detail = err.Error()
+		return p
+	case errors.Is(err, errForbidden), errors.Is(err, storage.ErrPermissionDenied):
+		p := newProblem(http.StatusForbidden, "forbidden", "Not allowed.")
+		p.Detail = err.Error()
+		return p
+	case errors.Is(err, errRateLimited), errors.Is(err, storage.ErrRateLimited):
+		return newProblem(http.StatusTooManyRequests, "rate-limited", "Too many requests.")
+	case errors.Is(err, errNotAcceptable):
+		p := newProblem(http.StatusNotAcceptable, "not-acceptable", "Not acceptable.")
+		p.Detail = "supported formats: " + strings.Join(offeredFormats, ", ")
+		return p
+	case errors.Is(err, errUnsupportedMediaType):
+		p := newProblem(http.StatusUnsupportedMediaType, "unsupported-media-type", "Unsupported media type.")
+		p.Detail = err.Error()
+		return p
+	case errors.Is(err, errMalformedBody):
+		p := newProblem(http.StatusBadRequest, "malformed-body", "Request body couldn't be decoded.")
+		p.Detail = err.Error()
+		return p
+	case errors.Is(err, errPatchConflict), errors.Is(err, storage.ErrConflict):
+		p := newProblem(http.StatusConflict, "patch-conflict", "Patch doesn't apply to the current book.")
+		p.Detail = err.Error()
+		return p
+	case errors.Is(err, storage.ErrNotFound):
+		p := newProblem(http.StatusNotFound, "not-found", "Book not found.")
+		p.Detail = err.Error()
+		return p
+	case errors.Is(err, storage.ErrInvalidArgument):
+		p := newProblem(http.StatusBadRequest, "invalid-argument", "Invalid argument.")
+		p.Detail = err.Error()
+		return p
+	case errors.Is(err, storage.ErrUnavailable):
+		p := newProblem(http.StatusServiceUnavailable, "unavailable", "Storage is temporarily unavailable.")
+		p.Detail = err.Error()
+		return p
+	default:
+		return newProblem(http.StatusInternalServerError, "internal", "Internal server error.")
+	}
+}
+
+func newProblem(status int, kind, title string) Problem {
+	return Problem{
+		Type:   "/problems/" + kind,
+		Title:  title,
+		Status: status,
+	}
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+
+	"gin_training/internal/model"
+)
+
+// bookView renders only the fields of a sparse fieldset, in the same order
+// as a full book.
+type bookView struct {
+	book   model.Book
+	fields []string
+}
+
+// readMask parses the "fields" query parameter, e.g. ?fields=id,title.
+func readMask(c *gin.Context) (model.ReadMask, error) {
+	param := c.Query("fields")
+	if param == "" {
+		return nil, nil
+	}
+
+	var mask model.ReadMask
+	for _, f := range strings.Split(param, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			mask = append(mask, f)
+		}
+	}
+
+	return mask, mask.Validate()
+}
+
+// project wraps books in views when a sparse fieldset was requested and
+// returns them untouched otherwise.
+func project(data interface{}, mask model.ReadMask) interface{} {
+	if len(mask) == 0 {
+		return data
+	}
+
+	fields := mask.Fields()
+
+	switch v := data.(type) {
+	case model.Book:
+		return bookView{book: v, fields: fields}
+	case []model.Book:
+		views := make([]bookView, 0, len(v))
+		for _, b := range v {
+			views = append(views, bookView{book: b, fields: fields})
+		}
+		return views
+	default:
+		return data
+	}
+}
+
+// values returns the string form of the viewed fields.
+func (v bookView) values() []string {
+	values := make([]string, 0, len(v.fields))
+	for _, f := range v.fields {
+		switch f {
+		case model.FieldID:
+			values = append(values, v.book.ID.String())
+		case model.FieldTitle:
+			values = append(values, v.book.Title)
+		case model.FieldAuthor:
+			values = append(values, v.book.Author)
+		}
+	}
+	return values
+}
+
+func (v bookView) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+	for i, value := range v.values() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(v.fields[i])
+		val, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func (v bookView) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for i, value := range v.values() {
+		if err := e.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: v.fields[i]}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+func (v bookView) MarshalYAML() (interface{}, error) {
+	m := make(yaml.MapSlice, 0, len(v.fields))
+	for i, value := range v.values() {
+		m = append(m, yaml.MapItem{Key: v.fields[i], Value: value})
+	}
+	return m, nil
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gin_training/internal/auth"
+	"gin_training/internal/model"
+	"gin_training/internal/rbac"
+)
+
+// versionKey is the gin context key holding the API version of the route.
+const versionKey = "version"
+
+// routeKey is the gin context key holding the name of the route shared by
+// its versions, e.g. "GET /books/:id".
+const routeKey = "route"
+
+// legacyDeprecated is when the unversioned routes were deprecated, by the
+// introduction of /v1.
+var legacyDeprecated = time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+// version is one version of the book API. The versions share the handlers,
+// which leave the shape of what they send back to the version of the route,
+// so a version can change it without touching the others.
+type version struct {
+	// prefix of the routes, empty for the unversioned ones.
+	prefix string
+	// respond writes the book, books or message a handler answers with.
+	respond func(c *gin.Context, code int, data interface{})
+	// createdStatus answers the creation of a book, a 201 Created comes
+	// with the Location of the book.
+	createdStatus int
+}
+
+var (
+	// legacy is the unversioned API predating /v1, its create answers 200.
+	legacy = &version{respond: respond, createdStatus: http.StatusOK}
+	v1     = &version{prefix: "/v1", respond: respond, createdStatus: http.StatusCreated}
+)
+
+// created answers the book created by the request.
+func (v *version) created(c *gin.Context, b model.Book) {
+	if v.createdStatus == http.StatusCreated {
+		c.Header("Location", v.prefix+"/books/"+b.ID.String())
+	}
+	v.respond(c, v.createdStatus, b)
+}
+
+// bookRoute is a route of the book API, registered under every version.
+type bookRoute struct {
+	method string
+	// path within a version, and the path of the unversioned route kept
+	// for the clients predating /v1, empty when there is none.
+	path, legacy string
+	scope        string
+	op           rbac.Operation
+	handler      gin.HandlerFunc
+}
+
+func (cr *Controller) bookRoutes() []bookRoute {
+	return []bookRoute{
+		{http.MethodGet, "/books", "/books", auth.ScopeRead, rbac.OpList, cr.AllBooks},
+		{http.MethodGet, "/books/:id", "/books/:id", auth.ScopeRead, rbac.OpGet, cr.FindBook},
+		{http.MethodPost, "/books", "/create", auth.ScopeWrite, rbac.OpCreate, cr.CreateBook},
+		{http.MethodPatch, "/books/:id", "/books/:id", auth.ScopeWrite, rbac.OpUpdate, cr.UpdateBook},
+		{http.MethodPut, "/books/:id", "/books/:id", auth.ScopeWrite, rbac.OpUpdate, cr.ReplaceBook},
+		{http.MethodDelete, "/books/:id", "/books/:id", auth.ScopeWrite, rbac.OpDelete, cr.DeleteBook},
+	}
+}
+
+// handleBooks registers the book routes of v1, and their unversioned
+// aliases marked as deprecated in favour of them. The routes are named
+// without their version, the aliases share the rate limits of their
+// successor.
+func (cr *Controller) handleBooks(r gin.IRoutes) {
+	for _, rt := range cr.bookRoutes() {
+		name := rt.method + " " + rt.path
+		chain := []gin.HandlerFunc{cr.throttleIP(), cr.authorize(rt.scope), cr.rateLimit(), cr.permit(rt.op), rt.handler}
+
+		r.Handle(rt.method, v1.prefix+rt.path, append([]gin.HandlerFunc{use(v1, name)}, chain...)...)
+		if rt.legacy != "" {
+			r.Handle(rt.method, rt.legacy, append([]gin.HandlerFunc{use(legacy, name), cr.deprecated(v1.prefix + rt.path)}, chain...)...)
+		}
+	}
+}
+
+// use sets the version and the name of the route.
+func use(v *version, name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(versionKey, v)
+		c.Set(routeKey, name)
+	}
+}
+
+// versionOf returns the version of the route, v1 outside the book routes.
+func versionOf(c *gin.Context) *version {
+	if v, ok := c.Get(versionKey); ok {
+		return v.(*version)
+	}
+	return v1
+}
+
+// deprecated tells the clients of a legacy route since when it is
+// deprecated (RFC 9745), until when it is served (RFC 8594) and where its
+// successor is.
+func (cr *Controller) deprecated(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", fmt.Sprintf("@%d", legacyDeprecated.Unix()))
+		if !cr.sunset.IsZero() {
+			c.Header("Sunset", cr.sunset.UTC().Format(http.TimeFormat))
+		}
+		c.Header("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, expand(successor, c.Params)))
+	}
+}
+
+// expand fills the parameters of a route path, e.g. /v1/books/:id, with
+// their values.
+func expand(path string, params gin.Params) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = params.ByName(s[1:])
+		}
+	}
+	return strings.Join(segments, "/")
+}
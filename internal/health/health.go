@@ -0,0 +1,170 @@
+// Package health runs the dependency checks behind the liveness and
+// readiness endpoints of both services and the gRPC health service.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Statuses of a Report and of its checks.
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check probes a dependency, detail describes its state whether it's up or
+// not.
+type Check func(ctx context.Context) (detail string, err error)
+
+// Result is the outcome of a single check.
+type Result struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the outcome of every check, the service is ready when all of
+// them are up.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready reports whether every check is up.
+func (r Report) Ready() bool {
+	return r.Status == StatusUp
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the registered checks, each bounded by the timeout.
+type Checker struct {
+	timeout  time.Duration
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+// NewChecker returns a Checker giving every check timeout to answer.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers check under name, it must be called before the Checker is
+// used.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Drain reports the service down from now on, so load balancers stop
+// sending it requests before it shuts down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Run runs every check concurrently.
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		report = Report{Status: StatusUp, Checks: make(map[string]Result, len(c.checks))}
+	)
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+
+			detail, err := nc.check(ctx)
+			res := Result{Status: StatusUp, Detail: detail}
+			if err != nil {
+				res.Status = StatusDown
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[nc.name] = res
+			if err != nil {
+				report.Status = StatusDown
+			}
+		}(nc)
+	}
+	wg.Wait()
+
+	if c.draining.Load() {
+		report.Status = StatusDown
+		report.Checks["shutdown"] = Result{Status: StatusDown, Error: "shutting down"}
+	}
+
+	return report
+}
+
+// LiveHandler answers 200 as long as the process serves HTTP, it doesn't
+// look at the dependencies so a database outage doesn't get it restarted.
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": StatusUp})
+	})
+}
+
+// ReadyHandler runs the checks and answers 200 with the report when they're
+// all up, 503 otherwise.
+func ReadyHandler(c *Checker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		code := http.StatusOK
+		if !report.Ready() {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Watch runs the checks every interval until ctx is done and reports them
+// to srv: the server as a whole ("") and every service are SERVING while
+// the checks are up and NOT_SERVING otherwise.
+func Watch(ctx context.Context, c *Checker, srv *health.Server, interval time.Duration, services ...string) {
+	names := append([]string{""}, services...)
+
+	update := func() {
+		status := healthpb.HealthCheckResponse_SERVING
+		if !c.Run(ctx).Ready() {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		for _, name := range names {
+			srv.SetServingStatus(name, status)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		update()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func up(detail string) Check {
+	return func(context.Context) (string, error) { return detail, nil }
+}
+
+func down(err error) Check {
+	return func(context.Context) (string, error) { return "", err }
+}
+
+func TestChecker_Run(t *testing.T) {
+	slow := func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	tests := []struct {
+		name   string
+		checks map[string]Check
+		want   Report
+	}{
+		{
+			name:   "Up",
+			checks: map[string]Check{"database": up(""), "migrations": up("2 of 2 migrations applied")},
+			want: Report{Status: StatusUp, Checks: map[string]Result{
+				"database":   {Status: StatusUp},
+				"migrations": {Status: StatusUp, Detail: "2 of 2 migrations applied"},
+			}},
+		},
+		{
+			name:   "One down",
+			checks: map[string]Check{"database": up(""), "grpc": down(errors.New("connection refused"))},
+			want: Report{Status: StatusDown, Checks: map[string]Result{
+				"database": {Status: StatusUp},
+				"grpc":     {Status: StatusDown, Error: "connection refused"},
+			}},
+		},
+		{
+			name:   "Timeout",
+			checks: map[string]Check{"database": slow},
+			want: Report{Status: StatusDown, Checks: map[string]Result{
+				"database": {Status: StatusDown, Error: "context deadline exceeded"},
+			}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewChecker(10 * time.Millisecond)
+			for name, check := range tc.checks {
+				c.Add(name, check)
+			}
+			assert.Equal(t, tc.want, c.Run(context.Background()))
+		})
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	rr := httptest.NewRecorder()
+	LiveHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"up"}`, rr.Body.String())
+
+	var healthy bool
+	c := NewChecker(time.Second)
+	c.Add("database", func(context.Context) (string, error) {
+		if !healthy {
+			return "", errors.New("unreachable")
+		}
+		return "", nil
+	})
+
+	rr = httptest.NewRecorder()
+	ReadyHandler(c).ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+	var report Report
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+	assert.Equal(t, Result{Status: StatusDown, Error: "unreachable"}, report.Checks["database"])
+
+	healthy = true
+	rr = httptest.NewRecorder()
+	ReadyHandler(c).ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"up","checks":{"database":{"status":"up"}}}`, rr.Body.String())
+}
+
+func TestWatch(t *testing.T) {
+	var healthy atomic.Bool
+	c := NewChecker(time.Second)
+	c.Add("database", func(context.Context) (string, error) {
+		if !healthy.Load() {
+			return "", errors.New("unreachable")
+		}
+		return "", nil
+	})
+
+	srv := health.NewServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, c, srv, 5*time.Millisecond, "proto.BookService")
+
+	status := func(service string) func() bool {
+		return func() bool {
+			res, err := srv.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+			return err == nil && res.GetStatus() == healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	assert.Eventually(t, status(""), time.Second, time.Millisecond)
+	assert.Eventually(t, status("proto.BookService"), time.Second, time.Millisecond)
+
+	healthy.Store(true)
+	assert.Eventually(t, func() bool {
+		res, err := srv.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "proto.BookService"})
+		return err == nil && res.GetStatus() == healthpb.HealthCheckResponse_SERVING
+	}, time.Second, time.Millisecond)
+}
+
+func TestChecker_Drain(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("database", up(""))
+	assert.True(t, c.Run(context.Background()).Ready())
+
+	c.Drain()
+	assert.Equal(t, Report{Status: StatusDown, Checks: map[string]Result{
+		"database": {Status: StatusUp},
+		"shutdown": {Status: StatusDown, Error: "shutting down"},
+	}}, c.Run(context.Background()))
+}
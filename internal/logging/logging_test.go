@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo).With("service", "books")
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}})
+	ctx := trace.ContextWithSpanContext(WithRequestID(context.Background(), "req-1"), sc)
+
+	logger.DebugContext(ctx, "dropped")
+	logger.InfoContext(ctx, "book created", "book_id", "42")
+	logger.Info("no context")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &line))
+	assert.Equal(t, "INFO", line["level"])
+	assert.Equal(t, "book created", line["msg"])
+	assert.Equal(t, "books", line["service"])
+	assert.Equal(t, "42", line["book_id"])
+	assert.Equal(t, "req-1", line["request_id"])
+	assert.Equal(t, "01000000000000000000000000000000", line["trace_id"])
+	assert.Equal(t, "0200000000000000", line["span_id"])
+
+	line = nil
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &line))
+	assert.NotContains(t, line, "request_id")
+	assert.NotContains(t, line, "trace_id")
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    slog.Level
+		wantErr bool
+	}{
+		{in: "", want: slog.LevelInfo},
+		{in: "debug", want: slog.LevelDebug},
+		{in: "WARN", want: slog.LevelWarn},
+		{in: "error", want: slog.LevelError},
+		{in: "verbose", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := ParseLevel(tc.in)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{name: "UUID", id: NewRequestID(), want: true},
+		{name: "Custom", id: "checkout-7f3a:retry.2", want: true},
+		{name: "Empty", id: ""},
+		{name: "Too long", id: strings.Repeat("a", 129)},
+		{name: "Space", id: "req 1"},
+		{name: "Newline", id: "req\n{\"level\":\"ERROR\"}"},
+		{name: "Non ASCII", id: "réq"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ValidRequestID(tc.id))
+		})
+	}
+}
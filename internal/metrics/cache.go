@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Cache holds the metrics of the book cache.
+type Cache struct {
+	lookups *prometheus.CounterVec
+}
+
+// NewCache registers the book cache metrics on reg.
+func NewCache(reg prometheus.Registerer) *Cache {
+	m := &Cache{
+		lookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "lookups_total",
+			Help:      "Book cache lookups by result (hit, negative_hit, shared_hit, miss).",
+		}, []string{"result"}),
+	}
+	reg.MustRegister(m.lookups)
+	return m
+}
+
+// Observe records a lookup.
+func (m *Cache) Observe(result string) {
+	m.lookups.WithLabelValues(result).Inc()
+}
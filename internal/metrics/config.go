@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reloads holds the metrics of the config reloads.
+type Reloads struct {
+	total       *prometheus.CounterVec
+	lastSuccess prometheus.Gauge
+}
+
+// NewReloads registers the config reload metrics on reg.
+func NewReloads(reg prometheus.Registerer) *Reloads {
+	m := &Reloads{
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "config",
+			Name:      "reloads_total",
+			Help:      "Config reloads by result, success or failure.",
+		}, []string{"result"}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "config",
+			Name:      "last_reload_success_timestamp_seconds",
+			Help:      "Time of the last config reload that was applied.",
+		}),
+	}
+	reg.MustRegister(m.total, m.lastSuccess)
+	return m
+}
+
+// Observe records a reload, err is nil when it was applied.
+func (m *Reloads) Observe(err error) {
+	if err != nil {
+		m.total.WithLabelValues("failure").Inc()
+		return
+	}
+	m.total.WithLabelValues("success").Inc()
+	m.lastSuccess.SetToCurrentTime()
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"gin_training/internal/model"
+	storage "gin_training/internal/storage/postgreSQL"
+)
+
+// DB holds the query metrics of the storage.
+type DB struct {
+	duration *prometheus.HistogramVec
+}
+
+// NewDB registers the query metrics on reg.
+func NewDB(reg prometheus.Registerer) *DB {
+	m := &DB{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "query_duration_seconds",
+			Help:      "Latency of storage queries by operation and outcome (ok, not_found, conflict, error).",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"operation", "outcome"}),
+	}
+	reg.MustRegister(m.duration)
+	return m
+}
+
+func (m *DB) observe(op string, start time.Time, err error) {
+	outcome := "ok"
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		outcome = "not_found"
+	case errors.Is(err, storage.ErrConflict):
+		outcome = "conflict"
+	case err != nil:
+		outcome = "error"
+	}
+	m.duration.WithLabelValues(op, outcome).Observe(time.Since(start).Seconds())
+}
+
+// Books times every call of db.
+func (m *DB) Books(db storage.DB) storage.DB {
+	return instrumentedBooks{db: db, m: m}
+}
+
+// APIKeys times every call of keys.
+func (m *DB) APIKeys(keys storage.APIKeyStore) storage.APIKeyStore {
+	return instrumentedKeys{keys: keys, m: m}
+}
+
+type instrumentedBooks struct {
+	db storage.DB
+	m  *DB
+}
+
+func (i instrumentedBooks) FindAll(ctx context.Context, mask model.ReadMask) ([]model.Book, model.Revision, error) {
+	start := time.Now()
+	books, r, err := i.db.FindAll(ctx, mask)
+	i.m.observe("find_all", start, err)
+	return books, r, err
+}
+
+func (i instrumentedBooks) Create(ctx context.Context, b model.Book) (model.Book, error) {
+	start := time.Now()
+	b, err := i.db.Create(ctx, b)
+	i.m.observe("create", start, err)
+	return b, err
+}
+
+func (i instrumentedBooks) GetBook(ctx context.Context, id string, mask model.ReadMask) (model.Book, error) {
+	start := time.Now()
+	b, err := i.db.GetBook(ctx, id, mask)
+	i.m.observe("get_book", start, err)
+	return b, err
+}
+
+func (i instrumentedBooks) UpdateBook(ctx context.Context, id string, in model.UpdateBookInput) (model.Book, error) {
+	start := time.Now()
+	b, err := i.db.UpdateBook(ctx, id, in)
+	i.m.observe("update_book", start, err)
+	return b, err
+}
+
+func (i instrumentedBooks) DeleteBook(ctx context.Context, id string) error {
+	start := time.Now()
+	err := i.db.DeleteBook(ctx, id)
+	i.m.observe("delete_book", start, err)
+	return err
+}
+
+func (i instrumentedBooks) CatalogRevision(ctx context.Context) (model.Revision, error) {
+	start := time.Now()
+	r, err := i.db.CatalogRevision(ctx)
+	i.m.observe("catalog_revision", start, err)
+	return r, err
+}
+
+func (i instrumentedBooks) BookRevision(ctx context.Context, id string) (model.Revision, error) {
+	start := time.Now()
+	r, err := i.db.BookRevision(ctx, id)
+	i.m.observe("book_revision", start, err)
+	return r, err
+}
+
+type instrumentedKeys struct {
+	keys storage.APIKeyStore
+	m    *DB
+}
+
+func (i instrumentedKeys) CreateAPIKey(ctx context.Context, in model.CreateAPIKeyInput) (model.APIKey, error) {
+	start := time.Now()
+	k, err := i.keys.CreateAPIKey(ctx, in)
+	i.m.observe("create_api_key", start, err)
+	return k, err
+}
+
+func (i instrumentedKeys) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	start := time.Now()
+	keys, err := i.keys.ListAPIKeys(ctx)
+	i.m.observe("list_api_keys", start, err)
+	return keys, err
+}
+
+func (i instrumentedKeys) RevokeAPIKey(ctx context.Context, id string) error {
+	start := time.Now()
+	err := i.keys.RevokeAPIKey(ctx, id)
+	i.m.observe("revoke_api_key", start, err)
+	return err
+}
+
+func (i instrumentedKeys) AuthenticateAPIKey(ctx context.Context, key string) (model.APIKey, error) {
+	start := time.Now()
+	k, err := i.keys.AuthenticateAPIKey(ctx, key)
+	i.m.observe("authenticate_api_key", start, err)
+	return k, err
+}
+
+func (i instrumentedKeys) FindAPIKey(ctx context.Context, key string) (model.APIKey, error) {
+	start := time.Now()
+	k, err := i.keys.FindAPIKey(ctx, key)
+	i.m.observe("find_api_key", start, err)
+	return k, err
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gin_training/internal/model"
+	storage "gin_training/internal/storage/postgreSQL"
+	"gin_training/internal/storage/postgreSQL/mocks"
+)
+
+func TestHTTP_Middleware(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewHTTP(reg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.GET("/books/:id", func(c *gin.Context) {
+		assert.Equal(t, 1.0, testutil.ToFloat64(m.inFlight))
+		c.Status(http.StatusNotFound)
+	})
+
+	for _, url := range []string{"/books/1", "/books/2", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "/books/:id", "404")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "unmatched", "404")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.inFlight))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.duration))
+}
+
+func TestGRPC_UnaryServerInterceptor(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewGRPC(reg)
+	interceptor := m.UnaryServerInterceptor()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/proto.BookService/GetBook"}
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	notFound := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "no book")
+	}
+
+	_, _ = interceptor(context.Background(), nil, info, ok)
+	_, _ = interceptor(context.Background(), nil, info, notFound)
+	_, _ = interceptor(context.Background(), nil, info, notFound)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues(info.FullMethod, "OK")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues(info.FullMethod, "NotFound")))
+}
+
+func TestDB_Books(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewDB(reg)
+
+	db := new(mocks.DB)
+	db.On("GetBook", mock.Anything, "found", model.ReadMask(nil)).Return(model.Book{Title: "title"}, nil)
+	db.On("GetBook", mock.Anything, "missing", model.ReadMask(nil)).Return(model.Book{}, storage.ErrNotFound)
+
+	books := m.Books(db)
+
+	b, err := books.GetBook(context.Background(), "found", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "title", b.Title)
+
+	_, err = books.GetBook(context.Background(), "missing", nil)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.duration))
+	assert.Equal(t, uint64(1), sampleCount(t, m.duration, "get_book", "ok"))
+	assert.Equal(t, uint64(1), sampleCount(t, m.duration, "get_book", "not_found"))
+}
+
+// sampleCount returns the number of observations of the histogram labeled
+// with values.
+func sampleCount(t *testing.T, h *prometheus.HistogramVec, values ...string) uint64 {
+	var metric dto.Metric
+	require.NoError(t, h.WithLabelValues(values...).(prometheus.Histogram).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestReloads_Observe(t *testing.T) {
+	m := NewReloads(prometheus.NewRegistry())
+
+	m.Observe(nil)
+	m.Observe(nil)
+	m.Observe(errors.New("invalid log level"))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.total.WithLabelValues("success")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.total.WithLabelValues("failure")))
+	assert.NotZero(t, testutil.ToFloat64(m.lastSuccess))
+}
+
+func TestCache_Observe(t *testing.T) {
+	m := NewCache(prometheus.NewRegistry())
+
+	m.Observe("hit")
+	m.Observe("hit")
+	m.Observe("miss")
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.lookups.WithLabelValues("hit")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.lookups.WithLabelValues("miss")))
+}
+
+func TestHandler(t *testing.T) {
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	reg := NewRegistry()
+	RegisterDBStats(reg, db)
+	NewHTTP(reg)
+
+	rr := httptest.NewRecorder()
+	Handler(reg).ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `go_sql_open_connections{db_name="books"}`)
+	assert.Contains(t, rr.Body.String(), "books_http_requests_in_flight 0")
+}
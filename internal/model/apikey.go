@@ -0,0 +1,54 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"gin_training/internal/auth"
+	"gin_training/internal/validation"
+)
+
+// APIKey identifies a machine client. Only a hash of the key is stored,
+// Key holds the plaintext once, in the response to its creation.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id" xml:"id" yaml:"id"`
+	Key        string     `json:"key,omitempty" xml:"key,omitempty" yaml:"key,omitempty"`
+	Owner      string     `json:"owner" xml:"owner" yaml:"owner"`
+	Scopes     []string   `json:"scopes" xml:"scope" yaml:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" xml:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" xml:"last_used_at,omitempty" yaml:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at" xml:"created_at" yaml:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" xml:"revoked_at,omitempty" yaml:"revoked_at,omitempty"`
+}
+
+// CreateAPIKeyInput describes a new key. Scopes are token scopes such as
+// books:read, roles are granted with role:<name>.
+type CreateAPIKeyInput struct {
+	Owner     string     `json:"owner" xml:"owner" yaml:"owner" binding:"required,notblank,nocontrol,max=100"`
+	Scopes    []string   `json:"scopes" xml:"scope" yaml:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at" xml:"expires_at" yaml:"expires_at"`
+}
+
+// Normalize trims and NFC-normalizes the input before validation.
+func (in *CreateAPIKeyInput) Normalize() {
+	in.Owner = validation.Normalize(in.Owner)
+	for i, s := range in.Scopes {
+		in.Scopes[i] = strings.TrimSpace(s)
+	}
+}
+
+// Check rejects unknown scopes and expiry dates in the past.
+func (in *CreateAPIKeyInput) Check() []validation.FieldViolation {
+	var violations []validation.FieldViolation
+	for _, s := range in.Scopes {
+		if !auth.ValidScope(s) {
+			violations = append(violations, validation.FieldViolation{Field: "scopes", Description: "unknown scope " + s})
+		}
+	}
+	if in.ExpiresAt != nil && !in.ExpiresAt.After(time.Now()) {
+		violations = append(violations, validation.FieldViolation{Field: "expires_at", Description: "must be in the future"})
+	}
+	return violations
+}
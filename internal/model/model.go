@@ -1,21 +1,150 @@
 package model
 
 import (
+	"time"
+
 	"github.com/google/uuid"
+
+	"gin_training/internal/validation"
+)
+
+// Names of the book fields, used as field mask paths.
+const (
+	FieldID     = "id"
+	FieldTitle  = "title"
+	FieldAuthor = "author"
 )
 
+// BookFields lists every field of a book in response order.
+var BookFields = []string{FieldID, FieldTitle, FieldAuthor}
+
+// UpdatableFields lists every field a full replacement writes.
+var UpdatableFields = []string{FieldTitle, FieldAuthor}
+
+// ReadMask lists the book fields to return, an empty mask returns them all.
+type ReadMask []string
+
+// Has reports whether field is returned.
+func (m ReadMask) Has(field string) bool {
+	if len(m) == 0 {
+		return true
+	}
+	for _, f := range m {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Fields returns the masked fields in response order.
+func (m ReadMask) Fields() []string {
+	var fields []string
+	for _, f := range BookFields {
+		if m.Has(f) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Validate rejects paths that aren't book fields.
+func (m ReadMask) Validate() error {
+	verr := &validation.Error{}
+	for _, f := range m {
+		switch f {
+		case FieldID, FieldTitle, FieldAuthor:
+		default:
+			verr.Violations = append(verr.Violations, validation.FieldViolation{Field: "fields", Description: "unknown field " + f})
+		}
+	}
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+	return nil
+}
+
 type Book struct {
-	ID     uuid.UUID `json:"id"`
-	Title  string    `json:"title"`
-	Author string    `json:"author"`
+	ID     uuid.UUID `json:"id" xml:"id" yaml:"id"`
+	Title  string    `json:"title" xml:"title" yaml:"title"`
+	Author string    `json:"author" xml:"author" yaml:"author"`
+	// Revision is only read by GetBook, it versions the HTTP responses and
+	// isn't part of them.
+	Revision Revision `json:"-" xml:"-" yaml:"-"`
+}
+
+// Revision tells when a book or the catalog last changed. Version grows
+// with every write, a zero Revision is unknown.
+type Revision struct {
+	Version   int64
+	UpdatedAt time.Time
 }
 
 type CreateBookInput struct {
-	Title  string `json:"title" binding:"required"`
-	Author string `json:"author" binding:"required"`
+	Title  string `json:"title" xml:"title" yaml:"title" binding:"required,notblank,nocontrol,max=150"`
+	Author string `json:"author" xml:"author" yaml:"author" binding:"required,notblank,nocontrol,max=50"`
+}
+
+// Normalize trims and NFC-normalizes the input before validation.
+func (in *CreateBookInput) Normalize() {
+	in.Title = validation.Normalize(in.Title)
+	in.Author = validation.Normalize(in.Author)
 }
 
+// UpdateBookInput writes the fields listed in Fields, an empty value clears
+// the field. Without Fields only the non-empty values are written.
 type UpdateBookInput struct {
-	Title  string `json:"title"`
-	Author string `json:"author"`
+	Title  string   `json:"title" xml:"title" yaml:"title" binding:"omitempty,nocontrol,max=150"`
+	Author string   `json:"author" xml:"author" yaml:"author" binding:"omitempty,nocontrol,max=50"`
+	Fields []string `json:"-" xml:"-" yaml:"-"`
+	// IfVersion, when not 0, only writes the book if its revision is still
+	// this version, the one the update was computed from.
+	IfVersion int64 `json:"-" xml:"-" yaml:"-"`
+}
+
+// Normalize trims and NFC-normalizes the input before validation.
+func (in *UpdateBookInput) Normalize() {
+	in.Title = validation.Normalize(in.Title)
+	in.Author = validation.Normalize(in.Author)
+}
+
+// Check rejects unknown or repeated mask paths and clearing the title, which
+// every book must have.
+func (in *UpdateBookInput) Check() []validation.FieldViolation {
+	var violations []validation.FieldViolation
+	seen := make(map[string]bool, len(in.Fields))
+	for _, f := range in.Fields {
+		if seen[f] {
+			violations = append(violations, validation.FieldViolation{Field: f, Description: "is listed more than once"})
+			continue
+		}
+		seen[f] = true
+
+		switch f {
+		case FieldTitle:
+			if in.Title == "" {
+				violations = append(violations, validation.FieldViolation{Field: FieldTitle, Description: "can't be cleared"})
+			}
+		case FieldAuthor:
+		default:
+			violations = append(violations, validation.FieldViolation{Field: f, Description: "is not an updatable field"})
+		}
+	}
+	return violations
+}
+
+// Mask returns the fields the update writes.
+func (in UpdateBookInput) Mask() []string {
+	if len(in.Fields) > 0 {
+		return in.Fields
+	}
+
+	var mask []string
+	if in.Title != "" {
+		mask = append(mask, FieldTitle)
+	}
+	if in.Author != "" {
+		mask = append(mask, FieldAuthor)
+	}
+	return mask
 }
@@ -0,0 +1,154 @@
+// Package mtls sets up mutual TLS between the HTTP gateway and the gRPC
+// storage, with certificates that are reloaded when their files change.
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"gin_training/internal/watch"
+)
+
+// Config lists the PEM files of a peer: its own certificate and key, and
+// the CA bundle its counterpart must be signed by.
+type Config struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// Enabled reports whether every file is set.
+func (c Config) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != "" && c.CAFile != ""
+}
+
+// Reloader holds the current certificate and CA pool. TLS configs built
+// from it pick up a reload on the next handshake, open connections keep the
+// certificates they were established with.
+type Reloader struct {
+	cfg    Config
+	bundle atomic.Pointer[bundle]
+}
+
+type bundle struct {
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+// NewReloader loads the files of cfg.
+func NewReloader(cfg Config) (*Reloader, error) {
+	if !cfg.Enabled() {
+		return nil, errors.New("certificate, key and CA files are required for mutual TLS")
+	}
+
+	r := &Reloader{cfg: cfg}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again, the current certificates are kept if any
+// of them is invalid.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("couldn't load certificate: %w", err)
+	}
+
+	ca, err := os.ReadFile(r.cfg.CAFile)
+	if err != nil {
+		return fmt.Errorf("couldn't read CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return fmt.Errorf("couldn't parse CA %s: no certificates", r.cfg.CAFile)
+	}
+
+	r.bundle.Store(&bundle{cert: &cert, pool: pool})
+	return nil
+}
+
+// Watch reloads the certificates whenever one of the files changes until
+// ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	reload := func() {
+		if err := r.Reload(); err != nil {
+			slog.Warn("keeping the current certificates", "error", err)
+			return
+		}
+		slog.Info("reloaded certificates", "file", r.cfg.CertFile)
+	}
+
+	for _, path := range []string{r.cfg.KeyFile, r.cfg.CAFile} {
+		go watch.File(ctx, path, interval, reload)
+	}
+	watch.File(ctx, r.cfg.CertFile, interval, reload)
+}
+
+// ServerConfig requires clients to present a certificate signed by the CA.
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			b := r.bundle.Load()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*b.cert},
+				ClientCAs:    b.pool,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			}, nil
+		},
+	}
+}
+
+// ClientConfig presents the client certificate and verifies that the server
+// certificate is valid for serverName and signed by the CA. The standard
+// verification only knows a fixed root pool, so it's replaced by one
+// against the current pool.
+func (r *Reloader) ClientConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.bundle.Load().cert, nil
+		},
+		InsecureSkipVerify: true, // verified by VerifyConnection
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("server presented no certificate")
+			}
+			opts := x509.VerifyOptions{
+				DNSName:       serverName,
+				Roots:         r.bundle.Load().pool,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}
+}
+
+// Identities returns the names a certificate vouches for: its URI and DNS
+// subject alternative names and its common name.
+func Identities(cert *x509.Certificate) []string {
+	var ids []string
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	ids = append(ids, cert.DNSNames...)
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	return ids
+}
@@ -0,0 +1,157 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a leaf certificate and key signed by ca to dir.
+func (ca testCA) issue(t *testing.T, dir, name string, tmpl *x509.Certificate) Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	cfg := Config{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+		CAFile:   filepath.Join(dir, name+"-ca.crt"),
+	}
+	require.NoError(t, os.WriteFile(cfg.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	require.NoError(t, os.WriteFile(cfg.CAFile, ca.pem, 0o600))
+	return cfg
+}
+
+// handshake connects a client to a server over loopback TCP, net.Pipe
+// would block on the session tickets the server sends after the handshake.
+func handshake(t *testing.T, server, client *tls.Config) error {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer conn.Close()
+		errc <- tls.Server(conn, server).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), client)
+	if err == nil {
+		// TLS 1.3 reports a rejected client certificate on the first read,
+		// a clean close by the server means it accepted the handshake.
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, err = conn.Read(make([]byte, 1))
+		if ne, ok := err.(net.Error); errors.Is(err, io.EOF) || ok && ne.Timeout() {
+			err = nil
+		}
+		conn.Close()
+	}
+	if serverErr := <-errc; err == nil {
+		err = serverErr
+	}
+	return err
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t)
+
+	serverCfg := ca.issue(t, dir, "server", &x509.Certificate{Subject: pkix.Name{CommonName: "books-grpc"}, DNSNames: []string{"books-grpc"}})
+	gatewayURI, _ := url.Parse("spiffe://books/gateway")
+	clientCfg := ca.issue(t, dir, "client", &x509.Certificate{Subject: pkix.Name{CommonName: "gateway"}, URIs: []*url.URL{gatewayURI}})
+
+	server, err := NewReloader(serverCfg)
+	require.NoError(t, err)
+	client, err := NewReloader(clientCfg)
+	require.NoError(t, err)
+
+	assert.NoError(t, handshake(t, server.ServerConfig(), client.ClientConfig("books-grpc")))
+	assert.Error(t, handshake(t, server.ServerConfig(), client.ClientConfig("other-host")), "server name must match")
+
+	// The server moves to a new CA, the client only trusts it after a reload.
+	rotated := newCA(t)
+	rotated.issue(t, dir, "server", &x509.Certificate{Subject: pkix.Name{CommonName: "books-grpc"}, DNSNames: []string{"books-grpc"}})
+	require.NoError(t, server.Reload())
+	assert.Error(t, handshake(t, server.ServerConfig(), client.ClientConfig("books-grpc")))
+
+	require.NoError(t, os.WriteFile(clientCfg.CAFile, rotated.pem, 0o600))
+	require.NoError(t, client.Reload())
+	assert.Error(t, handshake(t, server.ServerConfig(), client.ClientConfig("books-grpc")), "client certificate is signed by the old CA")
+
+	require.NoError(t, os.WriteFile(serverCfg.CAFile, append(rotated.pem, ca.pem...), 0o600))
+	require.NoError(t, server.Reload())
+	assert.NoError(t, handshake(t, server.ServerConfig(), client.ClientConfig("books-grpc")))
+
+	// A broken file keeps the current certificates.
+	require.NoError(t, os.WriteFile(serverCfg.CertFile, []byte("garbage"), 0o600))
+	assert.Error(t, server.Reload())
+	assert.NoError(t, handshake(t, server.ServerConfig(), client.ClientConfig("books-grpc")))
+}
+
+func TestIdentities(t *testing.T) {
+	u, _ := url.Parse("spiffe://books/gateway")
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "gateway"},
+		DNSNames: []string{"gateway.internal"},
+		URIs:     []*url.URL{u},
+	}
+
+	assert.Equal(t, []string{"spiffe://books/gateway", "gateway.internal", "gateway"}, Identities(cert))
+}
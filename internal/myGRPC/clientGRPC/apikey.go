@@ -0,0 +1,119 @@
+package clientGRPC
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"gin_training/internal/model"
+	pb "gin_training/internal/proto"
+	storage "gin_training/internal/storage/postgreSQL"
+)
+
+type apiKeyClient struct {
+	client pb.APIKeyServiceClient
+}
+
+// NewAPIKeys returns a storage.APIKeyStore backed by the gRPC server.
+func NewAPIKeys(keys pb.APIKeyServiceClient) apiKeyClient {
+	return apiKeyClient{
+		client: keys,
+	}
+}
+
+func (kc apiKeyClient) CreateAPIKey(ctx context.Context, in model.CreateAPIKeyInput) (model.APIKey, error) {
+	req := &pb.NewAPIKey{
+		Owner:  in.Owner,
+		Scopes: in.Scopes,
+	}
+	if in.ExpiresAt != nil {
+		req.ExpiresAt = timestamppb.New(*in.ExpiresAt)
+	}
+
+	k, err := kc.client.CreateAPIKey(ctx, req)
+	if err != nil {
+		return model.APIKey{}, storageError(err, "couldn't create API key")
+	}
+
+	return apiKeyFromProto(k)
+}
+
+func (kc apiKeyClient) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	res, err := kc.client.ListAPIKeys(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, storageError(err, "couldn't list API keys")
+	}
+
+	keys := make([]model.APIKey, 0, len(res.GetKeys()))
+	for _, pk := range res.GetKeys() {
+		k, err := apiKeyFromProto(pk)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+func (kc apiKeyClient) RevokeAPIKey(ctx context.Context, id string) error {
+	_, err := kc.client.RevokeAPIKey(ctx, &pb.APIKeyID{Id: id})
+	if err != nil {
+		return storageError(err, "couldn't revoke API key")
+	}
+	return nil
+}
+
+// AuthenticateAPIKey presents key to the server, which rejects unknown keys
+// as unauthenticated. The server records the use of the key when the calls
+// carrying it are made, so the key is authenticated once per call.
+func (kc apiKeyClient) AuthenticateAPIKey(ctx context.Context, key string) (model.APIKey, error) {
+	return kc.FindAPIKey(ctx, key)
+}
+
+func (kc apiKeyClient) FindAPIKey(ctx context.Context, key string) (model.APIKey, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", key)
+
+	k, err := kc.client.AuthenticateAPIKey(ctx, &emptypb.Empty{})
+	if status.Code(err) == codes.Unauthenticated {
+		return model.APIKey{}, fmt.Errorf("couldn't authenticate API key: %w", storage.ErrNotFound)
+	}
+	if err != nil {
+		return model.APIKey{}, storageError(err, "couldn't authenticate API key")
+	}
+
+	return apiKeyFromProto(k)
+}
+
+func apiKeyFromProto(k *pb.APIKey) (model.APIKey, error) {
+	id, err := uuid.Parse(k.GetId())
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("couldn't parse id: %w", storage.ErrInternal)
+	}
+
+	return model.APIKey{
+		ID:         id,
+		Key:        k.GetKey(),
+		Owner:      k.GetOwner(),
+		Scopes:     k.GetScopes(),
+		ExpiresAt:  timeOf(k.GetExpiresAt()),
+		LastUsedAt: timeOf(k.GetLastUsedAt()),
+		CreatedAt:  k.GetCreatedAt().AsTime(),
+		RevokedAt:  timeOf(k.GetRevokedAt()),
+	}, nil
+}
+
+func timeOf(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
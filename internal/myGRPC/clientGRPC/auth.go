@@ -0,0 +1,37 @@
+package clientGRPC
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"gin_training/internal/auth"
+	"gin_training/internal/ratelimit"
+)
+
+// ForwardCredentials attaches the caller's bearer token or API key, stored
+// in the context by the HTTP API, to outgoing calls so the storage backend
+// can authorize them.
+func ForwardCredentials() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if token, ok := auth.TokenFromContext(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+		}
+		if key, ok := auth.APIKeyFromContext(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", key)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// ForwardClientIP passes the address of the HTTP client to the server, which
+// only believes it from the proxies it trusts.
+func ForwardClientIP() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if ip, ok := ratelimit.ClientIPFromContext(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, ratelimit.ClientIPMetadata, ip)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
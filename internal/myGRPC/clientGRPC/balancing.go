@@ -0,0 +1,81 @@
+package clientGRPC
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/balancer/leastrequest"
+	"google.golang.org/grpc/balancer/roundrobin"
+	_ "google.golang.org/grpc/health" // client side health checking
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+// Policies balancing the calls over the backends.
+const (
+	RoundRobin   = "round_robin"
+	LeastRequest = "least_request"
+	PickFirst    = "pick_first"
+)
+
+// maxReconnectBackoff caps the wait before reconnecting to a backend, so a
+// restarted one gets calls again within seconds.
+const maxReconnectBackoff = 5 * time.Second
+
+// Balancing spreads calls over the backends with Policy. When HealthService
+// is set, backends whose health service doesn't report it as serving get no
+// calls, e.g. while they drain before shutting down.
+type Balancing struct {
+	Policy        string
+	HealthService string
+}
+
+func (b Balancing) config() []map[string]interface{} {
+	switch b.Policy {
+	case "", PickFirst:
+		return nil
+	case RoundRobin:
+		return []map[string]interface{}{{roundrobin.Name: struct{}{}}}
+	case LeastRequest:
+		return []map[string]interface{}{{leastrequest.Name: map[string]int{"choiceCount": 2}}}
+	default:
+		// Rejected by grpc.Dial as an invalid service config.
+		return []map[string]interface{}{{b.Policy: struct{}{}}}
+	}
+}
+
+// Backends returns the target to dial addrs with, and the options it needs.
+// A single address is resolved through DNS, and again whenever a connection
+// fails, so every record of a name gets calls. Several addresses are used
+// as given. An address with a scheme, e.g. dns:///books:9000, is dialed as
+// is and must be the only one.
+func Backends(addrs []string) (string, []grpc.DialOption, error) {
+	reconnect := grpc.WithConnectParams(grpc.ConnectParams{
+		Backoff:           backoff.Config{BaseDelay: time.Second / 2, Multiplier: 1.6, Jitter: 0.2, MaxDelay: maxReconnectBackoff},
+		MinConnectTimeout: 5 * time.Second,
+	})
+
+	switch {
+	case len(addrs) == 0:
+		return "", nil, errors.New("no gRPC backend to dial")
+	case len(addrs) == 1 && strings.Contains(addrs[0], "://"):
+		return addrs[0], []grpc.DialOption{reconnect}, nil
+	case len(addrs) == 1:
+		return "dns:///" + addrs[0], []grpc.DialOption{reconnect}, nil
+	}
+
+	state := resolver.State{}
+	for _, addr := range addrs {
+		if strings.Contains(addr, "://") {
+			return "", nil, errors.New("a gRPC target with a scheme can't be listed with other backends")
+		}
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	r := manual.NewBuilderWithScheme("backends")
+	r.InitialState(state)
+
+	return r.Scheme() + ":///books", []grpc.DialOption{reconnect, grpc.WithResolvers(r)}, nil
+}
@@ -0,0 +1,138 @@
+package clientGRPC
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker opens after a number of calls in a row found the server
+// unavailable or too slow. While open, calls fail right away; after the
+// cooldown one call goes through to probe the server and closes the
+// breaker if it answers.
+type Breaker struct {
+	failures int
+	cooldown time.Duration
+	now      func() time.Time
+	log      *slog.Logger
+
+	mu          sync.Mutex
+	state       breakerState
+	consecutive int
+	openedAt    time.Time
+}
+
+// BreakerOption configures optional parts of a Breaker.
+type BreakerOption func(*Breaker)
+
+// WithBreakerLogger logs the state changes to l instead of the default slog
+// logger.
+func WithBreakerLogger(l *slog.Logger) BreakerOption {
+	return func(b *Breaker) {
+		b.log = l
+	}
+}
+
+// NewBreaker returns a closed Breaker opening after failures calls in a row
+// failed and staying open for cooldown.
+func NewBreaker(failures int, cooldown time.Duration, opts ...BreakerOption) *Breaker {
+	b := &Breaker{failures: failures, cooldown: cooldown, now: time.Now, log: slog.Default()}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// allow reports whether a call may go through.
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		return true
+	case breakerHalfOpen:
+		// A probe is in flight.
+		return false
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a call it allowed.
+func (b *Breaker) record(code codes.Code) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		b.consecutive++
+		if b.state == breakerHalfOpen || b.consecutive >= b.failures {
+			b.openedAt = b.now()
+			b.setState(breakerOpen)
+		}
+	case codes.Canceled:
+		// The caller gave up, the server may be fine. A probe is due
+		// again right away.
+		if b.state == breakerHalfOpen {
+			b.openedAt = b.now().Add(-b.cooldown)
+			b.setState(breakerOpen)
+		}
+	default:
+		b.consecutive = 0
+		b.setState(breakerClosed)
+	}
+}
+
+func (b *Breaker) setState(s breakerState) {
+	if s == b.state {
+		return
+	}
+	level := slog.LevelInfo
+	if s == breakerOpen {
+		level = slog.LevelWarn
+	}
+	b.log.Log(context.Background(), level, "circuit breaker state changed", "from", b.state.String(), "to", s.String())
+	b.state = s
+}
+
+// CircuitBreaker fails calls with UNAVAILABLE, without reaching the server,
+// while b is open.
+func CircuitBreaker(b *Breaker) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !b.allow() {
+			return status.Error(codes.Unavailable, "circuit breaker open: the storage backend is failing")
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.record(status.Code(err))
+		return err
+	}
+}
@@ -2,12 +2,19 @@ package clientGRPC
 
 import (
 	"context"
+	"fmt"
 	"gin_training/internal/model"
 	pb "gin_training/internal/proto"
+	"gin_training/internal/storage/cache"
+	storage "gin_training/internal/storage/postgreSQL"
+	"gin_training/internal/validation"
 	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 type gRPCClient struct {
@@ -20,15 +27,18 @@ func New(store pb.BookServiceClient) gRPCClient {
 	}
 }
 
-func (gc gRPCClient) FindAll() []model.Book {
-	ap, _ := gc.client.FindAll(context.Background(), &emptypb.Empty{})
+func (gc gRPCClient) FindAll(ctx context.Context, mask model.ReadMask) ([]model.Book, model.Revision, error) {
+	ap, err := gc.client.FindAll(ctx, &pb.ListBooksRequest{ReadMask: readMask(mask)})
+	if err != nil {
+		return nil, model.Revision{}, storageError(err, "couldn't list books")
+	}
 
 	books := []model.Book{}
 
 	for _, val := range ap.Allbooks {
-		res, err := uuid.Parse(val.Id)
+		res, err := parseID(val.Id)
 		if err != nil {
-			return nil
+			return nil, model.Revision{}, err
 		}
 
 		books = append(books, model.Book{
@@ -38,20 +48,20 @@ func (gc gRPCClient) FindAll() []model.Book {
 		})
 	}
 
-	return books
+	return books, revision(ap.Revision), nil
 }
-func (gc gRPCClient) Create(in model.Book) (model.Book, error) {
-	b, err := gc.client.Create(context.Background(), &pb.BookObj{
+func (gc gRPCClient) Create(ctx context.Context, in model.Book) (model.Book, error) {
+	b, err := gc.client.Create(ctx, &pb.BookObj{
 		Title:  in.Title,
 		Author: in.Author,
 	})
 	if err != nil {
-		return model.Book{}, status.Error(codes.Internal, "couldn't create a book")
+		return model.Book{}, storageError(err, "couldn't create a book")
 	}
 
 	idStr, err := uuid.Parse(b.Id)
 	if err != nil {
-		return model.Book{}, status.Error(codes.Internal, "couldn't parse id")
+		return model.Book{}, fmt.Errorf("couldn't parse id: %w", storage.ErrInternal)
 	}
 
 	return model.Book{
@@ -62,35 +72,52 @@ func (gc gRPCClient) Create(in model.Book) (model.Book, error) {
 
 }
 
-func (gc gRPCClient) GetBook(id string) (model.Book, error) {
+func (gc gRPCClient) GetBook(ctx context.Context, id string, mask model.ReadMask) (model.Book, error) {
+	if cache.Bypassed(ctx) {
+		ctx = metadata.AppendToOutgoingContext(ctx, cache.BypassMetadata, "true")
+	}
 
-	b, err := gc.client.GetBook(context.Background(), &pb.BookID{
-		ID: id,
+	b, err := gc.client.GetBook(ctx, &pb.BookID{
+		ID:       id,
+		ReadMask: readMask(mask),
 	})
 	if err != nil {
-		return model.Book{}, status.Error(codes.Internal, "couldn't find a book")
+		return model.Book{}, storageError(err, "couldn't find a book")
 	}
 
-	uid, _ := uuid.Parse(b.Id)
+	uid, err := parseID(b.Id)
+	if err != nil {
+		return model.Book{}, err
+	}
 
 	return model.Book{
-		ID:     uid,
-		Title:  b.Title,
-		Author: b.Author,
+		ID:       uid,
+		Title:    b.Title,
+		Author:   b.Author,
+		Revision: revision(b.GetRevision()),
 	}, nil
 
 }
-func (gc gRPCClient) UpdateBook(id string, in model.UpdateBookInput) (model.Book, error) {
+func (gc gRPCClient) UpdateBook(ctx context.Context, id string, in model.UpdateBookInput) (model.Book, error) {
 
-	b, err := gc.client.UpdateBook(context.Background(), &pb.NewBook{
-		ID:   id,
-		Book: &pb.BookObj{Title: in.Title, Author: in.Author},
-	})
+	req := &pb.NewBook{
+		ID:        id,
+		Book:      &pb.BookObj{Title: in.Title, Author: in.Author},
+		IfVersion: in.IfVersion,
+	}
+	if len(in.Fields) > 0 {
+		req.UpdateMask = &fieldmaskpb.FieldMask{Paths: in.Fields}
+	}
+
+	b, err := gc.client.UpdateBook(ctx, req)
 	if err != nil {
-		return model.Book{}, status.Error(codes.Internal, "couldn't find a book")
+		return model.Book{}, storageError(err, "couldn't update a book")
 	}
 
-	uid, _ := uuid.Parse(b.Id)
+	uid, err := parseID(b.Id)
+	if err != nil {
+		return model.Book{}, err
+	}
 
 	return model.Book{
 		ID:     uid,
@@ -99,10 +126,93 @@ func (gc gRPCClient) UpdateBook(id string, in model.UpdateBookInput) (model.Book
 	}, nil
 }
 
-func (gc gRPCClient) DeleteBook(id string) error {
-	_, err := gc.client.DeleteBook(context.Background(), &pb.BookID{ID: id})
+func (gc gRPCClient) DeleteBook(ctx context.Context, id string) error {
+	_, err := gc.client.DeleteBook(ctx, &pb.BookID{ID: id})
 	if err != nil {
-		status.Error(codes.Internal, "couldn't find a book")
+		return storageError(err, "couldn't delete a book")
 	}
 	return nil
 }
+
+func (gc gRPCClient) CatalogRevision(ctx context.Context) (model.Revision, error) {
+	r, err := gc.client.GetCatalogRevision(ctx, &emptypb.Empty{})
+	if err != nil {
+		return model.Revision{}, storageError(err, "couldn't read the catalog revision")
+	}
+	return revision(r), nil
+}
+
+func (gc gRPCClient) BookRevision(ctx context.Context, id string) (model.Revision, error) {
+	r, err := gc.client.GetBookRevision(ctx, &pb.BookID{ID: id})
+	if err != nil {
+		return model.Revision{}, storageError(err, "couldn't read the book revision")
+	}
+	return revision(r), nil
+}
+
+// revision converts a revision sent by the server, servers predating
+// revisions send none.
+func revision(r *pb.Revision) model.Revision {
+	rev := model.Revision{Version: r.GetVersion()}
+	if r.GetUpdatedAt() != nil {
+		rev.UpdatedAt = r.GetUpdatedAt().AsTime()
+	}
+	return rev
+}
+
+// parseID parses a book id sent by the server, which leaves it empty when
+// the read mask doesn't ask for it.
+func parseID(id string) (uuid.UUID, error) {
+	if id == "" {
+		return uuid.UUID{}, nil
+	}
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("couldn't parse id: %w", storage.ErrInternal)
+	}
+	return uid, nil
+}
+
+func readMask(mask model.ReadMask) *fieldmaskpb.FieldMask {
+	if len(mask) == 0 {
+		return nil
+	}
+	return &fieldmaskpb.FieldMask{Paths: mask}
+}
+
+// storageError maps a gRPC status returned by the server back to the
+// storage errors, so the client is a drop-in storage.DB implementation.
+func storageError(err error, msg string) error {
+	st := status.Convert(err)
+	for _, d := range st.Details() {
+		br, ok := d.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+		ve := &validation.Error{}
+		for _, v := range br.GetFieldViolations() {
+			ve.Violations = append(ve.Violations, validation.FieldViolation{
+				Field:       v.GetField(),
+				Description: v.GetDescription(),
+			})
+		}
+		return fmt.Errorf("%s: %w", msg, ve)
+	}
+
+	switch st.Code() {
+	case codes.NotFound:
+		return fmt.Errorf("%s: %w", msg, storage.ErrNotFound)
+	case codes.InvalidArgument:
+		return fmt.Errorf("%s: %w", msg, storage.ErrInvalidArgument)
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return fmt.Errorf("%s: %w: %s", msg, storage.ErrPermissionDenied, st.Message())
+	case codes.ResourceExhausted:
+		return fmt.Errorf("%s: %w", msg, storage.ErrRateLimited)
+	case codes.Aborted:
+		return fmt.Errorf("%s: %w", msg, storage.ErrConflict)
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return fmt.Errorf("%s: %w", msg, storage.ErrUnavailable)
+	default:
+		return fmt.Errorf("%s: %w", msg, storage.ErrInternal)
+	}
+}
@@ -1,21 +1,47 @@
 package clientGRPC
 
 import (
+	"bytes"
+	"context"
+	"gin_training/internal/config"
+	"gin_training/internal/logging"
 	"gin_training/internal/model"
 	mocks2 "gin_training/internal/myGRPC/clientGRPC/mocks"
 	Gin_training "gin_training/internal/proto"
+	"gin_training/internal/ratelimit"
+	"gin_training/internal/storage/cache"
+	storage "gin_training/internal/storage/postgreSQL"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestGRPCClient_GetBook(t *testing.T) {
 	s := new(mocks2.BookServiceClient)
 	idStr := "00000000-0000-0000-0000-000000000000"
 	id, _ := uuid.Parse(idStr)
-	b := model.Book{id, "title", "author"}
+	b := model.Book{ID: id, Title: "title", Author: "author"}
 	bb := Gin_training.BookObj{Id: "00000000-0000-0000-0000-000000000000", Title: "title", Author: "author"}
 	s.On("GetBook", mock.Anything, mock.Anything).Return(&bb, nil)
 
@@ -35,7 +61,7 @@ func TestGRPCClient_GetBook(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			u := New(s)
-			got, err := u.GetBook(tc.param)
+			got, err := u.GetBook(context.Background(), tc.param, nil)
 			if err != nil {
 				t.Errorf("error = %v", err.Error())
 				return
@@ -49,7 +75,7 @@ func TestGRPCClient_Create(t *testing.T) {
 	s := new(mocks2.BookServiceClient)
 	idStr := "00000000-0000-0000-0000-000000000000"
 	id, _ := uuid.Parse(idStr)
-	b := model.Book{id, "title", "author"}
+	b := model.Book{ID: id, Title: "title", Author: "author"}
 	bb := Gin_training.BookObj{Id: "00000000-0000-0000-0000-000000000000", Title: "title", Author: "author"}
 	s.On("Create", mock.Anything, mock.Anything).Return(&bb, nil)
 
@@ -69,7 +95,7 @@ func TestGRPCClient_Create(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			u := New(s)
-			got, err := u.Create(tc.param)
+			got, err := u.Create(context.Background(), tc.param)
 			if err != nil {
 				t.Errorf("error = %v", err.Error())
 				return
@@ -83,11 +109,12 @@ func TestGRPCClient_FindAll(t *testing.T) {
 	s := new(mocks2.BookServiceClient)
 	idStr := "00000000-0000-0000-0000-000000000000"
 	id, _ := uuid.Parse(idStr)
-	b := []model.Book{{id, "title", "author"}}
+	b := []model.Book{{ID: id, Title: "title", Author: "author"}}
 	all := []*Gin_training.BookObj{
 		{Id: "00000000-0000-0000-0000-000000000000", Title: "title", Author: "author"},
 	}
-	aa := Gin_training.AllBooks{Allbooks: all}
+	updated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	aa := Gin_training.AllBooks{Allbooks: all, Revision: &Gin_training.Revision{Version: 7, UpdatedAt: timestamppb.New(updated)}}
 
 	s.On("FindAll", mock.Anything, mock.Anything).Return(&aa, nil)
 
@@ -105,8 +132,10 @@ func TestGRPCClient_FindAll(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			u := New(s)
-			got := u.FindAll()
+			got, rev, err := u.FindAll(context.Background(), nil)
+			assert.NoError(t, err)
 			assert.Equal(t, tc.want, got)
+			assert.Equal(t, model.Revision{Version: 7, UpdatedAt: updated}, rev)
 		})
 	}
 }
@@ -115,7 +144,7 @@ func TestGRPCClient_UpdateBook(t *testing.T) {
 	s := new(mocks2.BookServiceClient)
 	idStr := "00000000-0000-0000-0000-000000000000"
 	id, _ := uuid.Parse(idStr)
-	b := model.Book{id, "title", "author"}
+	b := model.Book{ID: id, Title: "title", Author: "author"}
 	bb := Gin_training.BookObj{Id: "00000000-0000-0000-0000-000000000000", Title: "title", Author: "author"}
 	s.On("UpdateBook", mock.Anything, mock.Anything).Return(&bb, nil)
 
@@ -130,14 +159,14 @@ func TestGRPCClient_UpdateBook(t *testing.T) {
 			name:   "Get everything good",
 			stor:   s,
 			param1: "00000000-0000-0000-0000-000000000000",
-			param2: model.UpdateBookInput{"title", "author"},
+			param2: model.UpdateBookInput{Title: "title", Author: "author"},
 			want:   b,
 		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			u := New(s)
-			got, err := u.UpdateBook(tc.param1, tc.param2)
+			got, err := u.UpdateBook(context.Background(), tc.param1, tc.param2)
 			if err != nil {
 				t.Errorf("error = %v", err.Error())
 				return
@@ -147,6 +176,33 @@ func TestGRPCClient_UpdateBook(t *testing.T) {
 	}
 }
 
+func TestGRPCClient_UpdateBookIfVersion(t *testing.T) {
+	s := new(mocks2.BookServiceClient)
+	s.On("UpdateBook", mock.Anything, mock.MatchedBy(func(req *Gin_training.NewBook) bool {
+		return req.IfVersion == 3
+	})).Return(nil, status.Error(codes.Aborted, "failed to update book"))
+
+	_, err := New(s).UpdateBook(context.Background(), "00000000-0000-0000-0000-000000000000", model.UpdateBookInput{Title: "title", IfVersion: 3})
+
+	assert.ErrorIs(t, err, storage.ErrConflict)
+	s.AssertExpectations(t)
+}
+
+func TestGRPCClient_GetBookBypassingCache(t *testing.T) {
+	s := new(mocks2.BookServiceClient)
+	bypassed := func(ctx context.Context) bool {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		return len(md.Get(cache.BypassMetadata)) > 0
+	}
+	s.On("GetBook", mock.MatchedBy(bypassed), mock.Anything).
+		Return(&Gin_training.BookObj{Id: "00000000-0000-0000-0000-000000000000", Title: "title"}, nil)
+
+	_, err := New(s).GetBook(cache.Bypass(context.Background()), "00000000-0000-0000-0000-000000000000", nil)
+
+	assert.NoError(t, err)
+	s.AssertExpectations(t)
+}
+
 func TestGRPCClient_DeleteBook(t *testing.T) {
 	s := new(mocks2.BookServiceClient)
 	idStr := "00000000-0000-0000-0000-000000000000"
@@ -169,8 +225,510 @@ func TestGRPCClient_DeleteBook(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			u := New(s)
-			err := u.DeleteBook(tc.param)
+			err := u.DeleteBook(context.Background(), tc.param)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestGRPCClient_Revisions(t *testing.T) {
+	s := new(mocks2.BookServiceClient)
+	idStr := "00000000-0000-0000-0000-000000000000"
+	updated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.On("GetBookRevision", mock.Anything, &Gin_training.BookID{ID: idStr}).
+		Return(&Gin_training.Revision{Version: 3, UpdatedAt: timestamppb.New(updated)}, nil)
+	s.On("GetBookRevision", mock.Anything, mock.Anything).Return(nil, status.Error(codes.NotFound, "no book"))
+	s.On("GetCatalogRevision", mock.Anything, mock.Anything).Return(&Gin_training.Revision{Version: 9}, nil)
+
+	u := New(s)
+
+	got, err := u.BookRevision(context.Background(), idStr)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Revision{Version: 3, UpdatedAt: updated}, got)
+
+	_, err = u.BookRevision(context.Background(), "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Without a time the revision has none.
+	got, err = u.CatalogRevision(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, model.Revision{Version: 9}, got)
+}
+
+func TestAPIKeyClient_AuthenticateAPIKey(t *testing.T) {
+	s := new(mocks2.APIKeyServiceClient)
+	id := uuid.New()
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	s.On("AuthenticateAPIKey", mock.MatchedBy(func(ctx context.Context) bool {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		return len(md.Get("x-api-key")) == 1 && md.Get("x-api-key")[0] == "bk_good"
+	}), mock.Anything).Return(&Gin_training.APIKey{Id: id.String(), Owner: "batch", Scopes: []string{"books:read"}, CreatedAt: timestamppb.New(created)}, nil)
+	s.On("AuthenticateAPIKey", mock.Anything, mock.Anything).Return(nil, status.Error(codes.Unauthenticated, "unknown key"))
+
+	u := NewAPIKeys(s)
+
+	got, err := u.AuthenticateAPIKey(context.Background(), "bk_good")
+	assert.NoError(t, err)
+	assert.Equal(t, model.APIKey{ID: id, Owner: "batch", Scopes: []string{"books:read"}, CreatedAt: created}, got)
+
+	_, err = u.AuthenticateAPIKey(context.Background(), "bk_bad")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	parent, root := otel.Tracer("test").Start(context.Background(), "PATCH /books/:id")
+	ctx := metadata.AppendToOutgoingContext(parent, "authorization", "Bearer token")
+
+	var sent metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	assert.NoError(t, Tracing()(ctx, "/proto.BookService/UpdateBook", nil, nil, nil, invoker))
+	root.End()
+
+	spans := sr.Ended()
+	if assert.Len(t, spans, 2) {
+		span := spans[0]
+		assert.Equal(t, "proto.BookService/UpdateBook", span.Name())
+		assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+		assert.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID())
+
+		// The server continues the trace from the client span.
+		traceparent := "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01"
+		assert.Equal(t, []string{traceparent}, sent.Get("traceparent"))
+	}
+	assert.Equal(t, []string{"Bearer token"}, sent.Get("authorization"))
+}
+
+func TestForwardClientIP(t *testing.T) {
+	var sent metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+
+	ctx := ratelimit.WithClientIP(context.Background(), "192.0.2.1")
+	assert.NoError(t, ForwardClientIP()(ctx, "/proto.BookService/FindAll", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"192.0.2.1"}, sent.Get(ratelimit.ClientIPMetadata))
+}
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	interceptor := Logging(logging.New(&buf, slog.LevelInfo))
+
+	var sent metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent, _ = metadata.FromOutgoingContext(ctx)
+		return status.Error(codes.Unavailable, "connection refused")
+	}
+
+	ctx := logging.WithRequestID(context.Background(), "req-42")
+	err := interceptor(ctx, "/proto.BookService/GetBook", nil, nil, nil, invoker)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	assert.Equal(t, []string{"req-42"}, sent.Get("x-request-id"))
+	assert.Contains(t, buf.String(), `"level":"WARN"`)
+	assert.Contains(t, buf.String(), `"request_id":"req-42"`)
+	assert.Contains(t, buf.String(), `"code":"Unavailable"`)
+}
+
+func TestHealthCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		res        *healthpb.HealthCheckResponse
+		err        error
+		wantDetail string
+		wantErr    string
+	}{
+		{
+			name:       "Serving",
+			res:        &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING},
+			wantDetail: "SERVING",
+		},
+		{
+			name:       "Storage not ready",
+			res:        &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING},
+			wantDetail: "NOT_SERVING",
+			wantErr:    "proto.BookService is NOT_SERVING",
+		},
+		{
+			name:    "Unreachable",
+			err:     status.Error(codes.Unavailable, "connection refused"),
+			wantErr: "gRPC server didn't answer: Unavailable",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := new(mocks2.HealthClient)
+			client.On("Check", mock.Anything, &healthpb.HealthCheckRequest{Service: "proto.BookService"}).Return(tc.res, tc.err)
+
+			detail, err := HealthCheck(client, "proto.BookService")(context.Background())
+			assert.Equal(t, tc.wantDetail, detail)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	interceptor := Deadline(func() time.Duration { return time.Second })
+
+	tests := []struct {
+		name   string
+		ctx    func() (context.Context, context.CancelFunc)
+		within time.Duration
+	}{
+		{
+			name:   "No deadline",
+			ctx:    func() (context.Context, context.CancelFunc) { return context.Background(), func() {} },
+			within: time.Second,
+		},
+		{
+			name: "Caller's deadline is sooner",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			},
+			within: 100 * time.Millisecond,
+		},
+		{
+			name: "Caller's deadline is later",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Hour)
+			},
+			within: time.Second,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := tc.ctx()
+			defer cancel()
+
+			var deadline time.Time
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				deadline, _ = ctx.Deadline()
+				return nil
+			}
+			assert.NoError(t, interceptor(ctx, "/proto.BookService/FindAll", nil, nil, nil, invoker))
+			assert.WithinDuration(t, time.Now().Add(tc.within), deadline, 50*time.Millisecond)
+		})
+	}
+}
+
+func TestDeadline_Reload(t *testing.T) {
+	type testConfig struct {
+		Timeout time.Duration `yaml:"timeout" env:"TEST_TIMEOUT" reload:"true"`
+	}
+	var timeout atomic.Int64
+	apply := func(cfg *testConfig) error {
+		timeout.Store(int64(cfg.Timeout))
+		return nil
+	}
+	cfg := &testConfig{Timeout: time.Second}
+	assert.NoError(t, apply(cfg))
+	load := func() (*testConfig, error) {
+		return &testConfig{Timeout: time.Minute}, nil
+	}
+	r := config.NewReloader(cfg, load, apply, nil)
+	interceptor := Deadline(func() time.Duration { return time.Duration(timeout.Load()) })
+
+	var deadline time.Time
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		deadline, _ = ctx.Deadline()
+		return nil
+	}
+	assert.NoError(t, interceptor(context.Background(), "/proto.BookService/FindAll", nil, nil, nil, invoker))
+	assert.WithinDuration(t, time.Now().Add(time.Second), deadline, 50*time.Millisecond)
+
+	// The next calls get the reloaded timeout.
+	assert.NoError(t, r.Reload())
+	assert.NoError(t, interceptor(context.Background(), "/proto.BookService/FindAll", nil, nil, nil, invoker))
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 50*time.Millisecond)
+}
+
+// flakyHealth answers UNAVAILABLE to the first failures checks.
+type flakyHealth struct {
+	healthpb.UnimplementedHealthServer
+	failures int
+	calls    atomic.Int32
+}
+
+func (h *flakyHealth) Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if int(h.calls.Add(1)) <= h.failures {
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func TestServiceConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    RetryPolicy
+		failures  int
+		wantCode  codes.Code
+		wantCalls int32
+	}{
+		{
+			name:      "Retried until it answers",
+			policy:    RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+			failures:  2,
+			wantCode:  codes.OK,
+			wantCalls: 3,
+		},
+		{
+			name:      "Gives up after the attempts",
+			policy:    RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+			failures:  5,
+			wantCode:  codes.Unavailable,
+			wantCalls: 2,
+		},
+		{
+			name:      "No retries",
+			policy:    RetryPolicy{MaxAttempts: 1},
+			failures:  1,
+			wantCode:  codes.Unavailable,
+			wantCalls: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &flakyHealth{failures: tc.failures}
+			s := grpc.NewServer()
+			healthpb.RegisterHealthServer(s, h)
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			go s.Serve(lis)
+			defer s.Stop()
+
+			conn, err := grpc.Dial(lis.Addr().String(),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithDefaultServiceConfig(ServiceConfig(Balancing{}, tc.policy)))
 			assert.NoError(t, err)
+			defer conn.Close()
+
+			_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+			assert.Equal(t, tc.wantCode, status.Code(err))
+			assert.Equal(t, tc.wantCalls, h.calls.Load())
+		})
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var logs bytes.Buffer
+	b := NewBreaker(2, time.Minute, WithBreakerLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+	b.now = func() time.Time { return now }
+
+	interceptor := CircuitBreaker(b)
+	calls := 0
+	call := func(err error) error {
+		return interceptor(context.Background(), "/proto.BookService/FindAll", nil, nil, nil,
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				calls++
+				return err
+			})
+	}
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+
+	// Answers of the server, errors included, keep it closed.
+	assert.Error(t, call(unavailable))
+	assert.Equal(t, codes.NotFound, status.Code(call(status.Error(codes.NotFound, "no book"))))
+	assert.Error(t, call(unavailable))
+	assert.Equal(t, breakerClosed, b.state)
+
+	// Two failures in a row open it, calls then fail fast.
+	assert.Error(t, call(status.Error(codes.DeadlineExceeded, "too slow")))
+	assert.Equal(t, breakerOpen, b.state)
+	calls = 0
+	err := call(nil)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Contains(t, err.Error(), "circuit breaker open")
+	assert.Zero(t, calls)
+
+	// After the cooldown a failed probe opens it again.
+	now = now.Add(time.Minute)
+	assert.Error(t, call(unavailable))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, breakerOpen, b.state)
+	assert.Error(t, call(nil))
+	assert.Equal(t, 1, calls)
+
+	// A cancelled probe leaves room for another one.
+	now = now.Add(time.Minute)
+	assert.Error(t, call(status.Error(codes.Canceled, "context canceled")))
+	assert.Equal(t, breakerOpen, b.state)
+
+	// A successful probe closes it.
+	assert.NoError(t, call(nil))
+	assert.Equal(t, breakerClosed, b.state)
+	assert.NoError(t, call(nil))
+
+	// Its changes go to the logger it was given.
+	assert.Contains(t, logs.String(), `"level":"WARN","msg":"circuit breaker state changed","from":"closed","to":"open"`)
+	assert.Contains(t, logs.String(), `"from":"half-open","to":"closed"`)
+}
+
+func TestBreaker_SingleProbe(t *testing.T) {
+	b := NewBreaker(1, 0)
+	b.record(codes.Unavailable)
+
+	assert.True(t, b.allow())
+	assert.Equal(t, breakerHalfOpen, b.state)
+	assert.False(t, b.allow())
+}
+
+func TestBackends(t *testing.T) {
+	tests := []struct {
+		name       string
+		addrs      []string
+		wantTarget string
+		wantErr    bool
+	}{
+		{name: "Single address", addrs: []string{"books:9000"}, wantTarget: "dns:///books:9000"},
+		{name: "Target with a scheme", addrs: []string{"dns:///books:9000"}, wantTarget: "dns:///books:9000"},
+		{name: "Several addresses", addrs: []string{"books-1:9000", "books-2:9000"}, wantTarget: "backends:///books"},
+		{name: "Scheme among several", addrs: []string{"dns:///books:9000", "books-2:9000"}, wantErr: true},
+		{name: "No address", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			target, opts, err := Backends(tc.addrs)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantTarget, target)
+			assert.NotEmpty(t, opts)
+		})
+	}
+}
+
+// namedBackend answers FindAll with a single book titled after itself.
+type namedBackend struct {
+	Gin_training.UnimplementedBookServiceServer
+	name string
+}
+
+func (b namedBackend) FindAll(context.Context, *Gin_training.ListBooksRequest) (*Gin_training.AllBooks, error) {
+	return &Gin_training.AllBooks{Allbooks: []*Gin_training.BookObj{{Title: b.name}}}, nil
+}
+
+// bufBackends runs in-process book servers, each reachable at its own
+// address through bufconn.
+type bufBackends struct {
+	mu        sync.Mutex
+	listeners map[string]*bufconn.Listener
+	servers   map[string]*grpc.Server
+	health    map[string]*grpchealth.Server
+}
+
+func (bb *bufBackends) start(addr string) {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	h := grpchealth.NewServer()
+	h.SetServingStatus(Gin_training.BookService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, h)
+	Gin_training.RegisterBookServiceServer(s, namedBackend{name: addr})
+	go s.Serve(lis)
+
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	bb.listeners[addr], bb.servers[addr], bb.health[addr] = lis, s, h
+}
+
+func (bb *bufBackends) dial(ctx context.Context, addr string) (net.Conn, error) {
+	bb.mu.Lock()
+	lis := bb.listeners[addr]
+	bb.mu.Unlock()
+	return lis.DialContext(ctx)
+}
+
+func (bb *bufBackends) stop() {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	for _, s := range bb.servers {
+		s.Stop()
+	}
+}
+
+func TestBalancing(t *testing.T) {
+	addrs := []string{"books-1:9000", "books-2:9000", "books-3:9000"}
+	bb := &bufBackends{
+		listeners: map[string]*bufconn.Listener{},
+		servers:   map[string]*grpc.Server{},
+		health:    map[string]*grpchealth.Server{},
+	}
+	for _, addr := range addrs {
+		bb.start(addr)
+	}
+	defer bb.stop()
+
+	for _, policy := range []string{RoundRobin, LeastRequest} {
+		t.Run(policy, func(t *testing.T) {
+			target, opts, err := Backends(addrs)
+			assert.NoError(t, err)
+			opts = append(opts,
+				grpc.WithContextDialer(bb.dial),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithDefaultServiceConfig(ServiceConfig(
+					Balancing{Policy: policy, HealthService: Gin_training.BookService_ServiceDesc.ServiceName},
+					RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})))
+			conn, err := grpc.Dial(target, opts...)
+			assert.NoError(t, err)
+			defer conn.Close()
+			client := Gin_training.NewBookServiceClient(conn)
+
+			// served returns the backends answering a batch of calls.
+			served := func() map[string]bool {
+				seen := map[string]bool{}
+				for i := 0; i < 30; i++ {
+					res, err := client.FindAll(context.Background(), &Gin_training.ListBooksRequest{})
+					if err != nil {
+						return nil
+					}
+					seen[res.Allbooks[0].Title] = true
+				}
+				return seen
+			}
+			servedBy := func(want ...string) func() bool {
+				return func() bool {
+					seen := served()
+					if len(seen) != len(want) {
+						return false
+					}
+					for _, addr := range want {
+						if !seen[addr] {
+							return false
+						}
+					}
+					return true
+				}
+			}
+			book := Gin_training.BookService_ServiceDesc.ServiceName
+
+			// Calls are spread over every backend.
+			assert.Eventually(t, servedBy(addrs...), 5*time.Second, 10*time.Millisecond)
+
+			// A backend reporting the book service as not serving gets none.
+			bb.health[addrs[0]].SetServingStatus(book, healthpb.HealthCheckResponse_NOT_SERVING)
+			assert.Eventually(t, servedBy(addrs[1:]...), 5*time.Second, 10*time.Millisecond)
+			bb.health[addrs[0]].SetServingStatus(book, healthpb.HealthCheckResponse_SERVING)
+			assert.Eventually(t, servedBy(addrs...), 5*time.Second, 10*time.Millisecond)
+
+			// A stopped backend is left out, and used again once restarted.
+			bb.servers[addrs[1]].Stop()
+			assert.Eventually(t, servedBy(addrs[0], addrs[2]), 5*time.Second, 10*time.Millisecond)
+			bb.start(addrs[1])
+			assert.Eventually(t, servedBy(addrs...), 10*time.Second, 10*time.Millisecond)
 		})
 	}
 }
@@ -0,0 +1,26 @@
+package clientGRPC
+
+import (
+	"context"
+	"fmt"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"gin_training/internal/health"
+)
+
+// HealthCheck asks the gRPC server whether service is serving. It fails
+// when the server can't be reached, or when its own storage isn't ready.
+func HealthCheck(client healthpb.HealthClient, service string) health.Check {
+	return func(ctx context.Context) (string, error) {
+		res, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return "", fmt.Errorf("gRPC server didn't answer: %s", status.Code(err))
+		}
+		if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return res.GetStatus().String(), fmt.Errorf("%s is %s", service, res.GetStatus())
+		}
+		return res.GetStatus().String(), nil
+	}
+}
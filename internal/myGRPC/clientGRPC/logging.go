@@ -0,0 +1,43 @@
+package clientGRPC
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gin_training/internal/logging"
+)
+
+// Logging forwards the request ID of the HTTP request to the server and
+// logs outgoing calls, the ones failing on the server side at warn level.
+func Logging(l *slog.Logger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id, ok := logging.RequestIDFromContext(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, logging.RequestIDMetadata, id)
+		}
+
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		code := status.Code(err)
+		attrs := []slog.Attr{
+			slog.String("method", method),
+			slog.String("code", code.String()),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+		}
+		level := slog.LevelDebug
+		if logging.ServerFault(code) {
+			level = slog.LevelWarn
+		}
+		l.LogAttrs(ctx, level, "call finished", attrs...)
+
+		return err
+	}
+}
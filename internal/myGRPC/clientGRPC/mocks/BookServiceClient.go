@@ -79,7 +79,7 @@ func (_m *BookServiceClient) DeleteBook(ctx context.Context, in *Gin_training.Bo
 }
 
 // FindAll provides a mock function with given fields: ctx, in, opts
-func (_m *BookServiceClient) FindAll(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Gin_training.AllBooks, error) {
+func (_m *BookServiceClient) FindAll(ctx context.Context, in *Gin_training.ListBooksRequest, opts ...grpc.CallOption) (*Gin_training.AllBooks, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
@@ -90,7 +90,7 @@ func (_m *BookServiceClient) FindAll(ctx context.Context, in *emptypb.Empty, opt
 	ret := _m.Called(_ca...)
 
 	var r0 *Gin_training.AllBooks
-	if rf, ok := ret.Get(0).(func(context.Context, *emptypb.Empty, ...grpc.CallOption) *Gin_training.AllBooks); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, *Gin_training.ListBooksRequest, ...grpc.CallOption) *Gin_training.AllBooks); ok {
 		r0 = rf(ctx, in, opts...)
 	} else {
 		if ret.Get(0) != nil {
@@ -99,7 +99,7 @@ func (_m *BookServiceClient) FindAll(ctx context.Context, in *emptypb.Empty, opt
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, *emptypb.Empty, ...grpc.CallOption) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, *Gin_training.ListBooksRequest, ...grpc.CallOption) error); ok {
 		r1 = rf(ctx, in, opts...)
 	} else {
 		r1 = ret.Error(1)
@@ -138,6 +138,66 @@ func (_m *BookServiceClient) GetBook(ctx context.Context, in *Gin_training.BookI
 	return r0, r1
 }
 
+// GetBookRevision provides a mock function with given fields: ctx, in, opts
+func (_m *BookServiceClient) GetBookRevision(ctx context.Context, in *Gin_training.BookID, opts ...grpc.CallOption) (*Gin_training.Revision, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *Gin_training.Revision
+	if rf, ok := ret.Get(0).(func(context.Context, *Gin_training.BookID, ...grpc.CallOption) *Gin_training.Revision); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*Gin_training.Revision)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *Gin_training.BookID, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetCatalogRevision provides a mock function with given fields: ctx, in, opts
+func (_m *BookServiceClient) GetCatalogRevision(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Gin_training.Revision, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *Gin_training.Revision
+	if rf, ok := ret.Get(0).(func(context.Context, *emptypb.Empty, ...grpc.CallOption) *Gin_training.Revision); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*Gin_training.Revision)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *emptypb.Empty, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UpdateBook provides a mock function with given fields: ctx, in, opts
 func (_m *BookServiceClient) UpdateBook(ctx context.Context, in *Gin_training.NewBook, opts ...grpc.CallOption) (*Gin_training.BookObj, error) {
 	_va := make([]interface{}, len(opts))
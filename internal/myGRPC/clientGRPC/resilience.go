@@ -0,0 +1,101 @@
+package clientGRPC
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	pb "gin_training/internal/proto"
+)
+
+// Deadline gives every call the timeout returned by timeout as it starts,
+// so a reloaded timeout applies to the next calls. Callers with a sooner
+// deadline keep theirs. Retries happen within the same deadline.
+func Deadline(timeout func() time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout())
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// RetryPolicy retries the idempotent calls failing with UNAVAILABLE, up to
+// MaxAttempts calls in all. gRPC waits a random time up to the backoff,
+// which starts at InitialBackoff and doubles up to MaxBackoff.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// idempotent lists the methods safe to retry, the ones only reading.
+var idempotent = []methodName{
+	{Service: pb.BookService_ServiceDesc.ServiceName, Method: "FindAll"},
+	{Service: pb.BookService_ServiceDesc.ServiceName, Method: "GetBook"},
+	{Service: pb.BookService_ServiceDesc.ServiceName, Method: "GetCatalogRevision"},
+	{Service: pb.BookService_ServiceDesc.ServiceName, Method: "GetBookRevision"},
+	{Service: pb.APIKeyService_ServiceDesc.ServiceName, Method: "ListAPIKeys"},
+	{Service: healthpb.Health_ServiceDesc.ServiceName, Method: "Check"},
+}
+
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]interface{} `json:"loadBalancingConfig,omitempty"`
+	HealthCheckConfig   *healthCheckConfig       `json:"healthCheckConfig,omitempty"`
+	MethodConfig        []methodConfig           `json:"methodConfig,omitempty"`
+}
+
+type healthCheckConfig struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type methodConfig struct {
+	Name        []methodName `json:"name"`
+	RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+}
+
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method,omitempty"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// ServiceConfig returns the service config applying b and p, to pass to
+// grpc.WithDefaultServiceConfig. A policy of less than two attempts
+// doesn't retry.
+func ServiceConfig(b Balancing, p RetryPolicy) string {
+	sc := serviceConfig{LoadBalancingConfig: b.config()}
+	if b.HealthService != "" {
+		sc.HealthCheckConfig = &healthCheckConfig{ServiceName: b.HealthService}
+	}
+	if p.MaxAttempts > 1 {
+		sc.MethodConfig = append(sc.MethodConfig, methodConfig{
+			Name: idempotent,
+			RetryPolicy: &retryPolicy{
+				MaxAttempts:          p.MaxAttempts,
+				InitialBackoff:       protoDuration(p.InitialBackoff),
+				MaxBackoff:           protoDuration(p.MaxBackoff),
+				BackoffMultiplier:    2,
+				RetryableStatusCodes: []string{"UNAVAILABLE"},
+			},
+		})
+	}
+
+	data, _ := json.Marshal(sc)
+	return string(data)
+}
+
+// protoDuration formats d the way JSON service configs expect, e.g. "0.1s".
+func protoDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
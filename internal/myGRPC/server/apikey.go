@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"gin_training/internal/model"
+	pb "gin_training/internal/proto"
+	storage "gin_training/internal/storage/postgreSQL"
+	"gin_training/internal/validation"
+)
+
+// apiKeyHeader is the metadata key carrying the API key of a caller.
+const apiKeyHeader = "x-api-key"
+
+type APIKeyServer struct {
+	pb.UnimplementedAPIKeyServiceServer
+
+	Keys storage.APIKeyStore
+}
+
+func NewGRPCAPIKeys(store storage.APIKeyStore) *APIKeyServer {
+	return &APIKeyServer{
+		Keys: store,
+	}
+}
+
+func (s *APIKeyServer) CreateAPIKey(ctx context.Context, in *pb.NewAPIKey) (*pb.APIKey, error) {
+	input := model.CreateAPIKeyInput{
+		Owner:  in.GetOwner(),
+		Scopes: in.GetScopes(),
+	}
+	if in.GetExpiresAt() != nil {
+		t := in.GetExpiresAt().AsTime()
+		input.ExpiresAt = &t
+	}
+	if err := validation.Default().ValidateStruct(&input); err != nil {
+		return nil, statusError(err, "invalid API key")
+	}
+
+	k, err := s.Keys.CreateAPIKey(ctx, input)
+	if err != nil {
+		return nil, statusError(err, "failed to create API key")
+	}
+
+	return apiKeyToProto(k), nil
+}
+
+func (s *APIKeyServer) ListAPIKeys(ctx context.Context, _ *emptypb.Empty) (*pb.APIKeys, error) {
+	keys, err := s.Keys.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, statusError(err, "failed to list API keys")
+	}
+
+	res := &pb.APIKeys{Keys: make([]*pb.APIKey, 0, len(keys))}
+	for _, k := range keys {
+		res.Keys = append(res.Keys, apiKeyToProto(k))
+	}
+
+	return res, nil
+}
+
+func (s *APIKeyServer) RevokeAPIKey(ctx context.Context, in *pb.APIKeyID) (*emptypb.Empty, error) {
+	if _, err := uuid.Parse(in.GetId()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "id must be a UUID")
+	}
+
+	if err := s.Keys.RevokeAPIKey(ctx, in.GetId()); err != nil {
+		return nil, statusError(err, "failed to revoke API key")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// AuthenticateAPIKey needs no other credentials than the key itself, it's
+// how the HTTP API learns the scopes of a key presented to it. It only
+// reads the key, the calls the HTTP API then makes with it record its use.
+func (s *APIKeyServer) AuthenticateAPIKey(ctx context.Context, _ *emptypb.Empty) (*pb.APIKey, error) {
+	key := incomingAPIKey(ctx)
+	if key == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing API key")
+	}
+
+	k, err := s.Keys.FindAPIKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "unknown, revoked or expired API key")
+		}
+		return nil, statusError(err, "failed to authenticate API key")
+	}
+
+	return apiKeyToProto(k), nil
+}
+
+func incomingAPIKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(apiKeyHeader); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func apiKeyToProto(k model.APIKey) *pb.APIKey {
+	return &pb.APIKey{
+		Id:         k.ID.String(),
+		Key:        k.Key,
+		Owner:      k.Owner,
+		Scopes:     k.Scopes,
+		ExpiresAt:  timestamp(k.ExpiresAt),
+		LastUsedAt: timestamp(k.LastUsedAt),
+		CreatedAt:  timestamppb.New(k.CreatedAt),
+		RevokedAt:  timestamp(k.RevokedAt),
+	}
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gin_training/internal/logging"
+)
+
+var healthCheckMethod = "/" + healthpb.Health_ServiceDesc.ServiceName + "/Check"
+
+// LoggingInterceptor logs every call with the request ID sent by the
+// gateway, or a fresh one for direct callers. The ID is stored in the
+// context so the storage logs carry it too, and returned in the headers.
+func LoggingInterceptor(l *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+
+		id := ""
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(logging.RequestIDMetadata); len(v) > 0 {
+				id = v[0]
+			}
+		}
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		ctx = logging.WithRequestID(ctx, id)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(logging.RequestIDMetadata, id))
+
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		attrs := []slog.Attr{
+			slog.String("method", info.FullMethod),
+			slog.String("code", code.String()),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+		}
+		level := slog.LevelInfo
+		switch {
+		case logging.ServerFault(code):
+			level = slog.LevelError
+		case info.FullMethod == healthCheckMethod:
+			// Probes would drown the calls of the gateway.
+			level = slog.LevelDebug
+		}
+		l.LogAttrs(ctx, level, "call served", attrs...)
+
+		return resp, err
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"gin_training/internal/mtls"
+)
+
+// PeerInterceptor only lets through callers whose verified client
+// certificate carries one of the allowed identities (URI or DNS SAN, or
+// common name), on top of the CA check done by the TLS handshake.
+func PeerInterceptor(allowed []string) grpc.UnaryServerInterceptor {
+	return peerGuard(allowed).unary()
+}
+
+// PeerStreamInterceptor is PeerInterceptor for streams.
+func PeerStreamInterceptor(allowed []string) grpc.StreamServerInterceptor {
+	return peerGuard(allowed).stream()
+}
+
+func peerGuard(allowed []string) guard {
+	allow := make(map[string]bool, len(allowed))
+	for _, id := range allowed {
+		allow[id] = true
+	}
+
+	return func(ctx context.Context, method string) (context.Context, error) {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return ctx, status.Error(codes.Unauthenticated, "unknown peer")
+		}
+		tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+			return ctx, status.Error(codes.Unauthenticated, "client certificate required")
+		}
+
+		for _, id := range mtls.Identities(tlsInfo.State.VerifiedChains[0][0]) {
+			if allow[id] {
+				return ctx, nil
+			}
+		}
+
+		return ctx, status.Error(codes.PermissionDenied, "client certificate isn't allowed")
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/netip"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"gin_training/internal/auth"
+	"gin_training/internal/ratelimit"
+)
+
+// RateLimitInterceptor throttles callers per method. Chained after
+// AuthInterceptor it tells callers apart by token subject or API key owner,
+// otherwise by the address found by IPRateLimitInterceptor or the peer's, and refuses calls over the limit with
+// ResourceExhausted and a retry-after trailer in seconds.
+func RateLimitInterceptor(l *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return rateLimitGuard(l).unary()
+}
+
+// RateLimitStreamInterceptor is RateLimitInterceptor for streams, opening
+// one counts as a call.
+func RateLimitStreamInterceptor(l *ratelimit.Limiter) grpc.StreamServerInterceptor {
+	return rateLimitGuard(l).stream()
+}
+
+func rateLimitGuard(l *ratelimit.Limiter) guard {
+	return func(ctx context.Context, method string) (context.Context, error) {
+		if res := l.Allow(method, caller(ctx)); !res.Allowed {
+			return ctx, exhausted(ctx, res)
+		}
+		return ctx, nil
+	}
+}
+
+// IPRateLimitInterceptor caps the calls of every client address across
+// methods. Chained before AuthInterceptor, it throttles bad credentials too.
+// The address is the peer's, or the one forwarded by a peer among proxies
+// (IPs or CIDRs), such as the gateway, for its own client.
+func IPRateLimitInterceptor(l *ratelimit.Limiter, proxies []string) grpc.UnaryServerInterceptor {
+	return ipRateLimitGuard(l, proxies).unary()
+}
+
+// IPRateLimitStreamInterceptor is IPRateLimitInterceptor for streams.
+func IPRateLimitStreamInterceptor(l *ratelimit.Limiter, proxies []string) grpc.StreamServerInterceptor {
+	return ipRateLimitGuard(l, proxies).stream()
+}
+
+func ipRateLimitGuard(l *ratelimit.Limiter, proxies []string) guard {
+	trusted := make([]netip.Prefix, 0, len(proxies))
+	for _, p := range proxies {
+		// Validated by the config.
+		if prefix, err := netip.ParsePrefix(p); err == nil {
+			trusted = append(trusted, prefix)
+		} else if addr, err := netip.ParseAddr(p); err == nil {
+			trusted = append(trusted, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+
+	return func(ctx context.Context, method string) (context.Context, error) {
+		ip := clientIP(ctx, trusted)
+		ctx = ratelimit.WithClientIP(ctx, ip)
+		if res := l.AllowIP(ip); !res.Allowed {
+			return ctx, exhausted(ctx, res)
+		}
+		return ctx, nil
+	}
+}
+
+func clientIP(ctx context.Context, trusted []netip.Prefix) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	for _, prefix := range trusted {
+		if !prefix.Contains(addr.Unmap()) {
+			continue
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		if v := md.Get(ratelimit.ClientIPMetadata); len(v) > 0 && v[0] != "" {
+			return v[0]
+		}
+		break
+	}
+	return host
+}
+
+// exhausted refuses a call over the limit with a retry-after trailer in
+// seconds.
+func exhausted(ctx context.Context, res ratelimit.Result) error {
+	retry := strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds())))
+	_ = grpc.SetTrailer(ctx, metadata.Pairs("retry-after", retry))
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %ss", retry)
+}
+
+func caller(ctx context.Context) string {
+	if claims, ok := auth.ClaimsFromContext(ctx); ok && claims.Subject != "" {
+		return "user:" + claims.Subject
+	}
+	if ip, ok := ratelimit.ClientIPFromContext(ctx); ok {
+		return "ip:" + ip
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return "ip:" + host
+		}
+		return "ip:" + p.Addr.String()
+	}
+	return "unknown"
+}
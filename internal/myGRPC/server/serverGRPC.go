@@ -2,13 +2,18 @@ package server
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"gin_training/internal/model"
 	pb "gin_training/internal/proto"
+	"gin_training/internal/storage/cache"
 	storage "gin_training/internal/storage/postgreSQL"
+	"gin_training/internal/validation"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type StorageServer struct {
@@ -23,34 +28,45 @@ func NewGRPCStorage(store storage.DB) *StorageServer {
 	}
 }
 
-func (s *StorageServer) FindAll(_ context.Context, in *emptypb.Empty) (*pb.AllBooks, error) {
-	books := s.Storage.FindAll()
+func (s *StorageServer) FindAll(ctx context.Context, in *pb.ListBooksRequest) (*pb.AllBooks, error) {
+	mask := model.ReadMask(in.GetReadMask().GetPaths())
+	if err := mask.Validate(); err != nil {
+		return nil, statusError(err, "invalid read mask")
+	}
+
+	books, rev, err := s.Storage.FindAll(ctx, mask)
+	if err != nil {
+		return nil, statusError(err, "failed to list books")
+	}
 
 	pbBooks := []*pb.BookObj{}
 
 	for _, val := range books {
-		res := val.ID.String()
-		pbBooks = append(pbBooks, &pb.BookObj{
-			Id:     res,
-			Title:  val.Title,
-			Author: val.Author,
-		})
+		pbBooks = append(pbBooks, maskedBook(val, mask))
 	}
 
 	return &pb.AllBooks{
 		Allbooks: pbBooks,
+		Revision: revisionToProto(rev),
 	}, nil
 }
-func (s *StorageServer) Create(_ context.Context, in *pb.BookObj) (*pb.BookObj, error) {
-	b := model.Book{
+func (s *StorageServer) Create(ctx context.Context, in *pb.BookObj) (*pb.BookObj, error) {
+	input := model.CreateBookInput{
 		Title:  in.Title,
 		Author: in.Author,
 	}
+	if err := validation.Default().ValidateStruct(&input); err != nil {
+		return nil, statusError(err, "invalid book")
+	}
 
-	book, err := s.Storage.Create(b)
+	b := model.Book{
+		Title:  input.Title,
+		Author: input.Author,
+	}
+
+	book, err := s.Storage.Create(ctx, b)
 	if err != nil {
-		fmt.Printf(error.Error(err))
-		return nil, status.Error(codes.Internal, "internal storage problem")
+		return nil, statusError(err, "internal storage problem")
 	}
 
 	res := book.ID.String()
@@ -61,31 +77,56 @@ func (s *StorageServer) Create(_ context.Context, in *pb.BookObj) (*pb.BookObj,
 		Author: book.Author,
 	}, nil
 }
-func (s *StorageServer) GetBook(_ context.Context, in *pb.BookID) (*pb.BookObj, error) {
-	book, err := s.Storage.GetBook(in.ID)
+func (s *StorageServer) GetBook(ctx context.Context, in *pb.BookID) (*pb.BookObj, error) {
+	mask := model.ReadMask(in.GetReadMask().GetPaths())
+	if err := mask.Validate(); err != nil {
+		return nil, statusError(err, "invalid read mask")
+	}
+	if md, _ := metadata.FromIncomingContext(ctx); len(md.Get(cache.BypassMetadata)) > 0 {
+		ctx = cache.Bypass(ctx)
+	}
+
+	book, err := s.Storage.GetBook(ctx, in.ID, mask)
 	if err != nil {
-		return nil, status.Error(codes.NotFound, "failed to get post")
+		return nil, statusError(err, "failed to get book")
 	}
 
-	res := book.ID.String()
+	obj := maskedBook(book, mask)
+	obj.Revision = revisionToProto(book.Revision)
+	return obj, nil
+}
 
-	return &pb.BookObj{
-		Id:     res,
-		Title:  book.Title,
-		Author: book.Author,
-	}, nil
+func (s *StorageServer) GetCatalogRevision(ctx context.Context, _ *emptypb.Empty) (*pb.Revision, error) {
+	r, err := s.Storage.CatalogRevision(ctx)
+	if err != nil {
+		return nil, statusError(err, "failed to get catalog revision")
+	}
+	return revisionToProto(r), nil
+}
+
+func (s *StorageServer) GetBookRevision(ctx context.Context, in *pb.BookID) (*pb.Revision, error) {
+	r, err := s.Storage.BookRevision(ctx, in.ID)
+	if err != nil {
+		return nil, statusError(err, "failed to get book revision")
+	}
+	return revisionToProto(r), nil
 }
 
-func (s *StorageServer) UpdateBook(_ context.Context, in *pb.NewBook) (*pb.BookObj, error) {
+func (s *StorageServer) UpdateBook(ctx context.Context, in *pb.NewBook) (*pb.BookObj, error) {
 
 	book := model.UpdateBookInput{
-		Title:  in.Book.Title,
-		Author: in.Book.Author,
+		Title:     in.GetBook().GetTitle(),
+		Author:    in.GetBook().GetAuthor(),
+		Fields:    in.GetUpdateMask().GetPaths(),
+		IfVersion: in.GetIfVersion(),
+	}
+	if err := validation.Default().ValidateStruct(&book); err != nil {
+		return nil, statusError(err, "invalid book")
 	}
 
-	res, err := s.Storage.UpdateBook(in.ID, book)
+	res, err := s.Storage.UpdateBook(ctx, in.ID, book)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "failed to update post")
+		return nil, statusError(err, "failed to update book")
 	}
 
 	resId := res.ID.String()
@@ -96,11 +137,64 @@ func (s *StorageServer) UpdateBook(_ context.Context, in *pb.NewBook) (*pb.BookO
 		Author: res.Author,
 	}, nil
 }
-func (s *StorageServer) DeleteBook(_ context.Context, in *pb.BookID) (*emptypb.Empty, error) {
+func (s *StorageServer) DeleteBook(ctx context.Context, in *pb.BookID) (*emptypb.Empty, error) {
 
-	err := s.Storage.DeleteBook(in.ID)
+	err := s.Storage.DeleteBook(ctx, in.ID)
 	if err != nil {
-		return nil, status.Errorf(codes.NotFound, "failed to delete post")
+		return nil, statusError(err, "failed to delete book")
 	}
 	return &emptypb.Empty{}, nil
 }
+
+// maskedBook converts a book leaving the fields outside of mask unset.
+func maskedBook(b model.Book, mask model.ReadMask) *pb.BookObj {
+	obj := &pb.BookObj{
+		Title:  b.Title,
+		Author: b.Author,
+	}
+	if mask.Has(model.FieldID) {
+		obj.Id = b.ID.String()
+	}
+	return obj
+}
+
+// revisionToProto converts r, leaving an unknown revision unset.
+func revisionToProto(r model.Revision) *pb.Revision {
+	if r.Version == 0 {
+		return nil
+	}
+	return &pb.Revision{Version: r.Version, UpdatedAt: timestamppb.New(r.UpdatedAt)}
+}
+
+// statusError converts a storage error into a gRPC status so that clients
+// can tell a missing book from a broken backend.
+func statusError(err error, msg string) error {
+	var ve *validation.Error
+	if errors.As(err, &ve) {
+		br := &errdetails.BadRequest{}
+		for _, v := range ve.Violations {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Description,
+			})
+		}
+		st, detErr := status.New(codes.InvalidArgument, msg).WithDetails(br)
+		if detErr != nil {
+			return status.Error(codes.InvalidArgument, msg)
+		}
+		return st.Err()
+	}
+
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, msg)
+	case errors.Is(err, storage.ErrInvalidArgument):
+		return status.Error(codes.InvalidArgument, msg)
+	case errors.Is(err, storage.ErrUnavailable):
+		return status.Error(codes.Unavailable, msg)
+	case errors.Is(err, storage.ErrConflict):
+		return status.Error(codes.Aborted, msg)
+	default:
+		return status.Error(codes.Internal, msg)
+	}
+}
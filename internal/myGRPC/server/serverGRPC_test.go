@@ -1,25 +1,58 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"gin_training/internal/auth"
+	"gin_training/internal/logging"
 	"gin_training/internal/model"
 	pb "gin_training/internal/proto"
+	"gin_training/internal/ratelimit"
+	"gin_training/internal/rbac"
+	"gin_training/internal/storage/cache"
+	storage "gin_training/internal/storage/postgreSQL"
 	"gin_training/internal/storage/postgreSQL/mocks"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log/slog"
+	"net"
+	"net/url"
 	"testing"
+	"time"
 )
 
 func TestStorageServer_GetBook(t *testing.T) {
 	s := new(mocks.DB)
 	idStr := "00000000-0000-0000-0000-000000000000"
 	id, _ := uuid.Parse(idStr)
-	b := model.Book{id, "title", "author"}
-	s.On("GetBook", idStr).Return(b, nil)
+	b := model.Book{ID: id, Title: "title", Author: "author"}
+	s.On("GetBook", mock.Anything, idStr, model.ReadMask(nil)).Return(b, nil)
 
 	var tests = []struct {
 		name    string
@@ -53,8 +86,8 @@ func TestStorageServer_Create(t *testing.T) {
 	idStr := "00000000-0000-0000-0000-000000000000"
 	id, _ := uuid.Parse(idStr)
 	bb := model.Book{Title: "title", Author: "author"}
-	b := model.Book{id, "title", "author"}
-	s.On("Create", bb).Return(b, nil)
+	b := model.Book{ID: id, Title: "title", Author: "author"}
+	s.On("Create", mock.Anything, bb).Return(b, nil)
 
 	var tests = []struct {
 		name    string
@@ -87,14 +120,15 @@ func TestStorageServer_FindAll(t *testing.T) {
 	s := new(mocks.DB)
 	idStr := "00000000-0000-0000-0000-000000000000"
 	id, _ := uuid.Parse(idStr)
-	b := []model.Book{{id, "title", "author"}}
-	s.On("FindAll").Return(b, nil)
+	b := []model.Book{{ID: id, Title: "title", Author: "author"}}
+	updated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.On("FindAll", mock.Anything, model.ReadMask(nil)).Return(b, model.Revision{Version: 7, UpdatedAt: updated}, nil)
 
 	all := []*pb.BookObj{
 		{Id: "00000000-0000-0000-0000-000000000000", Title: "title", Author: "author"},
 	}
 
-	aa := pb.AllBooks{Allbooks: all}
+	aa := pb.AllBooks{Allbooks: all, Revision: &pb.Revision{Version: 7, UpdatedAt: timestamppb.New(updated)}}
 
 	var tests = []struct {
 		name    string
@@ -111,7 +145,7 @@ func TestStorageServer_FindAll(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			u := NewGRPCStorage(tc.stor)
-			got, err := u.FindAll(context.Background(), &emptypb.Empty{})
+			got, err := u.FindAll(context.Background(), &pb.ListBooksRequest{})
 			if err != nil && status.Code(err) != tc.wantErr {
 				t.Errorf("error = %v, wantErr %v", err.Error(), tc.wantErr)
 				return
@@ -127,8 +161,8 @@ func TestStorageServer_UpdateBook(t *testing.T) {
 	id, _ := uuid.Parse(idStr)
 	nb := pb.BookObj{Title: "title", Author: "author"}
 	n := pb.NewBook{ID: idStr, Book: &nb}
-	b := model.Book{id, "title", "author"}
-	s.On("UpdateBook", mock.Anything, mock.Anything).Return(b, nil)
+	b := model.Book{ID: id, Title: "title", Author: "author"}
+	s.On("UpdateBook", mock.Anything, mock.Anything, mock.Anything).Return(b, nil)
 
 	var tests = []struct {
 		name    string
@@ -160,7 +194,7 @@ func TestStorageServer_UpdateBook(t *testing.T) {
 func TestStorageServer_DeleteBook(t *testing.T) {
 	s := new(mocks.DB)
 	idStr := "00000000-0000-0000-0000-000000000000"
-	s.On("DeleteBook", idStr).Return(nil)
+	s.On("DeleteBook", mock.Anything, idStr).Return(nil)
 
 	var tests = []struct {
 		name    string
@@ -188,3 +222,603 @@ func TestStorageServer_DeleteBook(t *testing.T) {
 		})
 	}
 }
+
+func TestStorageServer_CreateInvalid(t *testing.T) {
+	s := new(mocks.DB)
+	u := NewGRPCStorage(s)
+
+	_, err := u.Create(context.Background(), &pb.BookObj{Title: "title", Author: "auth\x07or"})
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		br := st.Details()[0].(*errdetails.BadRequest)
+		assert.Equal(t, "author", br.FieldViolations[0].Field)
+		assert.Equal(t, "must not contain control characters", br.FieldViolations[0].Description)
+	}
+	s.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestStorageServer_UpdateBookMasked(t *testing.T) {
+	s := new(mocks.DB)
+	idStr := "00000000-0000-0000-0000-000000000000"
+	id, _ := uuid.Parse(idStr)
+	in := model.UpdateBookInput{Title: "title", Fields: []string{"author"}}
+	s.On("UpdateBook", mock.Anything, idStr, in).Return(model.Book{ID: id, Title: "title"}, nil)
+
+	u := NewGRPCStorage(s)
+	got, err := u.UpdateBook(context.Background(), &pb.NewBook{
+		ID:         idStr,
+		Book:       &pb.BookObj{Title: "title"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"author"}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &pb.BookObj{Id: idStr, Title: "title"}, got)
+}
+
+func TestStorageServer_UpdateBookRepeatedMask(t *testing.T) {
+	s := new(mocks.DB)
+	u := NewGRPCStorage(s)
+
+	_, err := u.UpdateBook(context.Background(), &pb.NewBook{
+		ID:         "00000000-0000-0000-0000-000000000000",
+		Book:       &pb.BookObj{Title: "title"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title", "title"}},
+	})
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		br := st.Details()[0].(*errdetails.BadRequest)
+		assert.Equal(t, "title", br.FieldViolations[0].Field)
+		assert.Equal(t, "is listed more than once", br.FieldViolations[0].Description)
+	}
+	s.AssertNotCalled(t, "UpdateBook", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestStorageServer_UpdateBookIfVersion(t *testing.T) {
+	s := new(mocks.DB)
+	idStr := "00000000-0000-0000-0000-000000000000"
+	in := model.UpdateBookInput{Title: "title", Fields: []string{"title"}, IfVersion: 3}
+	s.On("UpdateBook", mock.Anything, idStr, in).Return(model.Book{}, fmt.Errorf("couldn't update book: %w", storage.ErrConflict))
+
+	u := NewGRPCStorage(s)
+	_, err := u.UpdateBook(context.Background(), &pb.NewBook{
+		ID:         idStr,
+		Book:       &pb.BookObj{Title: "title"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title"}},
+		IfVersion:  3,
+	})
+
+	assert.Equal(t, codes.Aborted, status.Code(err))
+}
+
+func TestStorageServer_GetBookBypassingCache(t *testing.T) {
+	s := new(mocks.DB)
+	idStr := "00000000-0000-0000-0000-000000000000"
+	s.On("GetBook", mock.MatchedBy(cache.Bypassed), idStr, model.ReadMask(nil)).Return(model.Book{}, nil)
+
+	u := NewGRPCStorage(s)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(cache.BypassMetadata, "true"))
+	_, err := u.GetBook(ctx, &pb.BookID{ID: idStr})
+
+	assert.NoError(t, err)
+	s.AssertExpectations(t)
+}
+
+func TestStorageServer_Revisions(t *testing.T) {
+	s := new(mocks.DB)
+	idStr := "00000000-0000-0000-0000-000000000000"
+	id, _ := uuid.Parse(idStr)
+	updated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rev := model.Revision{Version: 3, UpdatedAt: updated}
+	s.On("GetBook", mock.Anything, idStr, model.ReadMask{"title"}).Return(model.Book{ID: id, Title: "title", Revision: rev}, nil)
+	s.On("BookRevision", mock.Anything, idStr).Return(rev, nil)
+	s.On("BookRevision", mock.Anything, "missing").Return(model.Revision{}, storage.ErrNotFound)
+	s.On("CatalogRevision", mock.Anything).Return(model.Revision{Version: 9, UpdatedAt: updated}, nil)
+
+	u := NewGRPCStorage(s)
+	want := &pb.Revision{Version: 3, UpdatedAt: timestamppb.New(updated)}
+
+	got, err := u.GetBook(context.Background(), &pb.BookID{ID: idStr, ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"title"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, &pb.BookObj{Title: "title", Revision: want}, got)
+
+	r, err := u.GetBookRevision(context.Background(), &pb.BookID{ID: idStr})
+	assert.NoError(t, err)
+	assert.Equal(t, want, r)
+
+	_, err = u.GetBookRevision(context.Background(), &pb.BookID{ID: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	r, err = u.GetCatalogRevision(context.Background(), &emptypb.Empty{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), r.Version)
+}
+
+func TestStorageServer_FindAllMasked(t *testing.T) {
+	s := new(mocks.DB)
+	s.On("FindAll", mock.Anything, model.ReadMask{"title"}).Return([]model.Book{{Title: "title"}}, model.Revision{}, nil)
+
+	u := NewGRPCStorage(s)
+
+	got, err := u.FindAll(context.Background(), &pb.ListBooksRequest{ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"title"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, &pb.AllBooks{Allbooks: []*pb.BookObj{{Title: "title"}}}, got)
+
+	_, err = u.FindAll(context.Background(), &pb.ListBooksRequest{ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"isbn"}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: []byte("secret")})
+	assert.NoError(t, err)
+	keys := new(mocks.APIKeyStore)
+	keys.On("AuthenticateAPIKey", mock.Anything, "bk_librarian").Return(model.APIKey{Owner: "batch", Scopes: []string{"books:write", "role:librarian"}}, nil)
+	keys.On("AuthenticateAPIKey", mock.Anything, "bk_revoked").Return(model.APIKey{}, storage.ErrNotFound)
+	interceptor := AuthInterceptor(verifier, rbac.NewEnforcer(rbac.DefaultPolicy()), keys)
+	streamInterceptor := AuthStreamInterceptor(verifier, rbac.NewEnforcer(rbac.DefaultPolicy()), keys)
+
+	token := func(scope string, roles ...string) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+			Scope:            scope,
+			Roles:            roles,
+		}).SignedString([]byte("secret"))
+		assert.NoError(t, err)
+		return "Bearer " + s
+	}
+
+	var tests = []struct {
+		name          string
+		method        string
+		authorization string
+		apiKey        string
+		wantCode      codes.Code
+		wantSession   string
+	}{
+		{
+			name:     "Missing token",
+			method:   "/proto.BookService/FindAll",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:          "Invalid token",
+			method:        "/proto.BookService/FindAll",
+			authorization: "Bearer nope",
+			wantCode:      codes.Unauthenticated,
+		},
+		{
+			name:          "Reader lists",
+			method:        "/proto.BookService/FindAll",
+			authorization: token("books:read", rbac.RoleReader),
+			wantCode:      codes.OK,
+		},
+		{
+			name:          "Missing scope",
+			method:        "/proto.BookService/DeleteBook",
+			authorization: token("books:read", rbac.RoleLibrarian),
+			wantCode:      codes.PermissionDenied,
+		},
+		{
+			name:          "Reader can't delete",
+			method:        "/proto.BookService/DeleteBook",
+			authorization: token("books:read books:write", rbac.RoleReader),
+			wantCode:      codes.PermissionDenied,
+		},
+		{
+			name:          "Librarian deletes",
+			method:        "/proto.BookService/DeleteBook",
+			authorization: token("books:write", rbac.RoleLibrarian),
+			wantCode:      codes.OK,
+		},
+		{
+			name:        "API key",
+			method:      "/proto.BookService/DeleteBook",
+			apiKey:      "bk_librarian",
+			wantCode:    codes.OK,
+			wantSession: "batch",
+		},
+		{
+			name:     "Revoked API key",
+			method:   "/proto.BookService/FindAll",
+			apiKey:   "bk_revoked",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "API key without admin scope",
+			method:   "/proto.APIKeyService/ListAPIKeys",
+			apiKey:   "bk_librarian",
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "Authenticating a key is public",
+			method:   "/proto.APIKeyService/AuthenticateAPIKey",
+			wantCode: codes.OK,
+		},
+		{
+			name:     "Health checks are public",
+			method:   "/grpc.health.v1.Health/Check",
+			wantCode: codes.OK,
+		},
+		{
+			name:     "Watching health is public",
+			method:   "/grpc.health.v1.Health/Watch",
+			wantCode: codes.OK,
+		},
+		{
+			name:          "Unknown method",
+			method:        "/proto.BookService/Purge",
+			authorization: token("books:write", rbac.RoleAdmin),
+			wantCode:      codes.PermissionDenied,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			md := metadata.MD{}
+			if tc.authorization != "" {
+				md.Set("authorization", tc.authorization)
+			}
+			if tc.apiKey != "" {
+				md.Set("x-api-key", tc.apiKey)
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), md)
+
+			var session string
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				session, _ = storage.SessionFromContext(ctx)
+				return &emptypb.Empty{}, nil
+			}
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method}, handler)
+			assert.Equal(t, tc.wantCode, status.Code(err))
+			assert.Equal(t, tc.wantSession, session)
+
+			// Streams are checked the same way.
+			session = ""
+			streamHandler := func(srv interface{}, ss grpc.ServerStream) error {
+				session, _ = storage.SessionFromContext(ss.Context())
+				return nil
+			}
+			err = streamInterceptor(nil, testStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: tc.method}, streamHandler)
+			assert.Equal(t, tc.wantCode, status.Code(err))
+			assert.Equal(t, tc.wantSession, session)
+		})
+	}
+}
+
+func TestAPIKeyServer_CreateAPIKey(t *testing.T) {
+	keys := new(mocks.APIKeyStore)
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	id := uuid.New()
+	keys.On("CreateAPIKey", mock.Anything, model.CreateAPIKeyInput{Owner: "batch", Scopes: []string{"books:read"}}).
+		Return(model.APIKey{ID: id, Key: "bk_secret", Owner: "batch", Scopes: []string{"books:read"}, CreatedAt: created}, nil)
+
+	var tests = []struct {
+		name     string
+		param    *pb.NewAPIKey
+		want     *pb.APIKey
+		wantCode codes.Code
+	}{
+		{
+			name:  "Create everything good",
+			param: &pb.NewAPIKey{Owner: " batch ", Scopes: []string{"books:read"}},
+			want:  &pb.APIKey{Id: id.String(), Key: "bk_secret", Owner: "batch", Scopes: []string{"books:read"}, CreatedAt: timestamppb.New(created)},
+		},
+		{
+			name:     "Unknown scope",
+			param:    &pb.NewAPIKey{Owner: "batch", Scopes: []string{"books:everything"}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Expired",
+			param:    &pb.NewAPIKey{Owner: "batch", Scopes: []string{"books:read"}, ExpiresAt: timestamppb.New(created.AddDate(-1, 0, 0))},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			u := NewGRPCAPIKeys(keys)
+			got, err := u.CreateAPIKey(context.Background(), tc.param)
+			assert.Equal(t, tc.wantCode, status.Code(err))
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestAPIKeyServer_AuthenticateAPIKey(t *testing.T) {
+	keys := new(mocks.APIKeyStore)
+	keys.On("FindAPIKey", mock.Anything, "bk_revoked").Return(model.APIKey{}, storage.ErrNotFound)
+	keys.On("FindAPIKey", mock.Anything, "bk_reader").Return(model.APIKey{ID: uuid.New(), Owner: "batch", Scopes: []string{"books:read"}}, nil)
+
+	u := NewGRPCAPIKeys(keys)
+
+	_, err := u.AuthenticateAPIKey(context.Background(), &emptypb.Empty{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "bk_revoked"))
+	_, err = u.AuthenticateAPIKey(ctx, &emptypb.Empty{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// The key is only read, the calls made with it record its use.
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "bk_reader"))
+	got, err := u.AuthenticateAPIKey(ctx, &emptypb.Empty{})
+	assert.NoError(t, err)
+	assert.Equal(t, "batch", got.GetOwner())
+	keys.AssertNotCalled(t, "AuthenticateAPIKey", mock.Anything, mock.Anything)
+}
+
+// testStream is a server stream carrying ctx.
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s testStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestPeerInterceptor(t *testing.T) {
+	interceptor := PeerInterceptor([]string{"spiffe://books/gateway"})
+	streamInterceptor := PeerStreamInterceptor([]string{"spiffe://books/gateway"})
+
+	gateway, _ := url.Parse("spiffe://books/gateway")
+	peerWith := func(cert *x509.Certificate) context.Context {
+		info := credentials.TLSInfo{}
+		if cert != nil {
+			info.State = tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: info})
+	}
+
+	var tests = []struct {
+		name     string
+		ctx      context.Context
+		wantCode codes.Code
+	}{
+		{
+			name:     "Allowed identity",
+			ctx:      peerWith(&x509.Certificate{Subject: pkix.Name{CommonName: "gateway"}, URIs: []*url.URL{gateway}}),
+			wantCode: codes.OK,
+		},
+		{
+			name:     "Other identity",
+			ctx:      peerWith(&x509.Certificate{Subject: pkix.Name{CommonName: "batch"}}),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "No client certificate",
+			ctx:      peerWith(nil),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "No peer",
+			ctx:      context.Background(),
+			wantCode: codes.Unauthenticated,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &emptypb.Empty{}, nil
+			}
+
+			_, err := interceptor(tc.ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/proto.BookService/FindAll"}, handler)
+			assert.Equal(t, tc.wantCode, status.Code(err))
+
+			// Streams are checked the same way.
+			streamHandler := func(srv interface{}, ss grpc.ServerStream) error {
+				return nil
+			}
+			err = streamInterceptor(nil, testStream{ctx: tc.ctx}, &grpc.StreamServerInfo{FullMethod: "/grpc.health.v1.Health/Watch"}, streamHandler)
+			assert.Equal(t, tc.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	interceptor := RateLimitInterceptor(ratelimit.New(ratelimit.Config{Default: ratelimit.Limit{Rate: 0.1, Burst: 1}}))
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &emptypb.Empty{}, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/proto.BookService/FindAll"}
+	alice := auth.WithClaims(context.Background(), &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "alice"}})
+	bob := auth.WithClaims(context.Background(), &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "bob"}})
+
+	_, err := interceptor(alice, nil, info, handler)
+	assert.NoError(t, err)
+
+	_, err = interceptor(alice, nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	_, err = interceptor(bob, nil, info, handler)
+	assert.NoError(t, err)
+}
+
+func TestIPRateLimitInterceptor(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.Config{
+		Default: ratelimit.Limit{Rate: 100, Burst: 100},
+		PerIP:   ratelimit.Limit{Rate: 0.1, Burst: 1},
+	})
+	interceptor := IPRateLimitInterceptor(limiter, []string{"10.0.0.0/8"})
+
+	var seen string
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		seen, _ = ratelimit.ClientIPFromContext(ctx)
+		return &emptypb.Empty{}, nil
+	}
+	call := func(addr, forwarded string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 1234}})
+		if forwarded != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(ratelimit.ClientIPMetadata, forwarded))
+		}
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/proto.APIKeyService/AuthenticateAPIKey"}, handler)
+		return err
+	}
+
+	assert.NoError(t, call("192.0.2.1", ""))
+	assert.Equal(t, "192.0.2.1", seen)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("192.0.2.1", "")))
+
+	// Only a trusted proxy forwards the address of its client.
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("192.0.2.1", "198.51.100.1")))
+	assert.NoError(t, call("10.0.0.1", "198.51.100.1"))
+	assert.Equal(t, "198.51.100.1", seen)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("10.0.0.2", "198.51.100.1")))
+	assert.NoError(t, call("10.0.0.1", "198.51.100.2"))
+}
+
+func TestTracingInterceptor(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/proto.BookService/GetBook"}
+	md := metadata.Pairs("traceparent", "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01")
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+
+	var handlerSpan trace.SpanContext
+	_, err := TracingInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		return nil, status.Error(codes.NotFound, "no book")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	spans := sr.Ended()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.Equal(t, "proto.BookService/GetBook", span.Name())
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+		assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", span.SpanContext().TraceID().String())
+		assert.Equal(t, "0102030405060708", span.Parent().SpanID().String())
+		assert.Equal(t, span.SpanContext(), handlerSpan)
+		assert.Equal(t, otelcodes.Error, span.Status().Code)
+	}
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	interceptor := LoggingInterceptor(logging.New(&buf, slog.LevelInfo))
+	info := &grpc.UnaryServerInfo{FullMethod: "/proto.BookService/DeleteBook"}
+
+	tests := []struct {
+		name      string
+		md        metadata.MD
+		err       error
+		wantLevel string
+		reused    bool
+	}{
+		{
+			name:      "Request ID of the gateway",
+			md:        metadata.Pairs("x-request-id", "req-42"),
+			wantLevel: "INFO",
+			reused:    true,
+		},
+		{
+			name:      "Direct caller",
+			md:        metadata.MD{},
+			err:       status.Error(codes.NotFound, "no book"),
+			wantLevel: "INFO",
+		},
+		{
+			name:      "Server fault",
+			md:        metadata.Pairs("x-request-id", "bad id"),
+			err:       status.Error(codes.Internal, "internal storage problem"),
+			wantLevel: "ERROR",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			ctx := metadata.NewIncomingContext(context.Background(), tc.md)
+
+			var handlerID string
+			_, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				handlerID, _ = logging.RequestIDFromContext(ctx)
+				return nil, tc.err
+			})
+			assert.Equal(t, tc.err, err)
+
+			if tc.reused {
+				assert.Equal(t, "req-42", handlerID)
+			} else {
+				assert.True(t, logging.ValidRequestID(handlerID))
+			}
+
+			var line map[string]interface{}
+			assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+			assert.Equal(t, tc.wantLevel, line["level"])
+			assert.Equal(t, handlerID, line["request_id"])
+			assert.Equal(t, info.FullMethod, line["method"])
+			assert.Equal(t, status.Code(tc.err).String(), line["code"])
+		})
+	}
+}
+
+func TestGracefulStop(t *testing.T) {
+	tests := []struct {
+		name    string
+		release bool
+		wantErr error
+	}{
+		{
+			name:    "Pending call finishes",
+			release: true,
+		},
+		{
+			name:    "Pending call outlives the timeout",
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			started, release := make(chan struct{}), make(chan struct{})
+			s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				close(started)
+				select {
+				case <-release:
+					return handler(ctx, req)
+				case <-ctx.Done():
+					return nil, status.FromContextError(ctx.Err()).Err()
+				}
+			}))
+			healthpb.RegisterHealthServer(s, grpchealth.NewServer())
+
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			go s.Serve(lis)
+
+			conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			callErr := make(chan error, 1)
+			go func() {
+				_, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+				callErr <- err
+			}()
+			<-started
+
+			if tc.release {
+				time.AfterFunc(20*time.Millisecond, func() { close(release) })
+			}
+
+			timeout := 5 * time.Second
+			if !tc.release {
+				timeout = 50 * time.Millisecond
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			assert.Equal(t, tc.wantErr, GracefulStop(ctx, s))
+			if tc.release {
+				assert.NoError(t, <-callErr)
+			} else {
+				assert.Error(t, <-callErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// GracefulStop stops s from accepting calls and waits for the pending ones
+// to finish. Once ctx is done the remaining calls are cancelled and ctx's
+// error is returned.
+func GracefulStop(ctx context.Context, s *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		<-stopped
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// guard checks a call to method before its handler runs and returns the
+// context the handler gets. Guards apply to unary calls and streams alike,
+// so streaming methods such as Health/Watch can't get around them.
+type guard func(ctx context.Context, method string) (context.Context, error)
+
+func (g guard) unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := g(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (g guard) stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := g(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream is a stream whose handler sees ctx.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -19,11 +19,15 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type BookServiceClient interface {
-	FindAll(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*AllBooks, error)
+	FindAll(ctx context.Context, in *ListBooksRequest, opts ...grpc.CallOption) (*AllBooks, error)
 	Create(ctx context.Context, in *BookObj, opts ...grpc.CallOption) (*BookObj, error)
 	GetBook(ctx context.Context, in *BookID, opts ...grpc.CallOption) (*BookObj, error)
 	UpdateBook(ctx context.Context, in *NewBook, opts ...grpc.CallOption) (*BookObj, error)
 	DeleteBook(ctx context.Context, in *BookID, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// GetCatalogRevision and GetBookRevision tell when the books changed
+	// without reading them, to answer conditional requests.
+	GetCatalogRevision(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Revision, error)
+	GetBookRevision(ctx context.Context, in *BookID, opts ...grpc.CallOption) (*Revision, error)
 }
 
 type bookServiceClient struct {
@@ -34,7 +38,7 @@ func NewBookServiceClient(cc grpc.ClientConnInterface) BookServiceClient {
 	return &bookServiceClient{cc}
 }
 
-func (c *bookServiceClient) FindAll(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*AllBooks, error) {
+func (c *bookServiceClient) FindAll(ctx context.Context, in *ListBooksRequest, opts ...grpc.CallOption) (*AllBooks, error) {
 	out := new(AllBooks)
 	err := c.cc.Invoke(ctx, "/proto.BookService/FindAll", in, out, opts...)
 	if err != nil {
@@ -79,15 +83,37 @@ func (c *bookServiceClient) DeleteBook(ctx context.Context, in *BookID, opts ...
 	return out, nil
 }
 
+func (c *bookServiceClient) GetCatalogRevision(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Revision, error) {
+	out := new(Revision)
+	err := c.cc.Invoke(ctx, "/proto.BookService/GetCatalogRevision", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookServiceClient) GetBookRevision(ctx context.Context, in *BookID, opts ...grpc.CallOption) (*Revision, error) {
+	out := new(Revision)
+	err := c.cc.Invoke(ctx, "/proto.BookService/GetBookRevision", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // BookServiceServer is the server API for BookService service.
 // All implementations must embed UnimplementedBookServiceServer
 // for forward compatibility
 type BookServiceServer interface {
-	FindAll(context.Context, *emptypb.Empty) (*AllBooks, error)
+	FindAll(context.Context, *ListBooksRequest) (*AllBooks, error)
 	Create(context.Context, *BookObj) (*BookObj, error)
 	GetBook(context.Context, *BookID) (*BookObj, error)
 	UpdateBook(context.Context, *NewBook) (*BookObj, error)
 	DeleteBook(context.Context, *BookID) (*emptypb.Empty, error)
+	// GetCatalogRevision and GetBookRevision tell when the books changed
+	// without reading them, to answer conditional requests.
+	GetCatalogRevision(context.Context, *emptypb.Empty) (*Revision, error)
+	GetBookRevision(context.Context, *BookID) (*Revision, error)
 	mustEmbedUnimplementedBookServiceServer()
 }
 
@@ -95,7 +121,7 @@ type BookServiceServer interface {
 type UnimplementedBookServiceServer struct {
 }
 
-func (UnimplementedBookServiceServer) FindAll(context.Context, *emptypb.Empty) (*AllBooks, error) {
+func (UnimplementedBookServiceServer) FindAll(context.Context, *ListBooksRequest) (*AllBooks, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method FindAll not implemented")
 }
 func (UnimplementedBookServiceServer) Create(context.Context, *BookObj) (*BookObj, error) {
@@ -110,6 +136,12 @@ func (UnimplementedBookServiceServer) UpdateBook(context.Context, *NewBook) (*Bo
 func (UnimplementedBookServiceServer) DeleteBook(context.Context, *BookID) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteBook not implemented")
 }
+func (UnimplementedBookServiceServer) GetCatalogRevision(context.Context, *emptypb.Empty) (*Revision, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCatalogRevision not implemented")
+}
+func (UnimplementedBookServiceServer) GetBookRevision(context.Context, *BookID) (*Revision, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBookRevision not implemented")
+}
 func (UnimplementedBookServiceServer) mustEmbedUnimplementedBookServiceServer() {}
 
 // UnsafeBookServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -124,7 +156,7 @@ func RegisterBookServiceServer(s grpc.ServiceRegistrar, srv BookServiceServer) {
 }
 
 func _BookService_FindAll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(emptypb.Empty)
+	in := new(ListBooksRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -136,7 +168,7 @@ func _BookService_FindAll_Handler(srv interface{}, ctx context.Context, dec func
 		FullMethod: "/proto.BookService/FindAll",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(BookServiceServer).FindAll(ctx, req.(*emptypb.Empty))
+		return srv.(BookServiceServer).FindAll(ctx, req.(*ListBooksRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -213,6 +245,42 @@ func _BookService_DeleteBook_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _BookService_GetCatalogRevision_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookServiceServer).GetCatalogRevision(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.BookService/GetCatalogRevision",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookServiceServer).GetCatalogRevision(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookService_GetBookRevision_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BookID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookServiceServer).GetBookRevision(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.BookService/GetBookRevision",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookServiceServer).GetBookRevision(ctx, req.(*BookID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // BookService_ServiceDesc is the grpc.ServiceDesc for BookService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -240,6 +308,214 @@ var BookService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteBook",
 			Handler:    _BookService_DeleteBook_Handler,
 		},
+		{
+			MethodName: "GetCatalogRevision",
+			Handler:    _BookService_GetCatalogRevision_Handler,
+		},
+		{
+			MethodName: "GetBookRevision",
+			Handler:    _BookService_GetBookRevision_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "books.proto",
+}
+
+// APIKeyServiceClient is the client API for APIKeyService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type APIKeyServiceClient interface {
+	// CreateAPIKey returns the plaintext key, it's only stored hashed.
+	CreateAPIKey(ctx context.Context, in *NewAPIKey, opts ...grpc.CallOption) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*APIKeys, error)
+	RevokeAPIKey(ctx context.Context, in *APIKeyID, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// AuthenticateAPIKey resolves the key sent in the "x-api-key" metadata,
+	// its use is recorded by the calls made with it.
+	AuthenticateAPIKey(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*APIKey, error)
+}
+
+type aPIKeyServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAPIKeyServiceClient(cc grpc.ClientConnInterface) APIKeyServiceClient {
+	return &aPIKeyServiceClient{cc}
+}
+
+func (c *aPIKeyServiceClient) CreateAPIKey(ctx context.Context, in *NewAPIKey, opts ...grpc.CallOption) (*APIKey, error) {
+	out := new(APIKey)
+	err := c.cc.Invoke(ctx, "/proto.APIKeyService/CreateAPIKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIKeyServiceClient) ListAPIKeys(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*APIKeys, error) {
+	out := new(APIKeys)
+	err := c.cc.Invoke(ctx, "/proto.APIKeyService/ListAPIKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIKeyServiceClient) RevokeAPIKey(ctx context.Context, in *APIKeyID, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/proto.APIKeyService/RevokeAPIKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIKeyServiceClient) AuthenticateAPIKey(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*APIKey, error) {
+	out := new(APIKey)
+	err := c.cc.Invoke(ctx, "/proto.APIKeyService/AuthenticateAPIKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// APIKeyServiceServer is the server API for APIKeyService service.
+// All implementations must embed UnimplementedAPIKeyServiceServer
+// for forward compatibility
+type APIKeyServiceServer interface {
+	// CreateAPIKey returns the plaintext key, it's only stored hashed.
+	CreateAPIKey(context.Context, *NewAPIKey) (*APIKey, error)
+	ListAPIKeys(context.Context, *emptypb.Empty) (*APIKeys, error)
+	RevokeAPIKey(context.Context, *APIKeyID) (*emptypb.Empty, error)
+	// AuthenticateAPIKey resolves the key sent in the "x-api-key" metadata,
+	// its use is recorded by the calls made with it.
+	AuthenticateAPIKey(context.Context, *emptypb.Empty) (*APIKey, error)
+	mustEmbedUnimplementedAPIKeyServiceServer()
+}
+
+// UnimplementedAPIKeyServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedAPIKeyServiceServer struct {
+}
+
+func (UnimplementedAPIKeyServiceServer) CreateAPIKey(context.Context, *NewAPIKey) (*APIKey, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAPIKey not implemented")
+}
+func (UnimplementedAPIKeyServiceServer) ListAPIKeys(context.Context, *emptypb.Empty) (*APIKeys, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAPIKeys not implemented")
+}
+func (UnimplementedAPIKeyServiceServer) RevokeAPIKey(context.Context, *APIKeyID) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeAPIKey not implemented")
+}
+func (UnimplementedAPIKeyServiceServer) AuthenticateAPIKey(context.Context, *emptypb.Empty) (*APIKey, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AuthenticateAPIKey not implemented")
+}
+func (UnimplementedAPIKeyServiceServer) mustEmbedUnimplementedAPIKeyServiceServer() {}
+
+// UnsafeAPIKeyServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to APIKeyServiceServer will
+// result in compilation errors.
+type UnsafeAPIKeyServiceServer interface {
+	mustEmbedUnimplementedAPIKeyServiceServer()
+}
+
+func RegisterAPIKeyServiceServer(s grpc.ServiceRegistrar, srv APIKeyServiceServer) {
+	s.RegisterService(&APIKeyService_ServiceDesc, srv)
+}
+
+func _APIKeyService_CreateAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NewAPIKey)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIKeyServiceServer).CreateAPIKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.APIKeyService/CreateAPIKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIKeyServiceServer).CreateAPIKey(ctx, req.(*NewAPIKey))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _APIKeyService_ListAPIKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIKeyServiceServer).ListAPIKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.APIKeyService/ListAPIKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIKeyServiceServer).ListAPIKeys(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _APIKeyService_RevokeAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(APIKeyID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIKeyServiceServer).RevokeAPIKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.APIKeyService/RevokeAPIKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIKeyServiceServer).RevokeAPIKey(ctx, req.(*APIKeyID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _APIKeyService_AuthenticateAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIKeyServiceServer).AuthenticateAPIKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.APIKeyService/AuthenticateAPIKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIKeyServiceServer).AuthenticateAPIKey(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// APIKeyService_ServiceDesc is the grpc.ServiceDesc for APIKeyService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var APIKeyService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.APIKeyService",
+	HandlerType: (*APIKeyServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateAPIKey",
+			Handler:    _APIKeyService_CreateAPIKey_Handler,
+		},
+		{
+			MethodName: "ListAPIKeys",
+			Handler:    _APIKeyService_ListAPIKeys_Handler,
+		},
+		{
+			MethodName: "RevokeAPIKey",
+			Handler:    _APIKeyService_RevokeAPIKey_Handler,
+		},
+		{
+			MethodName: "AuthenticateAPIKey",
+			Handler:    _APIKeyService_AuthenticateAPIKey_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "books.proto",
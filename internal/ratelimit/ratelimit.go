@@ -0,0 +1,240 @@
+// Package ratelimit throttles clients with token buckets, one per client and
+// route.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Limit lets a client make Burst requests at once and refills Rate tokens
+// per second.
+type Limit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Config holds the default limit and overrides per route. HTTP routes are
+// keyed by method and path pattern, e.g. "GET /books/:id", without the API
+// version, gRPC ones by full method name, e.g. "/proto.BookService/FindAll".
+// PerIP caps every client address across routes, before it's authenticated,
+// so requests with bad credentials are throttled too.
+type Config struct {
+	Default Limit            `yaml:"default"`
+	Routes  map[string]Limit `yaml:"routes"`
+	PerIP   Limit            `yaml:"per_ip"`
+}
+
+// DefaultConfig is used without a config file, listing every book is a
+// full table scan and gets a tighter limit, and so does the public method
+// looking API keys up, which callers could use to guess keys.
+func DefaultConfig() Config {
+	return Config{
+		Default: Limit{Rate: 20, Burst: 40},
+		Routes: map[string]Limit{
+			"GET /books":                              {Rate: 2, Burst: 10},
+			"/proto.BookService/FindAll":              {Rate: 5, Burst: 20},
+			"/proto.APIKeyService/AuthenticateAPIKey": {Rate: 10, Burst: 20},
+		},
+		PerIP: Limit{Rate: 50, Burst: 100},
+	}
+}
+
+// LoadConfig reads a YAML config:
+//
+//	default: {rate: 20, burst: 40}
+//	routes:
+//	  GET /books: {rate: 2, burst: 10}
+//	per_ip: {rate: 50, burst: 100}
+//
+// A config without per_ip keeps the one of DefaultConfig.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("couldn't read rate limits: %w", err)
+	}
+
+	cfg := Config{PerIP: DefaultConfig().PerIP}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("couldn't parse rate limits %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate rejects limits that would block every request.
+func (c Config) Validate() error {
+	if !c.Default.valid() {
+		return errors.New("default limit needs a positive rate and burst")
+	}
+	if !c.PerIP.valid() {
+		return errors.New("per IP limit needs a positive rate and burst")
+	}
+	for route, l := range c.Routes {
+		if !l.valid() {
+			return fmt.Errorf("limit of %s needs a positive rate and burst", route)
+		}
+	}
+	return nil
+}
+
+func (l Limit) valid() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Result describes the state of a bucket after a request.
+type Result struct {
+	Allowed bool
+	// Limit is the burst size of the bucket.
+	Limit int
+	// Remaining is the number of requests that can be made right away.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero
+	// when this one was.
+	RetryAfter time.Duration
+}
+
+// Limiter keeps a token bucket per client and route.
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+// perIP is the route of the buckets kept by AllowIP.
+const perIP = ""
+
+type bucketKey struct {
+	route  string
+	client string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// sweepInterval is how often buckets that refilled completely, and thus
+// behave like new ones, are dropped.
+const sweepInterval = time.Minute
+
+// New returns a limiter enforcing cfg.
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		now:     time.Now,
+		buckets: map[bucketKey]*bucket{},
+	}
+}
+
+// SetConfig replaces the limits, the buckets keep their tokens up to the
+// new burst sizes.
+func (l *Limiter) SetConfig(cfg Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+}
+
+// Allow takes a token from the bucket of client on route.
+func (l *Limiter) Allow(route, client string) Result {
+	return l.take(route, client)
+}
+
+// AllowIP takes a token from the bucket shared by every route of the client
+// address ip, see Config.PerIP.
+func (l *Limiter) AllowIP(ip string) Result {
+	return l.take(perIP, ip)
+}
+
+// limit returns the limit of route, the caller holds l.mu.
+func (l *Limiter) limit(route string) Limit {
+	if route == perIP {
+		return l.cfg.PerIP
+	}
+	if limit, ok := l.cfg.Routes[route]; ok {
+		return limit
+	}
+	return l.cfg.Default
+}
+
+func (l *Limiter) take(route, client string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limit(route)
+
+	now := l.now()
+	l.sweep(now)
+
+	key := bucketKey{route: route, client: client}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	res := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+
+	return res
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		limit := l.limit(key.route)
+		if b.tokens+now.Sub(b.last).Seconds()*limit.Rate >= float64(limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// ClientIPMetadata is the gRPC metadata the gateway forwards the address of
+// its client in, so the server can apply per IP limits to it.
+const ClientIPMetadata = "x-client-ip"
+
+type clientIPKey struct{}
+
+// WithClientIP stores the address of the client in ctx.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the address stored by WithClientIP.
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(string)
+	return ip, ok && ip != ""
+}
@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l := New(Config{
+		Default: Limit{Rate: 10, Burst: 10},
+		Routes:  map[string]Limit{"GET /books": {Rate: 1, Burst: 2}},
+	})
+	l.now = func() time.Time { return now }
+
+	res := l.Allow("GET /books", "alice")
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second}, res)
+
+	res = l.Allow("GET /books", "alice")
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	res = l.Allow("GET /books", "alice")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	// Other clients and routes have their own buckets.
+	assert.True(t, l.Allow("GET /books", "bob").Allowed)
+	assert.True(t, l.Allow("GET /books/:id", "alice").Allowed)
+	assert.Equal(t, 10, l.Allow("GET /books/:id", "alice").Limit)
+
+	now = now.Add(500 * time.Millisecond)
+	res = l.Allow("GET /books", "alice")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, l.Allow("GET /books", "alice").Allowed)
+}
+
+func TestLimiter_AllowIP(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l := New(Config{
+		Default: Limit{Rate: 10, Burst: 10},
+		PerIP:   Limit{Rate: 1, Burst: 1},
+	})
+	l.now = func() time.Time { return now }
+
+	assert.Equal(t, Result{Allowed: true, Limit: 1, Reset: time.Second}, l.AllowIP("192.0.2.1"))
+	res := l.AllowIP("192.0.2.1")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	// The address has its own bucket, apart from the routes.
+	assert.True(t, l.AllowIP("192.0.2.2").Allowed)
+	assert.True(t, l.Allow("GET /books", "192.0.2.1").Allowed)
+}
+
+func TestLimiter_SetConfig(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l := New(Config{Default: Limit{Rate: 1, Burst: 5}})
+	l.now = func() time.Time { return now }
+
+	assert.Equal(t, 4, l.Allow("GET /books", "alice").Remaining)
+
+	// The bucket keeps its tokens, capped by the new burst.
+	l.SetConfig(Config{Default: Limit{Rate: 1, Burst: 2}})
+	res := l.Allow("GET /books", "alice")
+	assert.Equal(t, 2, res.Limit)
+	assert.Equal(t, 1, res.Remaining)
+
+	l.SetConfig(Config{Default: Limit{Rate: 1, Burst: 10}})
+	res = l.Allow("GET /books", "alice")
+	assert.Equal(t, 10, res.Limit)
+	assert.Equal(t, 0, res.Remaining)
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l := New(Config{Default: Limit{Rate: 1, Burst: 1}})
+	l.now = func() time.Time { return now }
+
+	l.Allow("GET /books", "alice")
+	l.Allow("GET /books", "bob")
+	assert.Len(t, l.buckets, 2)
+
+	now = now.Add(2 * sweepInterval)
+	l.Allow("GET /books", "carol")
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		data    string
+		want    Config
+		wantErr bool
+	}{
+		{
+			name: "Valid",
+			data: "default: {rate: 5, burst: 10}\nroutes:\n  GET /books: {rate: 0.5, burst: 2}\n",
+			want: Config{
+				Default: Limit{Rate: 5, Burst: 10},
+				Routes:  map[string]Limit{"GET /books": {Rate: 0.5, Burst: 2}},
+				PerIP:   DefaultConfig().PerIP,
+			},
+		},
+		{
+			name: "Per IP",
+			data: "default: {rate: 5, burst: 10}\nper_ip: {rate: 1, burst: 3}\n",
+			want: Config{Default: Limit{Rate: 5, Burst: 10}, PerIP: Limit{Rate: 1, Burst: 3}},
+		},
+		{
+			name:    "Zero per IP",
+			data:    "default: {rate: 5, burst: 10}\nper_ip: {rate: 0, burst: 3}\n",
+			wantErr: true,
+		},
+		{
+			name:    "Missing default",
+			data:    "routes:\n  GET /books: {rate: 1, burst: 2}\n",
+			wantErr: true,
+		},
+		{
+			name:    "Zero burst",
+			data:    "default: {rate: 5, burst: 10}\nroutes:\n  GET /books: {rate: 1}\n",
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, "ratelimit.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.data), 0o600))
+
+			got, err := LoadConfig(path)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
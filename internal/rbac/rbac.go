@@ -0,0 +1,183 @@
+// Package rbac decides which roles may run which catalog operations.
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"gin_training/internal/watch"
+)
+
+// Roles known to the default policy.
+const (
+	RoleReader    = "reader"
+	RoleLibrarian = "librarian"
+	RoleAdmin     = "admin"
+)
+
+// Operation is a catalog action guarded by the policy.
+type Operation string
+
+// Catalog operations.
+const (
+	OpList       Operation = "list"
+	OpGet        Operation = "get"
+	OpCreate     Operation = "create"
+	OpUpdate     Operation = "update"
+	OpDelete     Operation = "delete"
+	OpBulkImport Operation = "bulk_import"
+	OpRestore    Operation = "restore"
+	OpPurge      Operation = "purge"
+	// OpManageAPIKeys covers creating, listing and revoking API keys.
+	OpManageAPIKeys Operation = "manage_api_keys"
+)
+
+// Operations lists every operation in the order they're documented.
+var Operations = []Operation{OpList, OpGet, OpCreate, OpUpdate, OpDelete, OpBulkImport, OpRestore, OpPurge, OpManageAPIKeys}
+
+// wildcard grants a role every operation.
+const wildcard = "*"
+
+// ErrPermissionDenied is returned when none of the caller's roles allows
+// an operation.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Policy maps roles to the operations they may run.
+type Policy struct {
+	roles map[string]map[Operation]bool
+}
+
+// policyFile is the YAML layout of a policy:
+//
+//	roles:
+//	  reader: [list, get]
+//	  admin: ["*"]
+type policyFile struct {
+	Roles map[string][]string `yaml:"roles"`
+}
+
+// DefaultPolicy lets readers browse, librarians maintain the catalog and
+// admins do anything, purging included.
+func DefaultPolicy() *Policy {
+	p, _ := newPolicy(map[string][]string{
+		RoleReader:    {string(OpList), string(OpGet)},
+		RoleLibrarian: {string(OpList), string(OpGet), string(OpCreate), string(OpUpdate), string(OpDelete), string(OpBulkImport), string(OpRestore)},
+		RoleAdmin:     {wildcard},
+	})
+	return p
+}
+
+// ParsePolicy reads a YAML policy, unknown operations are rejected so a
+// typo can't silently take a permission away.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var f policyFile
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("couldn't parse policy: %w", err)
+	}
+	if len(f.Roles) == 0 {
+		return nil, errors.New("policy defines no roles")
+	}
+	return newPolicy(f.Roles)
+}
+
+// LoadPolicy reads the YAML policy at path.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read policy: %w", err)
+	}
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+func newPolicy(roles map[string][]string) (*Policy, error) {
+	p := &Policy{roles: make(map[string]map[Operation]bool, len(roles))}
+
+	for role, ops := range roles {
+		allowed := map[Operation]bool{}
+		for _, op := range ops {
+			if op == wildcard {
+				for _, o := range Operations {
+					allowed[o] = true
+				}
+				continue
+			}
+			if !known(Operation(op)) {
+				return nil, fmt.Errorf("role %s: unknown operation %q", role, op)
+			}
+			allowed[Operation(op)] = true
+		}
+		p.roles[role] = allowed
+	}
+
+	return p, nil
+}
+
+func known(op Operation) bool {
+	for _, o := range Operations {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether any of roles may run op.
+func (p *Policy) Allows(roles []string, op Operation) bool {
+	for _, r := range roles {
+		if p.roles[r][op] {
+			return true
+		}
+	}
+	return false
+}
+
+// Enforcer checks operations against a policy that can be swapped while
+// requests are served.
+type Enforcer struct {
+	policy atomic.Pointer[Policy]
+}
+
+// NewEnforcer enforces p.
+func NewEnforcer(p *Policy) *Enforcer {
+	e := &Enforcer{}
+	e.policy.Store(p)
+	return e
+}
+
+// Check returns ErrPermissionDenied unless one of roles may run op.
+func (e *Enforcer) Check(roles []string, op Operation) error {
+	if !e.policy.Load().Allows(roles, op) {
+		return fmt.Errorf("%w: no role of the caller may %s", ErrPermissionDenied, op)
+	}
+	return nil
+}
+
+// SetPolicy replaces the enforced policy.
+func (e *Enforcer) SetPolicy(p *Policy) {
+	e.policy.Store(p)
+}
+
+// Watch reloads the policy at path whenever the file changes until ctx is
+// done. A policy that fails to load is logged and the previous one is kept.
+func (e *Enforcer) Watch(ctx context.Context, path string, interval time.Duration) {
+	watch.File(ctx, path, interval, func() {
+		p, err := LoadPolicy(path)
+		if err != nil {
+			slog.Warn("keeping the current RBAC policy", "error", err)
+			return
+		}
+		e.SetPolicy(p)
+		slog.Info("reloaded RBAC policy", "file", path)
+	})
+}
@@ -0,0 +1,95 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	p := DefaultPolicy()
+
+	tests := []struct {
+		name  string
+		roles []string
+		op    Operation
+		want  bool
+	}{
+		{name: "Reader lists", roles: []string{RoleReader}, op: OpList, want: true},
+		{name: "Reader can't create", roles: []string{RoleReader}, op: OpCreate, want: false},
+		{name: "Librarian deletes", roles: []string{RoleLibrarian}, op: OpDelete, want: true},
+		{name: "Librarian can't purge", roles: []string{RoleLibrarian}, op: OpPurge, want: false},
+		{name: "Admin purges", roles: []string{RoleAdmin}, op: OpPurge, want: true},
+		{name: "Any role is enough", roles: []string{"guest", RoleLibrarian}, op: OpRestore, want: true},
+		{name: "No roles", roles: nil, op: OpGet, want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, p.Allows(tc.roles, tc.op))
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "Valid",
+			data: "roles:\n  reader: [list, get]\n  admin: [\"*\"]\n",
+		},
+		{
+			name:    "Unknown operation",
+			data:    "roles:\n  reader: [list, gett]\n",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown key",
+			data:    "role:\n  reader: [list]\n",
+			wantErr: true,
+		},
+		{
+			name:    "Empty",
+			data:    "",
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(tc.data))
+			assert.Equal(t, tc.wantErr, err != nil, err)
+		})
+	}
+}
+
+func TestEnforcer_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("roles:\n  reader: [list]\n"), 0o600))
+
+	p, err := LoadPolicy(path)
+	assert.NoError(t, err)
+	e := NewEnforcer(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Watch(ctx, path, 10*time.Millisecond)
+
+	assert.True(t, errors.Is(e.Check([]string{RoleReader}, OpGet), ErrPermissionDenied))
+
+	// A broken policy keeps the current one.
+	assert.NoError(t, os.WriteFile(path, []byte("roles: ["), 0o600))
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, e.Check([]string{RoleReader}, OpList))
+
+	assert.NoError(t, os.WriteFile(path, []byte("roles:\n  reader: [list, get]\n"), 0o600))
+	assert.Eventually(t, func() bool {
+		return e.Check([]string{RoleReader}, OpGet) == nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,372 @@
+// Package cache keeps the books read through a storage.DB in memory, so
+// repeated reads of a book skip the database or the gRPC hop.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+
+	"gin_training/internal/model"
+	storage "gin_training/internal/storage/postgreSQL"
+)
+
+// Results of the lookups, as passed to the observer.
+const (
+	Hit         = "hit"
+	NegativeHit = "negative_hit"
+	SharedHit   = "shared_hit"
+	Miss        = "miss"
+)
+
+// Shared is a cache shared between processes, e.g. Redis, looked up when a
+// book isn't cached in process. Values are JSON encoded books with their
+// revision.
+type Shared interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// BypassMetadata is the gRPC metadata a client sends for the server to
+// read the book past its own cache too.
+const BypassMetadata = "x-cache-bypass"
+
+type bypassKey struct{}
+
+// Bypass returns a copy of ctx whose reads of a book skip the cache, for
+// callers about to write what they read.
+func Bypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// Bypassed reports whether the reads made with ctx skip the cache.
+func Bypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
+
+// Config sizes the cache.
+type Config struct {
+	// Size is the number of books kept, the least recently used ones are
+	// evicted first.
+	Size int
+	// TTL bounds how long a book changed by another process is served.
+	TTL time.Duration
+	// NegativeTTL keeps missing books for a while, 0 doesn't keep them.
+	NegativeTTL time.Duration
+}
+
+// Option configures optional parts of the cache.
+type Option func(*Books)
+
+// WithShared looks books up in s before reading them from the database, and
+// removes them from s when they change.
+func WithShared(s Shared) Option {
+	return func(c *Books) {
+		c.shared = s
+	}
+}
+
+// WithLogger logs the failures of the shared cache to l instead of the
+// default slog logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Books) {
+		c.log = l
+	}
+}
+
+// WithObserver hands the result of every lookup to observe.
+func WithObserver(observe func(result string)) Option {
+	return func(c *Books) {
+		c.observe = observe
+	}
+}
+
+// Books is a storage.DB caching the books read with GetBook. Writes through
+// it invalidate the books they change, writes through other processes are
+// seen once the entries expire.
+type Books struct {
+	db      storage.DB
+	cfg     Config
+	shared  Shared
+	observe func(string)
+	now     func() time.Time
+	log     *slog.Logger
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// writes counts the invalidations, a load only stores its book when no
+	// write happened while it ran, and lookups after a write don't join it.
+	writes uint64
+	loads  singleflight.Group
+}
+
+// sharedBook is the value stored in the shared cache, the revision of a book
+// isn't part of its JSON.
+type sharedBook struct {
+	model.Book
+	Revision model.Revision `json:"revision"`
+}
+
+type entry struct {
+	id       string
+	book     model.Book
+	notFound bool
+	expires  time.Time
+}
+
+// loaded is the result of a load shared by the coalesced lookups.
+type loaded struct {
+	book   model.Book
+	shared bool
+}
+
+// New caches the books of db.
+func New(db storage.DB, cfg Config, opts ...Option) *Books {
+	c := &Books{
+		db:      db,
+		cfg:     cfg,
+		observe: func(string) {},
+		now:     time.Now,
+		log:     slog.Default(),
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Books) FindAll(ctx context.Context, mask model.ReadMask) ([]model.Book, model.Revision, error) {
+	return c.db.FindAll(ctx, mask)
+}
+
+func (c *Books) Create(ctx context.Context, b model.Book) (model.Book, error) {
+	b, err := c.db.Create(ctx, b)
+	if err == nil {
+		c.invalidate(ctx, b.ID.String())
+	}
+	return b, err
+}
+
+// GetBook serves the book from the cache, or reads it whole once for every
+// lookup of the same session missing it at the same time. Bypassed reads go
+// to the database.
+func (c *Books) GetBook(ctx context.Context, id string, mask model.ReadMask) (model.Book, error) {
+	if Bypassed(ctx) {
+		return c.db.GetBook(ctx, id, mask)
+	}
+	if e, ok := c.get(id); ok {
+		if e.notFound {
+			c.observe(NegativeHit)
+			return model.Book{}, fmt.Errorf("couldn't find book: %w", storage.ErrNotFound)
+		}
+		c.observe(Hit)
+		return masked(e.book, mask), nil
+	}
+
+	// The load runs as the lookup starting it, the storage may route the
+	// reads of a session, e.g. to the primary after its writes.
+	c.mu.Lock()
+	writes := c.writes
+	c.mu.Unlock()
+	flight := fmt.Sprintf("%s/%d", id, writes)
+	if session, ok := storage.SessionFromContext(ctx); ok {
+		flight += "/" + session
+	}
+
+	var led bool
+	res := c.loads.DoChan(flight, func() (interface{}, error) {
+		led = true
+		loadCtx, cancel := detach(ctx)
+		defer cancel()
+		return c.load(loadCtx, id, writes)
+	})
+
+	select {
+	case <-ctx.Done():
+		return model.Book{}, ctx.Err()
+	case r := <-res:
+		if r.Err != nil && !led && !errors.Is(r.Err, storage.ErrNotFound) {
+			// The error may be the leader's own, such as its deadline or
+			// rate limit, this lookup reads again on its own.
+			r.Val, r.Err = c.load(ctx, id, writes)
+		}
+		if r.Err != nil {
+			c.observe(Miss)
+			return model.Book{}, r.Err
+		}
+		l := r.Val.(loaded)
+		if l.shared {
+			c.observe(SharedHit)
+		} else {
+			c.observe(Miss)
+		}
+		return masked(l.book, mask), nil
+	}
+}
+
+func (c *Books) CatalogRevision(ctx context.Context) (model.Revision, error) {
+	return c.db.CatalogRevision(ctx)
+}
+
+// BookRevision answers with the revision of the cached book when there is
+// one, the revision of what GetBook serves.
+func (c *Books) BookRevision(ctx context.Context, id string) (model.Revision, error) {
+	if e, ok := c.get(id); ok {
+		if e.notFound {
+			return model.Revision{}, fmt.Errorf("couldn't find book: %w", storage.ErrNotFound)
+		}
+		return e.book.Revision, nil
+	}
+	return c.db.BookRevision(ctx, id)
+}
+
+func (c *Books) UpdateBook(ctx context.Context, id string, in model.UpdateBookInput) (model.Book, error) {
+	b, err := c.db.UpdateBook(ctx, id, in)
+	// A failed update may still have been applied, e.g. when it timed out.
+	c.invalidate(ctx, id)
+	return b, err
+}
+
+func (c *Books) DeleteBook(ctx context.Context, id string) error {
+	err := c.db.DeleteBook(ctx, id)
+	c.invalidate(ctx, id)
+	return err
+}
+
+// load reads the book, and caches it unless a write happened since writes
+// was read.
+func (c *Books) load(ctx context.Context, id string, writes uint64) (loaded, error) {
+	if c.shared != nil {
+		data, ok, err := c.shared.Get(ctx, key(id))
+		if err != nil {
+			c.log.WarnContext(ctx, "couldn't read the shared cache", "book_id", id, "error", err)
+		}
+		var sb sharedBook
+		if ok && json.Unmarshal(data, &sb) == nil {
+			b := sb.Book
+			b.Revision = sb.Revision
+			c.put(writes, entry{id: id, book: b, expires: c.now().Add(c.cfg.TTL)})
+			return loaded{book: b, shared: true}, nil
+		}
+	}
+
+	b, err := c.db.GetBook(ctx, id, nil)
+	if errors.Is(err, storage.ErrNotFound) && c.cfg.NegativeTTL > 0 {
+		c.put(writes, entry{id: id, notFound: true, expires: c.now().Add(c.cfg.NegativeTTL)})
+	}
+	if err != nil {
+		return loaded{}, err
+	}
+
+	if c.put(writes, entry{id: id, book: b, expires: c.now().Add(c.cfg.TTL)}) && c.shared != nil {
+		data, err := json.Marshal(sharedBook{Book: b, Revision: b.Revision})
+		if err == nil {
+			err = c.shared.Set(ctx, key(id), data, c.cfg.TTL)
+		}
+		if err != nil {
+			c.log.WarnContext(ctx, "couldn't write the shared cache", "book_id", id, "error", err)
+		}
+	}
+	return loaded{book: b}, nil
+}
+
+func (c *Books) get(id string) (entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[id]
+	if !ok {
+		return entry{}, false
+	}
+	e := el.Value.(entry)
+	if !c.now().Before(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, id)
+		return entry{}, false
+	}
+	c.lru.MoveToFront(el)
+	return e, true
+}
+
+// put stores e unless a write happened since writes was read, and reports
+// whether it did.
+func (c *Books) put(writes uint64, e entry) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.writes != writes || c.cfg.Size <= 0 {
+		return false
+	}
+	if el, ok := c.entries[e.id]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return true
+	}
+	c.entries[e.id] = c.lru.PushFront(e)
+	for c.lru.Len() > c.cfg.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(entry).id)
+	}
+	return true
+}
+
+// invalidate drops the book, and keeps loads running meanwhile from
+// storing what they read or being joined.
+func (c *Books) invalidate(ctx context.Context, id string) {
+	c.mu.Lock()
+	c.writes++
+	if el, ok := c.entries[id]; ok {
+		c.lru.Remove(el)
+		delete(c.entries, id)
+	}
+	c.mu.Unlock()
+
+	if c.shared != nil {
+		if err := c.shared.Delete(ctx, key(id)); err != nil {
+			c.log.WarnContext(ctx, "couldn't invalidate the shared cache", "book_id", id, "error", err)
+		}
+	}
+}
+
+// detach returns ctx without its cancellation but with its deadline. A load
+// outlives the lookup starting it, the others waiting for it mustn't fail
+// when that one is cancelled.
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	}
+	return context.WithoutCancel(ctx), func() {}
+}
+
+func key(id string) string {
+	return "book:" + id
+}
+
+// masked returns the fields of b in mask, the others are zero as if they
+// weren't read.
+func masked(b model.Book, mask model.ReadMask) model.Book {
+	if !mask.Has(model.FieldID) {
+		b.ID = uuid.Nil
+	}
+	if !mask.Has(model.FieldTitle) {
+		b.Title = ""
+	}
+	if !mask.Has(model.FieldAuthor) {
+		b.Author = ""
+	}
+	return b
+}
@@ -0,0 +1,428 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"gin_training/internal/model"
+	storage "gin_training/internal/storage/postgreSQL"
+	"gin_training/internal/storage/postgreSQL/mocks"
+)
+
+var (
+	bookID = "00000000-0000-0000-0000-000000000001"
+	book   = model.Book{
+		ID:       uuid.MustParse(bookID),
+		Title:    "Dune",
+		Author:   "Frank Herbert",
+		Revision: model.Revision{Version: 2, UpdatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+)
+
+// newTestCache returns a cache of db with a clock moved by the returned
+// function, and the lookup results it observed.
+func newTestCache(db storage.DB, cfg Config, opts ...Option) (*Books, func(time.Duration), *[]string) {
+	var (
+		mu      sync.Mutex
+		results []string
+	)
+	opts = append(opts, WithObserver(func(r string) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, r)
+	}))
+	c := New(db, cfg, opts...)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, func(d time.Duration) { now = now.Add(d) }, &results
+}
+
+func TestBooks_GetBook(t *testing.T) {
+	notFound := fmt.Errorf("couldn't find book: %w", storage.ErrNotFound)
+	cfg := Config{Size: 2, TTL: time.Minute, NegativeTTL: time.Second}
+
+	tests := []struct {
+		name        string
+		setup       func(db *mocks.DB)
+		lookups     func(t *testing.T, c *Books, advance func(time.Duration))
+		wantResults []string
+	}{
+		{
+			name: "Cached whole and masked on read",
+			setup: func(db *mocks.DB) {
+				db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(book, nil).Once()
+			},
+			lookups: func(t *testing.T, c *Books, _ func(time.Duration)) {
+				b, err := c.GetBook(context.Background(), bookID, model.ReadMask{model.FieldTitle})
+				assert.NoError(t, err)
+				assert.Equal(t, model.Book{Title: "Dune", Revision: book.Revision}, b)
+				b, err = c.GetBook(context.Background(), bookID, nil)
+				assert.NoError(t, err)
+				assert.Equal(t, book, b)
+			},
+			wantResults: []string{Miss, Hit},
+		},
+		{
+			name: "Expired after the TTL",
+			setup: func(db *mocks.DB) {
+				db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(book, nil).Twice()
+			},
+			lookups: func(t *testing.T, c *Books, advance func(time.Duration)) {
+				_, _ = c.GetBook(context.Background(), bookID, nil)
+				advance(time.Minute)
+				_, err := c.GetBook(context.Background(), bookID, nil)
+				assert.NoError(t, err)
+			},
+			wantResults: []string{Miss, Miss},
+		},
+		{
+			name: "Missing book kept briefly",
+			setup: func(db *mocks.DB) {
+				db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(model.Book{}, notFound).Twice()
+			},
+			lookups: func(t *testing.T, c *Books, advance func(time.Duration)) {
+				for i := 0; i < 2; i++ {
+					_, err := c.GetBook(context.Background(), bookID, nil)
+					assert.ErrorIs(t, err, storage.ErrNotFound)
+				}
+				advance(time.Second)
+				_, err := c.GetBook(context.Background(), bookID, nil)
+				assert.ErrorIs(t, err, storage.ErrNotFound)
+			},
+			wantResults: []string{Miss, NegativeHit, Miss},
+		},
+		{
+			name: "Errors aren't cached",
+			setup: func(db *mocks.DB) {
+				db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(model.Book{}, storage.ErrUnavailable).Once()
+				db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(book, nil).Once()
+			},
+			lookups: func(t *testing.T, c *Books, _ func(time.Duration)) {
+				_, err := c.GetBook(context.Background(), bookID, nil)
+				assert.ErrorIs(t, err, storage.ErrUnavailable)
+				b, err := c.GetBook(context.Background(), bookID, nil)
+				assert.NoError(t, err)
+				assert.Equal(t, book, b)
+			},
+			wantResults: []string{Miss, Miss},
+		},
+		{
+			name: "Least recently used evicted",
+			setup: func(db *mocks.DB) {
+				db.On("GetBook", mock.Anything, mock.Anything, model.ReadMask(nil)).Return(book, nil).Times(4)
+			},
+			lookups: func(t *testing.T, c *Books, _ func(time.Duration)) {
+				for _, id := range []string{"a", "b", "a", "c", "a", "b"} {
+					_, err := c.GetBook(context.Background(), id, nil)
+					assert.NoError(t, err)
+				}
+			},
+			wantResults: []string{Miss, Miss, Hit, Miss, Hit, Miss},
+		},
+		{
+			name: "Invalidated by writes",
+			setup: func(db *mocks.DB) {
+				db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(book, nil).Times(3)
+				db.On("UpdateBook", mock.Anything, bookID, mock.Anything).Return(book, nil).Once()
+				db.On("DeleteBook", mock.Anything, bookID).Return(storage.ErrInternal).Once()
+			},
+			lookups: func(t *testing.T, c *Books, _ func(time.Duration)) {
+				_, _ = c.GetBook(context.Background(), bookID, nil)
+				_, err := c.UpdateBook(context.Background(), bookID, model.UpdateBookInput{Title: "Dune Messiah"})
+				assert.NoError(t, err)
+				_, _ = c.GetBook(context.Background(), bookID, nil)
+				// A failed delete may have gone through.
+				assert.Error(t, c.DeleteBook(context.Background(), bookID))
+				_, _ = c.GetBook(context.Background(), bookID, nil)
+			},
+			wantResults: []string{Miss, Miss, Miss},
+		},
+		{
+			name: "Missing book dropped when created",
+			setup: func(db *mocks.DB) {
+				db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(model.Book{}, notFound).Once()
+				db.On("Create", mock.Anything, mock.Anything).Return(book, nil).Once()
+				db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(book, nil).Once()
+			},
+			lookups: func(t *testing.T, c *Books, _ func(time.Duration)) {
+				_, _ = c.GetBook(context.Background(), bookID, nil)
+				_, err := c.Create(context.Background(), model.Book{Title: "Dune"})
+				assert.NoError(t, err)
+				b, err := c.GetBook(context.Background(), bookID, nil)
+				assert.NoError(t, err)
+				assert.Equal(t, book, b)
+			},
+			wantResults: []string{Miss, Miss},
+		},
+		{
+			name: "Bypassed reads go to the database",
+			setup: func(db *mocks.DB) {
+				db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(book, nil).Twice()
+			},
+			lookups: func(t *testing.T, c *Books, _ func(time.Duration)) {
+				_, _ = c.GetBook(context.Background(), bookID, nil)
+				b, err := c.GetBook(Bypass(context.Background()), bookID, nil)
+				assert.NoError(t, err)
+				assert.Equal(t, book, b)
+			},
+			wantResults: []string{Miss},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db := new(mocks.DB)
+			tc.setup(db)
+			c, advance, results := newTestCache(db, cfg)
+
+			tc.lookups(t, c, advance)
+
+			assert.Equal(t, tc.wantResults, *results)
+			db.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBooks_BookRevision(t *testing.T) {
+	db := new(mocks.DB)
+	db.On("BookRevision", mock.Anything, bookID).Return(model.Revision{Version: 3}, nil).Once()
+	db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(book, nil).Once()
+	c, _, _ := newTestCache(db, Config{Size: 10, TTL: time.Minute})
+
+	// Not cached, the backend answers.
+	rev, err := c.BookRevision(context.Background(), bookID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), rev.Version)
+
+	// Cached, the revision of what GetBook serves.
+	_, _ = c.GetBook(context.Background(), bookID, nil)
+	rev, err = c.BookRevision(context.Background(), bookID)
+	assert.NoError(t, err)
+	assert.Equal(t, book.Revision, rev)
+	db.AssertExpectations(t)
+}
+
+func TestBooks_CoalescesMisses(t *testing.T) {
+	release := make(chan struct{})
+	db := new(mocks.DB)
+	db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).
+		Run(func(mock.Arguments) { <-release }).
+		Return(book, nil).Once()
+	c, _, _ := newTestCache(db, Config{Size: 10, TTL: time.Minute})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b, err := c.GetBook(context.Background(), bookID, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, book, b)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	db.AssertExpectations(t)
+}
+
+func TestBooks_CoalescedErrors(t *testing.T) {
+	release := make(chan struct{})
+	db := new(mocks.DB)
+	db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).
+		Run(func(mock.Arguments) { <-release }).
+		Return(model.Book{}, fmt.Errorf("couldn't find a book: %w", storage.ErrRateLimited)).Once()
+	db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(book, nil).Once()
+	c, _, _ := newTestCache(db, Config{Size: 10, TTL: time.Minute})
+
+	leader := make(chan error)
+	go func() {
+		_, err := c.GetBook(context.Background(), bookID, nil)
+		leader <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	waiter := make(chan error)
+	go func() {
+		b, err := c.GetBook(context.Background(), bookID, nil)
+		assert.Equal(t, book, b)
+		waiter <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	// The rate limit of the lookup loading the book isn't the other's.
+	assert.ErrorIs(t, <-leader, storage.ErrRateLimited)
+	assert.NoError(t, <-waiter)
+	db.AssertExpectations(t)
+}
+
+func TestBooks_SessionsLoadApart(t *testing.T) {
+	release := make(chan struct{})
+	sessions := make(chan string, 2)
+	db := new(mocks.DB)
+	db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).
+		Run(func(args mock.Arguments) {
+			session, _ := storage.SessionFromContext(args.Get(0).(context.Context))
+			sessions <- session
+			<-release
+		}).
+		Return(book, nil).Twice()
+	c, _, _ := newTestCache(db, Config{Size: 10, TTL: time.Minute})
+
+	var wg sync.WaitGroup
+	for _, session := range []string{"alice", "bob"} {
+		wg.Add(1)
+		go func(session string) {
+			defer wg.Done()
+			_, err := c.GetBook(storage.WithSession(context.Background(), session), bookID, nil)
+			assert.NoError(t, err)
+		}(session)
+	}
+	// Each book is read as its own session, e.g. from the primary for the
+	// one who just wrote.
+	assert.ElementsMatch(t, []string{"alice", "bob"}, []string{<-sessions, <-sessions})
+	close(release)
+	wg.Wait()
+
+	db.AssertExpectations(t)
+}
+
+func TestBooks_CancelledLookup(t *testing.T) {
+	release := make(chan struct{})
+	db := new(mocks.DB)
+	db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).
+		Run(func(mock.Arguments) { <-release }).
+		Return(book, nil).Once()
+	c, _, _ := newTestCache(db, Config{Size: 10, TTL: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := c.GetBook(ctx, bookID, nil)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// The load goes on for the others.
+	close(release)
+	b, err := c.GetBook(context.Background(), bookID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, book, b)
+	db.AssertExpectations(t)
+}
+
+func TestBooks_WriteDuringLoad(t *testing.T) {
+	release := make(chan struct{})
+	updated := book
+	updated.Title = "Dune Messiah"
+	db := new(mocks.DB)
+	db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).
+		Run(func(mock.Arguments) { <-release }).
+		Return(book, nil).Once()
+	db.On("UpdateBook", mock.Anything, bookID, mock.Anything).Return(updated, nil).Once()
+	db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(updated, nil).Once()
+	c, _, _ := newTestCache(db, Config{Size: 10, TTL: time.Minute})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b, _ := c.GetBook(context.Background(), bookID, nil)
+		assert.Equal(t, book, b)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_, err := c.UpdateBook(context.Background(), bookID, model.UpdateBookInput{Title: "Dune Messiah"})
+	assert.NoError(t, err)
+	close(release)
+	<-done
+
+	// The book read before the update wasn't kept.
+	b, err := c.GetBook(context.Background(), bookID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, updated, b)
+	db.AssertExpectations(t)
+}
+
+// mapShared is a Shared cache in a map, failing with err when it's set.
+type mapShared struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	err    error
+}
+
+func (s *mapShared) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	return v, ok, s.err
+}
+
+func (s *mapShared) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	return s.err
+}
+
+func (s *mapShared) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	return s.err
+}
+
+func TestBooks_Shared(t *testing.T) {
+	shared := &mapShared{values: map[string][]byte{}}
+	cfg := Config{Size: 10, TTL: time.Minute}
+
+	db := new(mocks.DB)
+	db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(book, nil).Once()
+	db.On("DeleteBook", mock.Anything, bookID).Return(nil).Once()
+
+	// The first process reads the book and shares it.
+	first, _, _ := newTestCache(db, cfg, WithShared(shared))
+	_, err := first.GetBook(context.Background(), bookID, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, shared.values, "book:"+bookID)
+
+	// The second one finds it there.
+	second, _, results := newTestCache(db, cfg, WithShared(shared))
+	b, err := second.GetBook(context.Background(), bookID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, book, b)
+	assert.Equal(t, []string{SharedHit}, *results)
+
+	// Deleting it through either removes it from the shared cache.
+	assert.NoError(t, second.DeleteBook(context.Background(), bookID))
+	assert.Empty(t, shared.values)
+	db.AssertExpectations(t)
+}
+
+func TestBooks_SharedUnavailable(t *testing.T) {
+	shared := &mapShared{values: map[string][]byte{}, err: errors.New("connection refused")}
+	db := new(mocks.DB)
+	db.On("GetBook", mock.Anything, bookID, model.ReadMask(nil)).Return(book, nil).Once()
+	var logs bytes.Buffer
+	c, _, _ := newTestCache(db, Config{Size: 10, TTL: time.Minute}, WithShared(shared),
+		WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+
+	for i := 0; i < 2; i++ {
+		b, err := c.GetBook(context.Background(), bookID, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, book, b)
+	}
+	db.AssertExpectations(t)
+	assert.Contains(t, logs.String(), `"msg":"couldn't read the shared cache","book_id":"`+bookID+`","error":"connection refused"`)
+	assert.Contains(t, logs.String(), `"msg":"couldn't write the shared cache"`)
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"gin_training/internal/auth"
+	"gin_training/internal/model"
+)
+
+// apiKeyColumns is the select list read by scanAPIKey.
+const apiKeyColumns = "id, owner, scopes, expires_at, last_used_at, created_at, revoked_at"
+
+// CreateAPIKey stores the hash of a fresh key, scopes are kept space
+// separated like the scope claim of a token.
+func (pdb *PostgresDB) CreateAPIKey(ctx context.Context, in model.CreateAPIKeyInput) (_ model.APIKey, err error) {
+	key, err := auth.NewAPIKey()
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("%v: %w", err, ErrInternal)
+	}
+
+	k := model.APIKey{
+		ID:        uuid.New(),
+		Key:       key,
+		Owner:     in.Owner,
+		Scopes:    in.Scopes,
+		ExpiresAt: in.ExpiresAt,
+	}
+
+	const query = `INSERT INTO api_keys (id, hash, owner, scopes, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING created_at`
+
+	ctx, done := pdb.startSpan(ctx, "INSERT", "api_keys", query)
+	defer func() { done(err) }()
+
+	err = pdb.Pdb.QueryRowContext(ctx, query,
+		k.ID.String(), auth.HashAPIKey(key), k.Owner, strings.Join(k.Scopes, " "), k.ExpiresAt).Scan(&k.CreatedAt)
+	if err != nil {
+		return model.APIKey{}, execError(err, "couldn't create API key")
+	}
+
+	return k, nil
+}
+
+// ListAPIKeys returns every key, revoked ones included, oldest first.
+func (pdb *PostgresDB) ListAPIKeys(ctx context.Context) (_ []model.APIKey, err error) {
+	const query = `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at`
+
+	ctx, done := pdb.startSpan(ctx, "SELECT", "api_keys", query)
+	defer func() { done(err) }()
+
+	rows, err := pdb.Pdb.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list API keys: %w", ErrInternal)
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't list API keys: %w", ErrInternal)
+	}
+
+	return keys, nil
+}
+
+func (pdb *PostgresDB) RevokeAPIKey(ctx context.Context, id string) (err error) {
+	const query = `UPDATE api_keys SET revoked_at=now() WHERE id=$1 AND revoked_at IS NULL`
+
+	ctx, done := pdb.startSpan(ctx, "UPDATE", "api_keys", query)
+	defer func() { done(err) }()
+
+	res, err := pdb.Pdb.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("couldn't revoke API key: %w", ErrInternal)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("couldn't revoke API key: %w", ErrInternal)
+	}
+	if n == 0 {
+		return fmt.Errorf("couldn't revoke API key: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey looks the key up by its hash and stamps last_used_at
+// in the same statement.
+func (pdb *PostgresDB) AuthenticateAPIKey(ctx context.Context, key string) (_ model.APIKey, err error) {
+	const query = `UPDATE api_keys SET last_used_at=now()
+		WHERE hash=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+		RETURNING ` + apiKeyColumns
+
+	ctx, done := pdb.startSpan(ctx, "UPDATE", "api_keys", query)
+	defer func() { done(err) }()
+
+	row := pdb.Pdb.QueryRowContext(ctx, query, auth.HashAPIKey(key))
+
+	k, err := scanAPIKey(row)
+	if errors.Is(err, ErrNotFound) {
+		return model.APIKey{}, fmt.Errorf("unknown, revoked or expired API key: %w", ErrNotFound)
+	}
+	return k, err
+}
+
+// FindAPIKey looks the key up by its hash on the primary, so revoked keys
+// are refused at once.
+func (pdb *PostgresDB) FindAPIKey(ctx context.Context, key string) (_ model.APIKey, err error) {
+	const query = `SELECT ` + apiKeyColumns + ` FROM api_keys
+		WHERE hash=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())`
+
+	ctx, done := pdb.startSpan(ctx, "SELECT", "api_keys", query)
+	defer func() { done(err) }()
+
+	row := pdb.Pdb.QueryRowContext(ctx, query, auth.HashAPIKey(key))
+
+	k, err := scanAPIKey(row)
+	if errors.Is(err, ErrNotFound) {
+		return model.APIKey{}, fmt.Errorf("unknown, revoked or expired API key: %w", ErrNotFound)
+	}
+	return k, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row scanner) (model.APIKey, error) {
+	var (
+		k                            model.APIKey
+		id, scopes                   string
+		expiresAt, lastUsed, revoked sql.NullTime
+	)
+
+	err := row.Scan(&id, &k.Owner, &scopes, &expiresAt, &lastUsed, &k.CreatedAt, &revoked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.APIKey{}, fmt.Errorf("couldn't find API key: %w", ErrNotFound)
+	}
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("couldn't read API key: %w", ErrInternal)
+	}
+
+	k.ID, err = uuid.Parse(id)
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("couldn't parse API key id: %w", ErrInternal)
+	}
+	k.Scopes = strings.Fields(scopes)
+	k.ExpiresAt = nullTime(expiresAt)
+	k.LastUsedAt = nullTime(lastUsed)
+	k.RevokedAt = nullTime(revoked)
+
+	return k, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// maxConnectBackoff caps the wait between two connection attempts.
+const maxConnectBackoff = 30 * time.Second
+
+// Config locates the database and sizes the connection pool. URL, a
+// postgres:// URL or a key/value connection string, takes precedence over
+// the separate fields. Zero pool settings keep the database/sql defaults.
+type Config struct {
+	URL      string
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Database string
+	SSLMode  string
+	// Replicas are the DSNs of read-only replicas serving FindAll and
+	// GetBook, with the pool settings of the primary.
+	Replicas []string
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// ConnectAttempts is how many times the database is pinged before
+	// NewPDB gives up, waiting ConnectBackoff after the first failure and
+	// twice as long after every other one.
+	ConnectAttempts int
+	ConnectBackoff  time.Duration
+}
+
+// DSN returns the connection string, values are quoted so passwords may
+// hold spaces and quotes.
+func (c Config) DSN() string {
+	if c.URL != "" {
+		return c.URL
+	}
+
+	var kv []string
+	add := func(key, value string) {
+		if value != "" {
+			kv = append(kv, key+"="+quoteDSN(value))
+		}
+	}
+	add("host", c.Host)
+	add("port", c.Port)
+	add("user", c.User)
+	add("password", c.Password)
+	add("dbname", c.Database)
+	add("sslmode", c.SSLMode)
+	return strings.Join(kv, " ")
+}
+
+func quoteDSN(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// target describes the database in errors and logs, without credentials.
+func (c Config) target() string {
+	if c.URL == "" {
+		return net.JoinHostPort(c.Host, c.Port) + "/" + c.Database
+	}
+	if u, err := url.Parse(c.URL); err == nil && u.Host != "" {
+		return u.Host + u.Path
+	}
+	return "the configured URL"
+}
+
+// validate catches a malformed URL before it's used.
+func (c Config) validate() error {
+	if strings.HasPrefix(c.URL, "postgres://") || strings.HasPrefix(c.URL, "postgresql://") {
+		if _, err := pq.ParseURL(c.URL); err != nil {
+			return fmt.Errorf("invalid postgres URL: %w", err)
+		}
+	}
+	if c.MaxIdleConns > c.MaxOpenConns && c.MaxOpenConns > 0 {
+		return fmt.Errorf("max idle connections (%d) exceed max open ones (%d)", c.MaxIdleConns, c.MaxOpenConns)
+	}
+	return nil
+}
+
+func (c Config) configurePool(db *sql.DB) {
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+}
+
+// connect pings the database until it answers, giving up after the
+// configured attempts, on errors retrying can't fix or once ctx is done.
+func (pdb *PostgresDB) connect(ctx context.Context, cfg Config) error {
+	attempts := max(cfg.ConnectAttempts, 1)
+	backoff := cfg.ConnectBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = pdb.Pdb.PingContext(ctx); err == nil {
+			return nil
+		}
+		if attempt == attempts || permanent(err) {
+			break
+		}
+
+		pdb.logger().WarnContext(ctx, "database unreachable, retrying",
+			"target", cfg.target(), "attempt", attempt, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("couldn't reach postgres at %s: %w", cfg.target(), ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
+
+	return fmt.Errorf("couldn't reach postgres at %s: %w", cfg.target(), err)
+}
+
+// permanent reports whether err comes from a wrong password, role or
+// database, which won't fix itself.
+func permanent(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code.Class() == "28" || pqErr.Code == "3D000"
+}
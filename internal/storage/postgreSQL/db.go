@@ -1,14 +1,17 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"gin_training/internal/model"
 )
@@ -16,29 +19,88 @@ import (
 type PostgresDB struct {
 	Pdb *sql.DB
 	mu  sync.Mutex
+	log *slog.Logger
+
+	replicas []*replica
+	next     atomic.Uint64
+	pins     *pins
+}
+
+// Option configures optional parts of the PostgresDB.
+type Option func(*PostgresDB)
+
+// WithLogger logs failed statements to l instead of the default slog
+// logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(pdb *PostgresDB) {
+		pdb.log = l
+	}
 }
 
-func NewPDB(host string, port string, user string, psw string, dbname string, ssl string) (*PostgresDB, error) {
-	connStr := "host=" + host + " port=" + port + " user=" + user + " password=" + psw + " dbname=" + dbname + " sslmode=" + ssl
+// NewPDB opens the connection pool described by cfg and waits for the
+// primary to answer, retrying as cfg says. Replicas are opened too, the ones
+// not answering start ejected. The schema is created by Migrate.
+func NewPDB(ctx context.Context, cfg Config, opts ...Option) (*PostgresDB, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", cfg.DSN())
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect database %w\n", err)
+		return nil, fmt.Errorf("couldn't open postgres at %s: %w", cfg.target(), err)
 	}
+	cfg.configurePool(db)
 
 	database := &PostgresDB{Pdb: db}
+	for _, opt := range opts {
+		opt(database)
+	}
 
-	database.Pdb.Exec("CREATE TABLE IF NOT EXISTS books (\n    id VARCHAR(40) PRIMARY KEY NOT NULL,\n    title VARCHAR(150) NOT NULL,\n    author VARCHAR(50) NOT NULL\n);")
+	if err := database.connect(ctx, cfg); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := database.openReplicas(ctx, cfg); err != nil {
+		database.Close()
+		return nil, err
+	}
 
 	return database, nil
 }
 
-func (pdb *PostgresDB) FindAll() []model.Book {
+// Ping checks that the database answers.
+func (pdb *PostgresDB) Ping(ctx context.Context) error {
+	if err := pdb.Pdb.PingContext(ctx); err != nil {
+		return fmt.Errorf("couldn't reach database: %w", ErrUnavailable)
+	}
+	return nil
+}
+
+// FindAll selects only the columns of the masked fields, and the catalog
+// revision they're at. Both are read in one snapshot of the same database,
+// so the revision versions exactly the books listed.
+func (pdb *PostgresDB) FindAll(ctx context.Context, mask model.ReadMask) (_ []model.Book, _ model.Revision, err error) {
+	fields := mask.Fields()
+	query := `SELECT ` + columns(fields) + ` FROM books`
+
+	ctx, done := pdb.startSpan(ctx, "SELECT", "books", query)
+	defer func() { done(err) }()
+
+	tx, err := pdb.reader(ctx).BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, model.Revision{}, fmt.Errorf("couldn't list books: %w", ErrInternal)
+	}
+	defer tx.Rollback()
 
-	rows, err := pdb.Pdb.Query(
-		`SELECT * FROM books`)
+	var rev model.Revision
+	err = tx.QueryRowContext(ctx, `SELECT revision, updated_at FROM catalog_revision`).Scan(&rev.Version, &rev.UpdatedAt)
 	if err != nil {
-		return []model.Book{}
+		return nil, model.Revision{}, fmt.Errorf("couldn't read catalog revision: %w", ErrInternal)
+	}
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, model.Revision{}, fmt.Errorf("couldn't list books: %w", ErrInternal)
 	}
 	defer rows.Close()
 
@@ -47,100 +109,263 @@ func (pdb *PostgresDB) FindAll() []model.Book {
 	for rows.Next() {
 		b := model.Book{}
 		var bb string
-		err := rows.Scan(&bb, &b.Title, &b.Author)
+		err := rows.Scan(scanTargets(fields, &b, &bb)...)
 		if err != nil {
-			return []model.Book{}
+			return nil, model.Revision{}, fmt.Errorf("couldn't read book: %w", ErrInternal)
 		}
-		b.ID, err = uuid.Parse(bb)
-		if err != nil {
-			return []model.Book{}
+		if mask.Has(model.FieldID) {
+			b.ID, err = uuid.Parse(bb)
+			if err != nil {
+				return nil, model.Revision{}, fmt.Errorf("couldn't parse book id: %w", ErrInternal)
+			}
 		}
 		books = append(books, b)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, model.Revision{}, fmt.Errorf("couldn't list books: %w", ErrInternal)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, model.Revision{}, fmt.Errorf("couldn't list books: %w", ErrInternal)
+	}
 
-	return books
+	return books, rev, nil
 }
 
-func (pdb *PostgresDB) Create(b model.Book) (model.Book, error) {
+func (pdb *PostgresDB) Create(ctx context.Context, b model.Book) (_ model.Book, err error) {
 	pdb.mu.Lock()
 	defer pdb.mu.Unlock()
 
 	id := uuid.New()
 	idStr := id.String()
 
-	log.Println(b)
+	const query = "INSERT INTO books (id, title, author) VALUES ($1, $2, $3)"
+
+	ctx, done := pdb.startSpan(ctx, "INSERT", "books", query)
+	defer func() { done(err) }()
 
-	_, err := pdb.Pdb.Exec(
-		"INSERT INTO books (id, title, author) VALUES ($1, $2, $3)", idStr, b.Title, b.Author)
+	_, err = pdb.Pdb.ExecContext(ctx, query, idStr, b.Title, b.Author)
 	if err != nil {
-		return model.Book{}, errors.New("couldn't create book in database")
+		return model.Book{}, execError(err, "couldn't create book in database")
 	}
 
 	b.ID = id
+	pdb.wrote(ctx)
+
+	pdb.logger().DebugContext(ctx, "book created", "book_id", idStr)
 
 	return b, nil
 }
 
-func (pdb *PostgresDB) GetBook(id string) (model.Book, error) {
+// GetBook selects only the columns of the masked fields, the id is known
+// already and is only selected when nothing else is asked for. The revision
+// is always read, it versions what was read.
+func (pdb *PostgresDB) GetBook(ctx context.Context, id string, mask model.ReadMask) (_ model.Book, err error) {
+
+	var (
+		b      model.Book
+		fields []string
+		bb     string
+	)
+	for _, f := range mask.Fields() {
+		if f != model.FieldID {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		fields = []string{model.FieldID}
+	}
+
+	query := `SELECT ` + columns(fields) + `, revision, updated_at FROM books WHERE id=$1`
 
-	var b model.Book
+	ctx, done := pdb.startSpan(ctx, "SELECT", "books", query)
+	defer func() { done(err) }()
 
-	err := pdb.Pdb.QueryRow(
-		`SELECT title, author FROM books WHERE id=$1`, id).Scan(&b.Title, &b.Author)
+	targets := append(scanTargets(fields, &b, &bb), &b.Revision.Version, &b.Revision.UpdatedAt)
+	err = pdb.reader(ctx).QueryRowContext(ctx, query, id).Scan(targets...)
 	if err != nil {
-		return model.Book{}, errors.New("couldn't find book")
+		return model.Book{}, queryError(err)
 	}
 
-	b.ID, _ = uuid.Parse(id)
+	if mask.Has(model.FieldID) {
+		b.ID, _ = uuid.Parse(id)
+	}
 
 	return b, nil
 }
 
-func (pdb *PostgresDB) UpdateBook(id string, in model.UpdateBookInput) (model.Book, error) {
-	pdb.mu.Lock()
-	defer pdb.mu.Unlock()
+// CatalogRevision reads the revision the triggers of the books table bump
+// on every write.
+func (pdb *PostgresDB) CatalogRevision(ctx context.Context) (_ model.Revision, err error) {
+	const query = `SELECT revision, updated_at FROM catalog_revision`
 
-	var b model.Book
+	ctx, done := pdb.startSpan(ctx, "SELECT", "catalog_revision", query)
+	defer func() { done(err) }()
 
-	err := pdb.Pdb.QueryRow(
-		`SELECT title, author FROM books WHERE id=$1`, id).Scan(&b.Title, &b.Author)
+	var r model.Revision
+	err = pdb.reader(ctx).QueryRowContext(ctx, query).Scan(&r.Version, &r.UpdatedAt)
 	if err != nil {
-		return model.Book{}, errors.New("couldn't find book")
+		return model.Revision{}, fmt.Errorf("couldn't read catalog revision: %w", ErrInternal)
 	}
+	return r, nil
+}
 
-	if in.Title == "" {
-		in.Title = b.Title
+// BookRevision reads the revision of a book without its fields.
+func (pdb *PostgresDB) BookRevision(ctx context.Context, id string) (_ model.Revision, err error) {
+	const query = `SELECT revision, updated_at FROM books WHERE id=$1`
+
+	ctx, done := pdb.startSpan(ctx, "SELECT", "books", query)
+	defer func() { done(err) }()
+
+	var r model.Revision
+	err = pdb.reader(ctx).QueryRowContext(ctx, query, id).Scan(&r.Version, &r.UpdatedAt)
+	if err != nil {
+		return model.Revision{}, queryError(err)
 	}
-	if in.Author == "" {
-		in.Author = b.Author
+	return r, nil
+}
+
+// bookColumns maps field mask paths to the columns of the books table.
+var bookColumns = map[string]string{
+	model.FieldID:     "id",
+	model.FieldTitle:  "title",
+	model.FieldAuthor: "author",
+}
+
+// columns returns the select list for fields, which must be book fields.
+func columns(fields []string) string {
+	cols := make([]string, 0, len(fields))
+	for _, f := range fields {
+		cols = append(cols, bookColumns[f])
 	}
+	return strings.Join(cols, ", ")
+}
 
-	_, err = pdb.Pdb.Exec(
-		`UPDATE books SET title=$1, author=$2 WHERE id=$3`, in.Title, in.Author, id)
-	if err != nil {
-		return model.Book{}, errors.New("couldn't update post")
+// scanTargets returns the scan destinations matching columns(fields), the
+// id is scanned into id as text.
+func scanTargets(fields []string, b *model.Book, id *string) []interface{} {
+	targets := make([]interface{}, 0, len(fields))
+	for _, f := range fields {
+		switch f {
+		case model.FieldID:
+			targets = append(targets, id)
+		case model.FieldTitle:
+			targets = append(targets, &b.Title)
+		case model.FieldAuthor:
+			targets = append(targets, &b.Author)
+		}
+	}
+	return targets
+}
+
+// UpdateBook writes only the columns in the input's field mask, and only if
+// the book is still at the input's IfVersion when it's set.
+func (pdb *PostgresDB) UpdateBook(ctx context.Context, id string, in model.UpdateBookInput) (_ model.Book, err error) {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+
+	values := map[string]string{
+		model.FieldTitle:  in.Title,
+		model.FieldAuthor: in.Author,
+	}
+
+	var (
+		set  []string
+		args []interface{}
+	)
+	for _, f := range in.Mask() {
+		col, ok := bookColumns[f]
+		if !ok || f == model.FieldID {
+			return model.Book{}, fmt.Errorf("unknown field %q: %w", f, ErrInvalidArgument)
+		}
+		args = append(args, values[f])
+		set = append(set, fmt.Sprintf("%s=$%d", col, len(args)))
+	}
+
+	if len(set) == 0 {
+		b, err := pdb.GetBook(ctx, id, nil)
+		if err == nil && in.IfVersion != 0 && b.Revision.Version != in.IfVersion {
+			return model.Book{}, fmt.Errorf("couldn't update book: %w", ErrConflict)
+		}
+		return b, err
 	}
 
-	UID, err := uuid.Parse(id)
+	args = append(args, id)
+	where := fmt.Sprintf("id=$%d", len(args))
+	if in.IfVersion != 0 {
+		args = append(args, in.IfVersion)
+		where += fmt.Sprintf(" AND revision=$%d", len(args))
+	}
+	query := fmt.Sprintf(`UPDATE books SET %s WHERE %s RETURNING title, author`, strings.Join(set, ", "), where)
+
+	ctx, done := pdb.startSpan(ctx, "UPDATE", "books", query)
+	defer func() { done(err) }()
+
+	var b model.Book
 
-	b = model.Book{
-		ID:     UID,
-		Title:  in.Title,
-		Author: in.Author,
+	err = pdb.Pdb.QueryRowContext(ctx, query, args...).Scan(&b.Title, &b.Author)
+	if errors.Is(err, sql.ErrNoRows) && in.IfVersion != 0 {
+		// The book is gone, or at another revision.
+		var exists bool
+		if err := pdb.Pdb.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM books WHERE id=$1)`, id).Scan(&exists); err != nil {
+			return model.Book{}, fmt.Errorf("couldn't update book: %w", ErrInternal)
+		}
+		if exists {
+			return model.Book{}, fmt.Errorf("couldn't update book: %w", ErrConflict)
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Book{}, queryError(err)
+	}
+	if err != nil {
+		return model.Book{}, execError(err, "couldn't update book")
 	}
 
+	b.ID, _ = uuid.Parse(id)
+	pdb.wrote(ctx)
+
 	return b, nil
 }
 
-func (pdb *PostgresDB) DeleteBook(id string) error {
+func (pdb *PostgresDB) DeleteBook(ctx context.Context, id string) (err error) {
 	pdb.mu.Lock()
 	defer pdb.mu.Unlock()
 
-	_, err := pdb.Pdb.Exec(
-		`DELETE FROM books where id = $1`, id)
+	const query = `DELETE FROM books where id = $1`
+
+	ctx, done := pdb.startSpan(ctx, "DELETE", "books", query)
+	defer func() { done(err) }()
+
+	res, err := pdb.Pdb.ExecContext(ctx, query, id)
 	if err != nil {
-		return errors.New("couldn't delete book")
+		return fmt.Errorf("couldn't delete book: %w", ErrInternal)
 	}
 
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("couldn't delete book: %w", ErrInternal)
+	}
+	if n == 0 {
+		return fmt.Errorf("couldn't delete book: %w", ErrNotFound)
+	}
+	pdb.wrote(ctx)
+
 	return nil
 }
+
+// queryError translates errors of single row lookups into storage errors.
+func queryError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("couldn't find book: %w", ErrNotFound)
+	}
+	return fmt.Errorf("couldn't find book: %w", ErrInternal)
+}
+
+// execError translates errors of statements writing books, data exceptions
+// such as a value too long for its column are the caller's fault.
+func execError(err error, msg string) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Class() == "22" {
+		return fmt.Errorf("%s: %w", msg, ErrInvalidArgument)
+	}
+	return fmt.Errorf("%s: %w", msg, ErrInternal)
+}
@@ -1,11 +1,36 @@
 package storage
 
-import "gin_training/internal/model"
+import (
+	"context"
+
+	"gin_training/internal/model"
+)
 
 type DB interface {
-	FindAll() []model.Book
-	Create(model.Book) (model.Book, error)
-	GetBook(string) (model.Book, error)
-	UpdateBook(string, model.UpdateBookInput) (model.Book, error)
-	DeleteBook(string) error
+	// FindAll returns the books with the catalog revision they're at.
+	FindAll(context.Context, model.ReadMask) ([]model.Book, model.Revision, error)
+	Create(context.Context, model.Book) (model.Book, error)
+	GetBook(context.Context, string, model.ReadMask) (model.Book, error)
+	UpdateBook(context.Context, string, model.UpdateBookInput) (model.Book, error)
+	DeleteBook(context.Context, string) error
+	// CatalogRevision changes with every write to the books, BookRevision
+	// with every write to the book. Both are cheaper than reading the
+	// books, a missing book is ErrNotFound.
+	CatalogRevision(context.Context) (model.Revision, error)
+	BookRevision(context.Context, string) (model.Revision, error)
+}
+
+// APIKeyStore keeps the API keys of machine clients.
+type APIKeyStore interface {
+	// CreateAPIKey returns the new key with its plaintext, which isn't
+	// stored and can't be read again.
+	CreateAPIKey(context.Context, model.CreateAPIKeyInput) (model.APIKey, error)
+	ListAPIKeys(context.Context) ([]model.APIKey, error)
+	RevokeAPIKey(context.Context, string) error
+	// AuthenticateAPIKey returns the key matching a plaintext key and
+	// records its use, revoked and expired keys are ErrNotFound.
+	AuthenticateAPIKey(context.Context, string) (model.APIKey, error)
+	// FindAPIKey is AuthenticateAPIKey without recording the use, for
+	// checking a key that the calls made with it record.
+	FindAPIKey(context.Context, string) (model.APIKey, error)
 }
@@ -1,16 +1,33 @@
 package storage
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+
+	"gin_training/internal/auth"
+	"gin_training/internal/logging"
 	"gin_training/internal/model"
 )
 
@@ -34,7 +51,7 @@ func TestPostgresDB_Create(t *testing.T) {
 
 	b := model.Book{Title: "title", Author: "author"}
 
-	res, err := pdb.Create(b)
+	res, err := pdb.Create(context.Background(), b)
 
 	require.NoError(t, err)
 	require.NotNil(t, res)
@@ -49,29 +66,28 @@ func TestPostgresDB_GetBook(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectQuery(`SELECT title, author FROM books WHERE id=$1`).
+	updated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT title, author, revision, updated_at FROM books WHERE id=$1`).
 		WithArgs("00000000-0000-0000-0000-000000000000").
 		WillReturnRows(
 			mock.
-				NewRows([]string{"id", "title", "author"}).
-				AddRow("00000000-0000-0000-0000-000000000000", "title", "author"),
+				NewRows([]string{"title", "author", "revision", "updated_at"}).
+				AddRow("title", "author", 3, updated),
 		)
 
 	postgreSQL := &PostgresDB{Pdb: db}
 
-	res, err := postgreSQL.GetBook("00000000-0000-0000-0000-000000000000")
+	res, err := postgreSQL.GetBook(context.Background(), "00000000-0000-0000-0000-000000000000", nil)
 	if err != nil {
-		errors.New("error in the database")
-		return
+		t.Fatalf("error in the database: %v", err)
 	}
 
 	uid, err := uuid.Parse("00000000-0000-0000-0000-000000000000")
 	if err != nil {
-		errors.New("error with parsing uuid")
-		return
+		t.Fatalf("error with parsing uuid: %v", err)
 	}
 
-	exp := model.Book{uid, "title", "author"}
+	exp := model.Book{ID: uid, Title: "title", Author: "author", Revision: model.Revision{Version: 3, UpdatedAt: updated}}
 
 	require.NoError(t, err)
 	require.NotNil(t, res)
@@ -85,26 +101,33 @@ func TestPostgresDB_FindAll(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectQuery(`SELECT * FROM books`).
+	updated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT revision, updated_at FROM catalog_revision`).
+		WillReturnRows(mock.NewRows([]string{"revision", "updated_at"}).AddRow(42, updated))
+	mock.ExpectQuery(`SELECT id, title, author FROM books`).
 		WillReturnRows(
 			mock.
 				NewRows([]string{"id", "title", "author"}).
 				AddRow(
 					"00000000-0000-0000-0000-000000000000", "title", "author"),
 		)
+	mock.ExpectCommit()
 
 	postgreSQL := &PostgresDB{Pdb: db}
 
-	res := postgreSQL.FindAll()
+	res, rev, err := postgreSQL.FindAll(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, model.Revision{Version: 42, UpdatedAt: updated}, rev)
+	require.NoError(t, mock.ExpectationsWereMet())
 
 	uid, err := uuid.Parse("00000000-0000-0000-0000-000000000000")
 	if err != nil {
-		errors.New("error with parsing uuid")
-		return
+		t.Fatalf("error with parsing uuid: %v", err)
 	}
 
 	exp := []model.Book{
-		{uid, "title", "author"},
+		{ID: uid, Title: "title", Author: "author"},
 	}
 
 	require.NoError(t, err)
@@ -121,30 +144,25 @@ func TestPostgresDB_UpdateBook(t *testing.T) {
 
 	uid, err := uuid.Parse("00000000-0000-0000-0000-000000000000")
 	if err != nil {
-		errors.New("error with parsing uuid")
-		return
+		t.Fatalf("error with parsing uuid: %v", err)
 	}
 
-	exp := model.Book{uid, "title2", "author2"}
+	exp := model.Book{ID: uid, Title: "title2", Author: "author2"}
 
 	in := model.UpdateBookInput{Title: "title2", Author: "author2"}
 
-	mock.ExpectQuery(`SELECT title, author FROM books WHERE id=$1`).
-		WithArgs("00000000-0000-0000-0000-000000000000").
+	mock.ExpectQuery(`UPDATE books SET title=$1, author=$2 WHERE id=$3 RETURNING title, author`).
+		WithArgs("title2", "author2", "00000000-0000-0000-0000-000000000000").
 		WillReturnRows(mock.
-			NewRows([]string{"id", "title", "author"}).
-			AddRow("00000000-0000-0000-0000-000000000000", "title", "author"),
+			NewRows([]string{"title", "author"}).
+			AddRow("title2", "author2"),
 		)
-	mock.ExpectExec(`UPDATE books SET title=$1, author=$2 WHERE id=$3`).
-		WithArgs("title2", "author2", "00000000-0000-0000-0000-000000000000").
-		WillReturnResult(sqlmock.NewResult(0, 1))
 
 	postgreSQL := &PostgresDB{Pdb: db}
 
-	res, err := postgreSQL.UpdateBook("00000000-0000-0000-0000-000000000000", in)
+	res, err := postgreSQL.UpdateBook(context.Background(), "00000000-0000-0000-0000-000000000000", in)
 	if err != nil {
-		errors.New("error in the database")
-		return
+		t.Fatalf("error in the database: %v", err)
 	}
 
 	require.NoError(t, err)
@@ -152,6 +170,92 @@ func TestPostgresDB_UpdateBook(t *testing.T) {
 	require.Equal(t, exp, res)
 }
 
+func TestPostgresDB_UpdateBookMasked(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection: %s", err, mock)
+	}
+	defer db.Close()
+
+	uid, _ := uuid.Parse("00000000-0000-0000-0000-000000000000")
+
+	in := model.UpdateBookInput{Title: "ignored", Fields: []string{model.FieldAuthor}}
+
+	mock.ExpectQuery(`UPDATE books SET author=$1 WHERE id=$2 RETURNING title, author`).
+		WithArgs("", "00000000-0000-0000-0000-000000000000").
+		WillReturnRows(mock.
+			NewRows([]string{"title", "author"}).
+			AddRow("title", ""),
+		)
+
+	postgreSQL := &PostgresDB{Pdb: db}
+
+	res, err := postgreSQL.UpdateBook(context.Background(), "00000000-0000-0000-0000-000000000000", in)
+
+	require.NoError(t, err)
+	require.Equal(t, model.Book{ID: uid, Title: "title"}, res)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_UpdateBookIfVersion(t *testing.T) {
+	const id = "00000000-0000-0000-0000-000000000000"
+	uid, _ := uuid.Parse(id)
+	in := model.UpdateBookInput{Title: "title", Fields: []string{model.FieldTitle}, IfVersion: 7}
+	const query = `UPDATE books SET title=$1 WHERE id=$2 AND revision=$3 RETURNING title, author`
+
+	tests := []struct {
+		name    string
+		expect  func(mock sqlmock.Sqlmock)
+		want    model.Book
+		wantErr error
+	}{
+		{
+			name: "Same revision",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).WithArgs("title", id, int64(7)).
+					WillReturnRows(mock.NewRows([]string{"title", "author"}).AddRow("title", "author"))
+			},
+			want: model.Book{ID: uid, Title: "title", Author: "author"},
+		},
+		{
+			name: "Changed meanwhile",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).WithArgs("title", id, int64(7)).WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(`SELECT EXISTS (SELECT 1 FROM books WHERE id=$1)`).WithArgs(id).
+					WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(true))
+			},
+			wantErr: ErrConflict,
+		},
+		{
+			name: "Deleted meanwhile",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).WithArgs("title", id, int64(7)).WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(`SELECT EXISTS (SELECT 1 FROM books WHERE id=$1)`).WithArgs(id).
+					WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			wantErr: ErrNotFound,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			require.NoError(t, err)
+			defer db.Close()
+			tc.expect(mock)
+
+			res, err := (&PostgresDB{Pdb: db}).UpdateBook(context.Background(), id, in)
+
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.want, res)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
 func TestPostgresDB_DeleteBook(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
@@ -165,7 +269,460 @@ func TestPostgresDB_DeleteBook(t *testing.T) {
 
 	postgreSQL := &PostgresDB{Pdb: db}
 
-	err = postgreSQL.DeleteBook("00000000-0000-0000-0000-000000000000")
+	err = postgreSQL.DeleteBook(context.Background(), "00000000-0000-0000-0000-000000000000")
+
+	require.NoError(t, err)
+}
+
+func TestPostgresDB_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection: %s", err, mock)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT title, author, revision, updated_at FROM books WHERE id=$1`).
+		WithArgs("00000000-0000-0000-0000-000000000000").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`DELETE FROM books where id = $1`).
+		WithArgs("00000000-0000-0000-0000-000000000000").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	postgreSQL := &PostgresDB{Pdb: db}
+
+	_, err = postgreSQL.GetBook(context.Background(), "00000000-0000-0000-0000-000000000000", nil)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	err = postgreSQL.DeleteBook(context.Background(), "00000000-0000-0000-0000-000000000000")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestPostgresDB_ReadMask(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection: %s", err, mock)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT revision, updated_at FROM catalog_revision`).
+		WillReturnRows(mock.NewRows([]string{"revision", "updated_at"}).AddRow(1, time.Time{}))
+	mock.ExpectQuery(`SELECT id, title FROM books`).
+		WillReturnRows(mock.NewRows([]string{"id", "title"}).
+			AddRow("00000000-0000-0000-0000-000000000000", "title"))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT id, revision, updated_at FROM books WHERE id=$1`).
+		WithArgs("00000000-0000-0000-0000-000000000000").
+		WillReturnRows(mock.NewRows([]string{"id", "revision", "updated_at"}).
+			AddRow("00000000-0000-0000-0000-000000000000", 1, time.Time{}))
+
+	postgreSQL := &PostgresDB{Pdb: db}
+
+	uid, _ := uuid.Parse("00000000-0000-0000-0000-000000000000")
+
+	books, _, err := postgreSQL.FindAll(context.Background(), model.ReadMask{"title", "id"})
+	require.NoError(t, err)
+	require.Equal(t, []model.Book{{ID: uid, Title: "title"}}, books)
+
+	book, err := postgreSQL.GetBook(context.Background(), "00000000-0000-0000-0000-000000000000", model.ReadMask{"id"})
+	require.NoError(t, err)
+	require.Equal(t, model.Book{ID: uid, Revision: model.Revision{Version: 1}}, book)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_Revisions(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	id := "00000000-0000-0000-0000-000000000000"
+	updated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT revision, updated_at FROM catalog_revision`).
+		WillReturnRows(mock.NewRows([]string{"revision", "updated_at"}).AddRow(42, updated))
+	mock.ExpectQuery(`SELECT revision, updated_at FROM books WHERE id=$1`).WithArgs(id).
+		WillReturnRows(mock.NewRows([]string{"revision", "updated_at"}).AddRow(2, updated))
+	mock.ExpectQuery(`SELECT revision, updated_at FROM books WHERE id=$1`).WithArgs(id).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT revision, updated_at FROM catalog_revision`).
+		WillReturnError(sql.ErrConnDone)
+
+	pdb := &PostgresDB{Pdb: db}
+
+	rev, err := pdb.CatalogRevision(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, model.Revision{Version: 42, UpdatedAt: updated}, rev)
+
+	rev, err = pdb.BookRevision(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, model.Revision{Version: 2, UpdatedAt: updated}, rev)
+
+	_, err = pdb.BookRevision(context.Background(), id)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = pdb.CatalogRevision(context.Background())
+	require.ErrorIs(t, err, ErrInternal)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_APIKeys(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection: %s", err, mock)
+	}
+	defer db.Close()
+
+	pdb := &PostgresDB{Pdb: db}
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(`INSERT INTO api_keys (id, hash, owner, scopes, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING created_at`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "batch", "books:read role:reader", nil).
+		WillReturnRows(mock.NewRows([]string{"created_at"}).AddRow(created))
+
+	k, err := pdb.CreateAPIKey(context.Background(), model.CreateAPIKeyInput{Owner: "batch", Scopes: []string{"books:read", "role:reader"}})
+	require.NoError(t, err)
+	assert.NotEmpty(t, k.Key)
+	assert.Equal(t, created, k.CreatedAt)
+
+	mock.ExpectQuery(`UPDATE api_keys SET last_used_at=now()
+		WHERE hash=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+		RETURNING id, owner, scopes, expires_at, last_used_at, created_at, revoked_at`).
+		WithArgs(auth.HashAPIKey(k.Key)).
+		WillReturnRows(mock.NewRows([]string{"id", "owner", "scopes", "expires_at", "last_used_at", "created_at", "revoked_at"}).
+			AddRow(k.ID.String(), "batch", "books:read role:reader", nil, created, created, nil))
+
+	got, err := pdb.AuthenticateAPIKey(context.Background(), k.Key)
+	require.NoError(t, err)
+	assert.Equal(t, model.APIKey{
+		ID:         k.ID,
+		Owner:      "batch",
+		Scopes:     []string{"books:read", "role:reader"},
+		LastUsedAt: &created,
+		CreatedAt:  created,
+	}, got)
+
+	mock.ExpectQuery(`UPDATE api_keys SET last_used_at=now()
+		WHERE hash=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+		RETURNING id, owner, scopes, expires_at, last_used_at, created_at, revoked_at`).
+		WithArgs(auth.HashAPIKey("bk_unknown")).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = pdb.AuthenticateAPIKey(context.Background(), "bk_unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	mock.ExpectQuery(`SELECT id, owner, scopes, expires_at, last_used_at, created_at, revoked_at FROM api_keys
+		WHERE hash=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())`).
+		WithArgs(auth.HashAPIKey(k.Key)).
+		WillReturnRows(mock.NewRows([]string{"id", "owner", "scopes", "expires_at", "last_used_at", "created_at", "revoked_at"}).
+			AddRow(k.ID.String(), "batch", "books:read role:reader", nil, created, created, nil))
+	mock.ExpectQuery(`SELECT id, owner, scopes, expires_at, last_used_at, created_at, revoked_at FROM api_keys
+		WHERE hash=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())`).
+		WithArgs(auth.HashAPIKey("bk_unknown")).
+		WillReturnError(sql.ErrNoRows)
+
+	got, err = pdb.FindAPIKey(context.Background(), k.Key)
+	require.NoError(t, err)
+	assert.Equal(t, "batch", got.Owner)
+	_, err = pdb.FindAPIKey(context.Background(), "bk_unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	mock.ExpectExec(`UPDATE api_keys SET revoked_at=now() WHERE id=$1 AND revoked_at IS NULL`).
+		WithArgs(k.ID.String()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.ErrorIs(t, pdb.RevokeAPIKey(context.Background(), k.ID.String()), ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_Tracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var logs bytes.Buffer
+	pdb := &PostgresDB{Pdb: db, log: logging.New(&logs, slog.LevelInfo)}
+	id := "00000000-0000-0000-0000-000000000000"
+
+	mock.ExpectQuery(`SELECT title, revision, updated_at FROM books WHERE id=$1`).WithArgs(id).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`DELETE FROM books where id = $1`).WithArgs(id).WillReturnError(sql.ErrConnDone)
+
+	parent, root := otel.Tracer("test").Start(logging.WithRequestID(context.Background(), "req-42"), "proto.BookService/GetBook")
+	_, err = pdb.GetBook(parent, id, model.ReadMask{model.FieldTitle})
+	assert.ErrorIs(t, err, ErrNotFound)
+	err = pdb.DeleteBook(parent, id)
+	assert.ErrorIs(t, err, ErrInternal)
+	root.End()
+
+	spans := sr.Ended()
+	require.Len(t, spans, 3)
+
+	get := spans[0]
+	assert.Equal(t, "SELECT books", get.Name())
+	assert.Equal(t, root.SpanContext().SpanID(), get.Parent().SpanID())
+	assert.Contains(t, get.Attributes(), semconv.DBSystemPostgreSQL)
+	assert.Contains(t, get.Attributes(), attribute.String("db.statement", `SELECT title, revision, updated_at FROM books WHERE id=$1`))
+	// A missing book isn't a database failure.
+	assert.Equal(t, codes.Unset, get.Status().Code)
+
+	del := spans[1]
+	assert.Equal(t, "DELETE books", del.Name())
+	assert.Equal(t, codes.Error, del.Status().Code)
+
+	// Only the failure is logged, with the request and the statement span.
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+	assert.Equal(t, "ERROR", line["level"])
+	assert.Equal(t, "DELETE books", line["statement"])
+	assert.Equal(t, "req-42", line["request_id"])
+	assert.Equal(t, del.SpanContext().SpanID().String(), line["span_id"])
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDB_Migrate(t *testing.T) {
+	latest := migrations[len(migrations)-1].version
+
+	tests := []struct {
+		name    string
+		applied int
+		failAt  int
+		wantErr error
+	}{
+		{name: "Fresh database", applied: 0},
+		{name: "Up to date", applied: latest},
+		{name: "Failing migration", applied: 0, failAt: latest, wantErr: ErrInternal},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			pdb := &PostgresDB{Pdb: db}
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1\)`).WithArgs(migrationLock).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) FROM schema_migrations`).
+				WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(tc.applied))
+			for _, m := range migrations[tc.applied:] {
+				if m.version == tc.failAt {
+					mock.ExpectExec(regexp.QuoteMeta(m.statement)).WillReturnError(errors.New("syntax error"))
+					break
+				}
+				mock.ExpectExec(regexp.QuoteMeta(m.statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(m.version, m.name).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			if tc.wantErr != nil {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectCommit()
+			}
+
+			err = pdb.Migrate(context.Background())
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPostgresDB_MigrationStatus(t *testing.T) {
+	latest := migrations[len(migrations)-1].version
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	pdb := &PostgresDB{Pdb: db}
 
+	// Never migrated.
+	mock.ExpectQuery(`SELECT to_regclass`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	status, err := pdb.MigrationStatus(context.Background())
 	require.NoError(t, err)
+	assert.Equal(t, MigrationStatus{Applied: 0, Latest: latest}, status)
+	assert.True(t, status.Pending())
+
+	mock.ExpectQuery(`SELECT to_regclass`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(latest))
+	status, err = pdb.MigrationStatus(context.Background())
+	require.NoError(t, err)
+	assert.False(t, status.Pending())
+	assert.Equal(t, fmt.Sprintf("%d of %d migrations applied", latest, latest), status.String())
+
+	mock.ExpectQuery(`SELECT to_regclass`).WillReturnError(sql.ErrConnDone)
+	_, err = pdb.MigrationStatus(context.Background())
+	assert.ErrorIs(t, err, ErrUnavailable)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConfig_DSN(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		want       string
+		wantTarget string
+	}{
+		{
+			name:       "Separate settings",
+			cfg:        Config{Host: "db", Port: "5432", User: "books", Password: `it's a \ secret`, Database: "books", SSLMode: "disable"},
+			want:       `host='db' port='5432' user='books' password='it\'s a \\ secret' dbname='books' sslmode='disable'`,
+			wantTarget: "db:5432/books",
+		},
+		{
+			name:       "URL wins",
+			cfg:        Config{URL: "postgres://books:secret@db:5432/books?sslmode=require", Host: "ignored"},
+			want:       "postgres://books:secret@db:5432/books?sslmode=require",
+			wantTarget: "db:5432/books",
+		},
+		{
+			name:       "Key/value URL",
+			cfg:        Config{URL: "host=db password=secret"},
+			want:       "host=db password=secret",
+			wantTarget: "the configured URL",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.cfg.DSN())
+			assert.Equal(t, tc.wantTarget, tc.cfg.target())
+			assert.NotContains(t, tc.cfg.target(), "secret")
+		})
+	}
+}
+
+func TestNewPDB_InvalidConfig(t *testing.T) {
+	_, err := NewPDB(context.Background(), Config{URL: "postgres://books:%zz@db/books"})
+	assert.ErrorContains(t, err, "invalid postgres URL")
+
+	_, err = NewPDB(context.Background(), Config{Host: "db", MaxOpenConns: 5, MaxIdleConns: 10})
+	assert.ErrorContains(t, err, "max idle connections (10) exceed max open ones (5)")
+}
+
+func TestPostgresDB_Connect(t *testing.T) {
+	errRefused := errors.New("dial tcp: connection refused")
+	errPassword := &pq.Error{Code: "28P01", Message: "password authentication failed"}
+
+	tests := []struct {
+		name     string
+		pings    []error
+		attempts int
+		wantErr  error
+	}{
+		{
+			name:     "Answers right away",
+			pings:    []error{nil},
+			attempts: 3,
+		},
+		{
+			name:     "Answers after a retry",
+			pings:    []error{errRefused, nil},
+			attempts: 3,
+		},
+		{
+			name:     "Gives up after the attempts",
+			pings:    []error{errRefused, errRefused, errRefused},
+			attempts: 3,
+			wantErr:  errRefused,
+		},
+		{
+			name:     "Wrong password isn't retried",
+			pings:    []error{errPassword},
+			attempts: 3,
+			wantErr:  errPassword,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+			require.NoError(t, err)
+			defer db.Close()
+			for _, err := range tc.pings {
+				mock.ExpectPing().WillReturnError(err)
+			}
+
+			pdb := &PostgresDB{Pdb: db, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+			cfg := Config{Host: "db", Port: "5432", Database: "books", ConnectAttempts: tc.attempts, ConnectBackoff: time.Millisecond}
+			err = pdb.connect(context.Background(), cfg)
+
+			assert.ErrorIs(t, err, tc.wantErr)
+			if tc.wantErr != nil {
+				assert.ErrorContains(t, err, "couldn't reach postgres at db:5432/books")
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPostgresDB_Replicas(t *testing.T) {
+	open := func() *sql.DB {
+		db, _, err := sqlmock.New()
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	primary, first, second := open(), open(), open()
+
+	pdb := &PostgresDB{Pdb: primary, replicas: []*replica{{db: first}, {db: second}}}
+	WithReadYourWrites(time.Second)(pdb)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	pdb.pins.now = func() time.Time { return now }
+
+	alice := WithSession(context.Background(), "alice")
+	bob := WithSession(context.Background(), "bob")
+
+	// Replicas start ejected until their health check passes.
+	assert.Same(t, primary, pdb.reader(alice))
+
+	pdb.replicas[0].healthy.Store(true)
+	pdb.replicas[1].healthy.Store(true)
+	assert.ElementsMatch(t, []*sql.DB{first, second}, []*sql.DB{pdb.reader(alice), pdb.reader(alice)})
+
+	pdb.replicas[0].healthy.Store(false)
+	assert.Same(t, second, pdb.reader(alice))
+	assert.Same(t, second, pdb.reader(alice))
+
+	// Alice reads her writes from the primary for the window, Bob doesn't.
+	pdb.wrote(alice)
+	assert.Same(t, primary, pdb.reader(alice))
+	assert.Same(t, second, pdb.reader(bob))
+
+	now = now.Add(time.Second)
+	assert.Same(t, second, pdb.reader(alice))
+
+	assert.Equal(t, "1 of 2 replicas serving reads", pdb.ReplicaStatus())
+}
+
+func TestPostgresDB_CheckReplica(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	pdb := &PostgresDB{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	r := &replica{db: db, target: "replica:5432/books"}
+
+	mock.ExpectPing()
+	pdb.checkReplica(context.Background(), r, time.Second)
+	assert.True(t, r.healthy.Load())
+
+	mock.ExpectPing().WillReturnError(errors.New("dial tcp: connection refused"))
+	pdb.checkReplica(context.Background(), r, time.Second)
+	assert.False(t, r.healthy.Load())
+
+	mock.ExpectPing()
+	pdb.checkReplica(context.Background(), r, time.Second)
+	assert.True(t, r.healthy.Load())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
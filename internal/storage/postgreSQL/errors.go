@@ -0,0 +1,20 @@
+package storage
+
+import "errors"
+
+// Errors returned by DB implementations. Callers should match them with
+// errors.Is, implementations wrap them with a more specific message.
+var (
+	ErrNotFound        = errors.New("book not found")
+	ErrInvalidArgument = errors.New("invalid argument")
+	ErrUnavailable     = errors.New("storage unavailable")
+	ErrInternal        = errors.New("internal storage error")
+	// ErrConflict is returned by a conditional write whose book changed
+	// since the revision it was computed from.
+	ErrConflict = errors.New("book changed meanwhile")
+	// ErrPermissionDenied is returned by a remote storage that refused the
+	// caller's credentials or roles.
+	ErrPermissionDenied = errors.New("storage permission denied")
+	// ErrRateLimited is returned by a remote storage throttling the caller.
+	ErrRateLimited = errors.New("storage rate limit exceeded")
+)
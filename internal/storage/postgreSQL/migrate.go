@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// migration is a schema change, applied once in version order.
+type migration struct {
+	version   int
+	name      string
+	statement string
+}
+
+// migrations is the schema history, append new changes with the next
+// version and never edit an applied one.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create books",
+		statement: `CREATE TABLE IF NOT EXISTS books (
+    id VARCHAR(40) PRIMARY KEY NOT NULL,
+    title VARCHAR(150) NOT NULL,
+    author VARCHAR(50) NOT NULL
+)`,
+	},
+	{
+		version: 2,
+		name:    "create api_keys",
+		statement: `CREATE TABLE IF NOT EXISTS api_keys (
+    id VARCHAR(40) PRIMARY KEY NOT NULL,
+    hash CHAR(64) UNIQUE NOT NULL,
+    owner VARCHAR(100) NOT NULL,
+    scopes TEXT NOT NULL,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+)`,
+	},
+	{
+		version: 3,
+		name:    "add book and catalog revisions",
+		statement: `ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE TABLE IF NOT EXISTS catalog_revision (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    revision BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+INSERT INTO catalog_revision (revision, updated_at) VALUES (1, now()) ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION bump_book_revision() RETURNS trigger AS $$
+BEGIN
+    NEW.revision := OLD.revision + 1;
+    NEW.updated_at := now();
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER books_revision BEFORE UPDATE ON books
+    FOR EACH ROW EXECUTE FUNCTION bump_book_revision();
+
+CREATE OR REPLACE FUNCTION bump_catalog_revision() RETURNS trigger AS $$
+BEGIN
+    UPDATE catalog_revision SET revision = revision + 1, updated_at = now();
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER books_catalog_revision AFTER INSERT OR UPDATE OR DELETE ON books
+    FOR EACH ROW EXECUTE FUNCTION bump_catalog_revision()`,
+	},
+	{
+		version: 4,
+		name:    "bump the catalog revision once per statement",
+		// A statement writing many books locks the catalog row once.
+		statement: `DROP TRIGGER IF EXISTS books_catalog_revision ON books;
+
+CREATE TRIGGER books_catalog_revision AFTER INSERT OR UPDATE OR DELETE ON books
+    FOR EACH STATEMENT EXECUTE FUNCTION bump_catalog_revision()`,
+	},
+}
+
+// migrationLock is the advisory lock serializing the servers migrating the
+// same database.
+const migrationLock = 7262730
+
+// MigrationStatus is the schema version of the database against the one
+// this build expects.
+type MigrationStatus struct {
+	Applied int `json:"applied"`
+	Latest  int `json:"latest"`
+}
+
+// Pending reports whether migrations are left to apply.
+func (s MigrationStatus) Pending() bool {
+	return s.Applied < s.Latest
+}
+
+func (s MigrationStatus) String() string {
+	return fmt.Sprintf("%d of %d migrations applied", s.Applied, s.Latest)
+}
+
+// Migrate applies the pending migrations in one transaction, recording
+// them in schema_migrations.
+func (pdb *PostgresDB) Migrate(ctx context.Context) (err error) {
+	ctx, done := pdb.startSpan(ctx, "MIGRATE", "schema_migrations", "")
+	defer func() { done(err) }()
+
+	tx, err := pdb.Pdb.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't start migrations: %w", ErrUnavailable)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+		return fmt.Errorf("couldn't lock migrations: %w", ErrInternal)
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`); err != nil {
+		return fmt.Errorf("couldn't create schema_migrations: %w", ErrInternal)
+	}
+
+	var applied int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&applied); err != nil {
+		return fmt.Errorf("couldn't read schema version: %w", ErrInternal)
+	}
+
+	for _, m := range migrations {
+		if m.version <= applied {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, m.statement); err != nil {
+			return fmt.Errorf("couldn't apply migration %d %q: %w", m.version, m.name, ErrInternal)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name); err != nil {
+			return fmt.Errorf("couldn't record migration %d: %w", m.version, ErrInternal)
+		}
+		pdb.logger().InfoContext(ctx, "migration applied", "version", m.version, "name", m.name)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("couldn't commit migrations: %w", ErrInternal)
+	}
+	return nil
+}
+
+// MigrationStatus reads the schema version, a database never migrated is
+// at version 0.
+func (pdb *PostgresDB) MigrationStatus(ctx context.Context) (_ MigrationStatus, err error) {
+	const query = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+
+	ctx, done := pdb.startSpan(ctx, "SELECT", "schema_migrations", query)
+	defer func() { done(err) }()
+
+	status := MigrationStatus{Latest: migrations[len(migrations)-1].version}
+
+	var exists bool
+	err = pdb.Pdb.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return status, fmt.Errorf("couldn't read schema version: %w", ErrUnavailable)
+	}
+	if !exists {
+		return status, nil
+	}
+
+	if err = pdb.Pdb.QueryRowContext(ctx, query).Scan(&status.Applied); err != nil {
+		return status, fmt.Errorf("couldn't read schema version: %w", ErrUnavailable)
+	}
+	return status, nil
+}
@@ -3,6 +3,7 @@
 package mocks
 
 import (
+	context "context"
 	model "gin_training/internal/model"
 
 	mock "github.com/stretchr/testify/mock"
@@ -13,19 +14,40 @@ type DB struct {
 	mock.Mock
 }
 
-// Create provides a mock function with given fields: _a0
-func (_m *DB) Create(_a0 model.Book) (model.Book, error) {
+// BookRevision provides a mock function with given fields: _a0, _a1
+func (_m *DB) BookRevision(_a0 context.Context, _a1 string) (model.Revision, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 model.Revision
+	if rf, ok := ret.Get(0).(func(context.Context, string) model.Revision); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Get(0).(model.Revision)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CatalogRevision provides a mock function with given fields: _a0
+func (_m *DB) CatalogRevision(_a0 context.Context) (model.Revision, error) {
 	ret := _m.Called(_a0)
 
-	var r0 model.Book
-	if rf, ok := ret.Get(0).(func(model.Book) model.Book); ok {
+	var r0 model.Revision
+	if rf, ok := ret.Get(0).(func(context.Context) model.Revision); ok {
 		r0 = rf(_a0)
 	} else {
-		r0 = ret.Get(0).(model.Book)
+		r0 = ret.Get(0).(model.Revision)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(model.Book) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
 		r1 = rf(_a0)
 	} else {
 		r1 = ret.Error(1)
@@ -34,13 +56,34 @@ func (_m *DB) Create(_a0 model.Book) (model.Book, error) {
 	return r0, r1
 }
 
-// DeleteBook provides a mock function with given fields: id
-func (_m *DB) DeleteBook(id string) error {
-	ret := _m.Called(id)
+// Create provides a mock function with given fields: _a0, _a1
+func (_m *DB) Create(_a0 context.Context, _a1 model.Book) (model.Book, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 model.Book
+	if rf, ok := ret.Get(0).(func(context.Context, model.Book) model.Book); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Get(0).(model.Book)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.Book) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteBook provides a mock function with given fields: _a0, _a1
+func (_m *DB) DeleteBook(_a0 context.Context, _a1 string) error {
+	ret := _m.Called(_a0, _a1)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string) error); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(_a0, _a1)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -48,36 +91,50 @@ func (_m *DB) DeleteBook(id string) error {
 	return r0
 }
 
-// FindAll provides a mock function with given fields:
-func (_m *DB) FindAll() []model.Book {
-	ret := _m.Called()
+// FindAll provides a mock function with given fields: _a0, _a1
+func (_m *DB) FindAll(_a0 context.Context, _a1 model.ReadMask) ([]model.Book, model.Revision, error) {
+	ret := _m.Called(_a0, _a1)
 
 	var r0 []model.Book
-	if rf, ok := ret.Get(0).(func() []model.Book); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(context.Context, model.ReadMask) []model.Book); ok {
+		r0 = rf(_a0, _a1)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]model.Book)
 		}
 	}
 
-	return r0
+	var r1 model.Revision
+	if rf, ok := ret.Get(1).(func(context.Context, model.ReadMask) model.Revision); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Get(1).(model.Revision)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, model.ReadMask) error); ok {
+		r2 = rf(_a0, _a1)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
 }
 
-// GetBook provides a mock function with given fields: _a0
-func (_m *DB) GetBook(_a0 string) (model.Book, error) {
-	ret := _m.Called(_a0)
+// GetBook provides a mock function with given fields: _a0, _a1, _a2
+func (_m *DB) GetBook(_a0 context.Context, _a1 string, _a2 model.ReadMask) (model.Book, error) {
+	ret := _m.Called(_a0, _a1, _a2)
 
 	var r0 model.Book
-	if rf, ok := ret.Get(0).(func(string) model.Book); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.ReadMask) model.Book); ok {
+		r0 = rf(_a0, _a1, _a2)
 	} else {
 		r0 = ret.Get(0).(model.Book)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(context.Context, string, model.ReadMask) error); ok {
+		r1 = rf(_a0, _a1, _a2)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -85,20 +142,20 @@ func (_m *DB) GetBook(_a0 string) (model.Book, error) {
 	return r0, r1
 }
 
-// UpdateBook provides a mock function with given fields: _a0, _a1
-func (_m *DB) UpdateBook(_a0 string, _a1 model.UpdateBookInput) (model.Book, error) {
-	ret := _m.Called(_a0, _a1)
+// UpdateBook provides a mock function with given fields: _a0, _a1, _a2
+func (_m *DB) UpdateBook(_a0 context.Context, _a1 string, _a2 model.UpdateBookInput) (model.Book, error) {
+	ret := _m.Called(_a0, _a1, _a2)
 
 	var r0 model.Book
-	if rf, ok := ret.Get(0).(func(string, model.UpdateBookInput) model.Book); ok {
-		r0 = rf(_a0, _a1)
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.UpdateBookInput) model.Book); ok {
+		r0 = rf(_a0, _a1, _a2)
 	} else {
 		r0 = ret.Get(0).(model.Book)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, model.UpdateBookInput) error); ok {
-		r1 = rf(_a0, _a1)
+	if rf, ok := ret.Get(1).(func(context.Context, string, model.UpdateBookInput) error); ok {
+		r1 = rf(_a0, _a1, _a2)
 	} else {
 		r1 = ret.Error(1)
 	}
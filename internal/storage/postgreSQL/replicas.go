@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replicaPingTimeout bounds the first health check of a replica.
+const replicaPingTimeout = 2 * time.Second
+
+// replica is a read-only copy of the primary, reads skip it while its
+// health check fails.
+type replica struct {
+	db      *sql.DB
+	target  string
+	healthy atomic.Bool
+}
+
+// pins remembers the callers who wrote recently, their reads go to the
+// primary until the window is over so they see their own writes.
+type pins struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	until     map[string]time.Time
+	lastSweep time.Time
+}
+
+// WithReadYourWrites sends the reads of a caller to the primary for window
+// after each of its writes, replicas may not have caught up yet. Callers
+// are told apart by the session the transport set with WithSession.
+func WithReadYourWrites(window time.Duration) Option {
+	return func(pdb *PostgresDB) {
+		pdb.pins = &pins{window: window, now: time.Now, until: map[string]time.Time{}}
+	}
+}
+
+type sessionKey struct{}
+
+// WithSession stores in ctx the session the storage calls made with it
+// belong to, e.g. the subject of the caller's token, for read-your-writes.
+func WithSession(ctx context.Context, session string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// SessionFromContext returns the session stored by WithSession.
+func SessionFromContext(ctx context.Context) (string, bool) {
+	session, ok := ctx.Value(sessionKey{}).(string)
+	return session, ok && session != ""
+}
+
+// caller identifies the caller of a storage method, calls without a
+// session share one identity.
+func caller(ctx context.Context) string {
+	session, _ := SessionFromContext(ctx)
+	return session
+}
+
+func (p *pins) pin(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	if now.Sub(p.lastSweep) >= p.window {
+		for c, until := range p.until {
+			if !now.Before(until) {
+				delete(p.until, c)
+			}
+		}
+		p.lastSweep = now
+	}
+	p.until[caller(ctx)] = now.Add(p.window)
+}
+
+func (p *pins) pinned(ctx context.Context) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	until, ok := p.until[caller(ctx)]
+	return ok && p.now().Before(until)
+}
+
+// wrote records a write of the caller for read-your-writes.
+func (pdb *PostgresDB) wrote(ctx context.Context) {
+	if pdb.pins != nil {
+		pdb.pins.pin(ctx)
+	}
+}
+
+// reader returns the pool serving a read: the healthy replicas take turns,
+// the primary serves when none is healthy or the caller wrote recently.
+func (pdb *PostgresDB) reader(ctx context.Context) *sql.DB {
+	if len(pdb.replicas) == 0 || pdb.pins != nil && pdb.pins.pinned(ctx) {
+		return pdb.Pdb
+	}
+
+	start := pdb.next.Add(1)
+	for i := range pdb.replicas {
+		r := pdb.replicas[(start+uint64(i))%uint64(len(pdb.replicas))]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	return pdb.Pdb
+}
+
+// openReplicas opens a pool per replica DSN with the settings of cfg. A
+// replica that doesn't answer yet starts ejected.
+func (pdb *PostgresDB) openReplicas(ctx context.Context, cfg Config) error {
+	for _, dsn := range cfg.Replicas {
+		rcfg := cfg
+		rcfg.URL = dsn
+		if err := rcfg.validate(); err != nil {
+			return fmt.Errorf("replica: %w", err)
+		}
+
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return fmt.Errorf("couldn't open replica %s: %w", rcfg.target(), err)
+		}
+		rcfg.configurePool(db)
+
+		r := &replica{db: db, target: rcfg.target()}
+		pdb.replicas = append(pdb.replicas, r)
+		pdb.checkReplica(ctx, r, replicaPingTimeout)
+	}
+	return nil
+}
+
+// checkReplica pings r and ejects it, or brings it back, accordingly.
+func (pdb *PostgresDB) checkReplica(ctx context.Context, r *replica, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := r.db.PingContext(ctx)
+	switch healthy := err == nil; {
+	case healthy && !r.healthy.Swap(true):
+		pdb.logger().InfoContext(ctx, "replica serving reads", "target", r.target)
+	case !healthy && r.healthy.Swap(false):
+		pdb.logger().WarnContext(ctx, "replica ejected", "target", r.target, "error", err)
+	case !healthy:
+		pdb.logger().DebugContext(ctx, "replica still unreachable", "target", r.target, "error", err)
+	}
+}
+
+// WatchReplicas checks the replicas every interval until ctx is done,
+// ejecting the ones that don't answer within timeout and bringing them back
+// once they do.
+func (pdb *PostgresDB) WatchReplicas(ctx context.Context, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var wg sync.WaitGroup
+			for _, r := range pdb.replicas {
+				wg.Add(1)
+				go func(r *replica) {
+					defer wg.Done()
+					pdb.checkReplica(ctx, r, timeout)
+				}(r)
+			}
+			wg.Wait()
+		}
+	}
+}
+
+// ReplicaStatus describes the replicas, for the readiness report. Reads
+// fall back to the primary, so ejected replicas don't make the server
+// unready.
+func (pdb *PostgresDB) ReplicaStatus() string {
+	healthy := 0
+	for _, r := range pdb.replicas {
+		if r.healthy.Load() {
+			healthy++
+		}
+	}
+	return fmt.Sprintf("%d of %d replicas serving reads", healthy, len(pdb.replicas))
+}
+
+// Close closes the primary and replica pools.
+func (pdb *PostgresDB) Close() error {
+	err := pdb.Pdb.Close()
+	for _, r := range pdb.replicas {
+		if rerr := r.db.Close(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "gin_training/internal/storage/postgreSQL"
+
+// startSpan starts a client span for statement, an operation such as
+// SELECT on table. The span is a child of the gRPC call in ctx, done ends
+// it with the result of the statement.
+func (pdb *PostgresDB) startSpan(ctx context.Context, operation, table, statement string) (context.Context, func(error)) {
+	name := operation + " " + table
+	ctx, span := otel.Tracer(instrumentation).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperation(operation),
+			semconv.DBSQLTable(table),
+			semconv.DBStatement(statement),
+		))
+
+	done := func(err error) {
+		defer span.End()
+
+		// A missing row is an answer of the database rather than a failure.
+		if err == nil || errors.Is(err, ErrNotFound) {
+			return
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		level := slog.LevelError
+		if errors.Is(err, ErrInvalidArgument) {
+			level = slog.LevelInfo
+		}
+		pdb.logger().Log(ctx, level, "statement failed", "statement", name, "error", err)
+	}
+
+	return ctx, done
+}
+
+func (pdb *PostgresDB) logger() *slog.Logger {
+	if pdb.log == nil {
+		return slog.Default()
+	}
+	return pdb.log
+}
@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestSetup(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+
+	shutdown, err := Setup(context.Background(), "books-test", Config{Exporter: ExporterFile, File: file})
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "GET /books")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Name":"GET /books"`)
+	assert.Contains(t, string(data), `"Value":"books-test"`)
+
+	tests := []struct {
+		name string
+		cfg  Config
+		err  string
+	}{
+		{name: "Disabled", cfg: Config{}},
+		{name: "Unknown exporter", cfg: Config{Exporter: "zipkin"}, err: `unknown trace exporter "zipkin"`},
+		{name: "File exporter without file", cfg: Config{Exporter: ExporterFile}, err: "the file exporter needs a file"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), "books-test", tc.cfg)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, shutdown(context.Background()))
+		})
+	}
+}
+
+func TestRPC(t *testing.T) {
+	name, attrs := RPC("/proto.BookService/GetBook")
+	assert.Equal(t, "proto.BookService/GetBook", name)
+	assert.Equal(t, []attribute.KeyValue{
+		semconv.RPCSystemGRPC,
+		semconv.RPCService("proto.BookService"),
+		semconv.RPCMethod("GetBook"),
+	}, attrs)
+}
+
+func TestMetadataCarrier(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	md := metadata.MD{}
+	propagation.TraceContext{}.Inject(ctx, MetadataCarrier(md))
+	assert.Equal(t, []string{"00-01000000000000000000000000000000-0200000000000000-01"}, md.Get("traceparent"))
+	assert.Equal(t, []string{"traceparent"}, MetadataCarrier(md).Keys())
+
+	got := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), MetadataCarrier(md)))
+	assert.Equal(t, sc.TraceID(), got.TraceID())
+	assert.Equal(t, sc.SpanID(), got.SpanID())
+	assert.True(t, got.IsRemote())
+}
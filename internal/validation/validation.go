@@ -0,0 +1,167 @@
+// Package validation holds the input rules shared by the HTTP controller
+// and the gRPC server, so both reject the same requests the same way.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Column limits of the books table.
+const (
+	TitleMaxLength  = 150
+	AuthorMaxLength = 50
+)
+
+// Normalizer is implemented by inputs that clean up their fields before
+// they are validated.
+type Normalizer interface {
+	Normalize()
+}
+
+// Checker is implemented by inputs with rules that can't be expressed with
+// tags, e.g. rules depending on several fields.
+type Checker interface {
+	Check() []FieldViolation
+}
+
+// FieldViolation describes why a single field was rejected.
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// Error is returned when an input breaks one or more rules.
+type Error struct {
+	Violations []FieldViolation
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.Field+" "+v.Description)
+	}
+	return "invalid input: " + strings.Join(msgs, "; ")
+}
+
+// Validator normalizes and validates structs tagged with `binding` rules.
+// It satisfies gin's binding.StructValidator so it can replace the default.
+type Validator struct {
+	once     sync.Once
+	validate *validator.Validate
+}
+
+var std = &Validator{}
+
+// Default returns the validator shared by the whole service.
+func Default() *Validator {
+	return std
+}
+
+// ValidateStruct normalizes obj if possible and checks its `binding` rules.
+// Anything that isn't a struct or a pointer to one is accepted as is.
+func (v *Validator) ValidateStruct(obj interface{}) error {
+	if obj == nil {
+		return nil
+	}
+
+	value := reflect.ValueOf(obj)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		if n, ok := obj.(Normalizer); ok {
+			n.Normalize()
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	v.lazyinit()
+
+	verr := &Error{}
+
+	err := v.validate.Struct(value.Interface())
+	if err != nil {
+		var ve validator.ValidationErrors
+		if !errors.As(err, &ve) {
+			return err
+		}
+		for _, fe := range ve {
+			verr.Violations = append(verr.Violations, FieldViolation{
+				Field:       fe.Field(),
+				Description: describe(fe),
+			})
+		}
+	}
+
+	if c, ok := obj.(Checker); ok {
+		verr.Violations = append(verr.Violations, c.Check()...)
+	}
+
+	if len(verr.Violations) == 0 {
+		return nil
+	}
+	return verr
+}
+
+// Engine returns the underlying validator/v10 instance.
+func (v *Validator) Engine() interface{} {
+	v.lazyinit()
+	return v.validate
+}
+
+func (v *Validator) lazyinit() {
+	v.once.Do(func() {
+		v.validate = validator.New()
+		v.validate.SetTagName("binding")
+		v.validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+			if name == "" || name == "-" {
+				return f.Name
+			}
+			return name
+		})
+		// Both can only fail on an invalid tag name.
+		_ = v.validate.RegisterValidation("notblank", notBlank)
+		_ = v.validate.RegisterValidation("nocontrol", noControl)
+	})
+}
+
+// Normalize trims surrounding whitespace and converts s to Unicode NFC, so
+// visually equal titles are stored and compared the same way.
+func Normalize(s string) string {
+	return norm.NFC.String(strings.TrimSpace(s))
+}
+
+func notBlank(fl validator.FieldLevel) bool {
+	return strings.TrimSpace(fl.Field().String()) != ""
+}
+
+func noControl(fl validator.FieldLevel) bool {
+	return strings.IndexFunc(fl.Field().String(), unicode.IsControl) < 0
+}
+
+func describe(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "notblank":
+		return "must not be blank"
+	case "nocontrol":
+		return "must not contain control characters"
+	case "max":
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	default:
+		return fmt.Sprintf("failed on the '%s' rule", fe.Tag())
+	}
+}
@@ -0,0 +1,60 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type input struct {
+	Title string `json:"title" binding:"required,notblank,nocontrol,max=5"`
+}
+
+func (in *input) Normalize() {
+	in.Title = Normalize(in.Title)
+}
+
+func TestValidator_ValidateStruct(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        input
+		wantTitle string
+		want      []FieldViolation
+	}{
+		{
+			name:      "Trimmed and normalized",
+			in:        input{Title: "  Café "},
+			wantTitle: "Café",
+		},
+		{
+			name: "Whitespace only",
+			in:   input{Title: " \t "},
+			want: []FieldViolation{{Field: "title", Description: "is required"}},
+		},
+		{
+			name: "Control characters",
+			in:   input{Title: "a\x00b"},
+			want: []FieldViolation{{Field: "title", Description: "must not contain control characters"}},
+		},
+		{
+			name: "Too long",
+			in:   input{Title: strings.Repeat("é", 6)},
+			want: []FieldViolation{{Field: "title", Description: "must be at most 5 characters long"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Default().ValidateStruct(&tc.in)
+			if tc.want == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.wantTitle, tc.in.Title)
+				return
+			}
+			verr, ok := err.(*Error)
+			if assert.True(t, ok, "unexpected error %v", err) {
+				assert.Equal(t, tc.want, verr.Violations)
+			}
+		})
+	}
+}
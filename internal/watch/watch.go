@@ -0,0 +1,49 @@
+// Package watch notices changes to files on disk.
+package watch
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// File calls fn every time the modification time or size of path changes,
+// checking every interval until ctx is done. A file that disappears is
+// reported again once it comes back. Polling keeps working for files swapped
+// by rename, as with mounted Kubernetes secrets and config maps.
+func File(ctx context.Context, path string, interval time.Duration, fn func()) {
+	last, _ := stat(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cur, err := stat(path)
+			if err != nil {
+				last = fileState{}
+				continue
+			}
+			if cur != last {
+				last = cur
+				fn()
+			}
+		}
+	}
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func stat(path string) (fileState, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{modTime: fi.ModTime(), size: fi.Size()}, nil
+}
@@ -0,0 +1,38 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("a"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	go File(ctx, path, 10*time.Millisecond, func() {
+		changed <- struct{}{}
+	})
+
+	select {
+	case <-changed:
+		t.Fatal("reported an unchanged file")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.NoError(t, os.WriteFile(path, []byte("ab"), 0o600))
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("change wasn't reported")
+	}
+}